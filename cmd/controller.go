@@ -2,23 +2,55 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"os"
 	"time"
 
+	"github.com/bpalermo/maestro/internal/config/constants"
 	"github.com/bpalermo/maestro/internal/core/shutdown"
+	"github.com/bpalermo/maestro/internal/proxy"
 	"github.com/bpalermo/maestro/internal/util"
 	"github.com/bpalermo/maestro/pkg/controller"
 	"github.com/bpalermo/maestro/pkg/http/server"
+	"github.com/bpalermo/maestro/pkg/injection"
+	"github.com/bpalermo/maestro/pkg/manager"
+	ratelimitserver "github.com/bpalermo/maestro/pkg/ratelimit/server"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spiffe/go-spiffe/v2/workloadapi"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+)
+
+const (
+	// podNamespaceEnv is the environment variable holding the namespace of the controller,
+	// set from the downward API.
+	podNamespaceEnv = "POD_NAMESPACE"
+	// serviceAccountNamespaceFile holds the namespace of the pods running in a cluster.
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
 )
 
 var (
 	gracefulShutdownTimeout time.Duration
+	bootstrapFormat         string
 
 	controllerArgs = controller.NewControllerArgs()
 	httpServerArgs = server.NewHTTPServerArgs()
 
+	injectionPolicyArgs struct {
+		revision             string
+		defaultRevision      bool
+		ignoredNamespaces    []string
+		namespaceSelector    string
+		objectSelector       string
+		neverInjectSelectors []string
+		driftPolicy          string
+		injectWorkloads      bool
+	}
+
 	// controllerCmd represents the controller command
 	controllerCmd = &cobra.Command{
 		Use:   "controller",
@@ -34,30 +66,172 @@ func init() {
 	controllerCmd.Flags().StringVar(&controllerArgs.KubeConfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
 
 	controllerCmd.Flags().StringVar(&httpServerArgs.Addr, "httpListenAddr", ":443", "HTTP server listen address.")
+	controllerCmd.Flags().StringVar(&httpServerArgs.TemplateNamespace, "sidecarTemplateNamespace", "maestro", "Namespace of the ConfigMap holding the sidecar injection template.")
+	controllerCmd.Flags().StringVar(&httpServerArgs.TemplateConfigMap, "sidecarTemplateConfigMap", "maestro-sidecar-template", "Name of the ConfigMap holding the sidecar injection template. The built-in template is used if empty.")
+	addInjectionPolicyFlags(controllerCmd.Flags())
+	controllerCmd.Flags().StringVar(&injectionPolicyArgs.driftPolicy, "injectionDriftPolicy", string(injection.DriftPolicyReconcile), "Action taken on pods injected with a stale sidecar template: reconcile re-injects them, refuse denies their admission.")
 	controllerCmd.Flags().StringVar(&httpServerArgs.SpireSocketPath, "spireSocketPath", "unix:///spiffe-workload-api/spire-agent.sock", "Provides an address for the Workload API. The value of the SPIFFE_ENDPOINT_SOCKET environment variable will be used if the option is unused.")
 
+	controllerCmd.Flags().StringVar(&controllerArgs.MetricsAddr, "metricsBindAddr", ":8080", "Address the controller metrics are served on. Metrics are disabled if set to 0.")
+	controllerCmd.Flags().StringVar(&controllerArgs.HealthProbeAddr, "healthProbeBindAddr", ":8083", "Address the controller liveness and readiness probes are served on.")
+	controllerCmd.Flags().BoolVar(&controllerArgs.LeaderElection.Enabled, "leaderElect", true, "Elect the controller replica reconciling the ProxyConfig resources, so multiple replicas can run.")
+	controllerCmd.Flags().StringVar(&controllerArgs.LeaderElection.Namespace, "leaderElectionNamespace", "", "Namespace of the leader election Lease. The namespace of the controller, read from $POD_NAMESPACE or its service account, is used if empty. Required out of cluster.")
+	controllerCmd.Flags().StringVar(&controllerArgs.LeaderElection.ID, "leaderElectionID", "maestro-controller", "Name of the leader election Lease. Suffixed with the revision unless set explicitly.")
+
+	controllerCmd.Flags().StringSliceVar(&controllerArgs.Watch.Namespaces, "watchNamespaces", nil, "Namespaces the ProxyConfig resources are watched in. All namespaces are watched if empty and no namespace selector is set.")
+	controllerCmd.Flags().StringVar(&controllerArgs.Watch.NamespaceSelector, "watchNamespaceSelector", "", "Label selector of additional namespaces the ProxyConfig resources are watched in, evaluated at startup.")
+	controllerCmd.Flags().BoolVar(&controllerArgs.Watch.ManagedConfigMapsOnly, "watchManagedConfigMapsOnly", true, "Only cache the ConfigMaps labelled controller=maestro, created by the controller.")
+
 	controllerCmd.Flags().DurationVar(&gracefulShutdownTimeout, "gracefulShutdownTimeout", 30*time.Second, "Graceful shutdown timeout in seconds")
 
-	controllerCmd.Flags().StringVar(&controllerArgs.ConfigMapPrefix, "configMapPrefix", "proxy-config-", "Prefix for proxy config config maps")
+	controllerCmd.Flags().StringVar(&controllerArgs.ConfigMapPrefix, "configMapPrefix", constants.ProxyConfigMapPrefix, "Prefix for proxy config config maps")
 	controllerCmd.Flags().StringVar(&controllerArgs.Spire.TrustDomain, "spireTrustDomain", "cluster.local", "Spire SPIFFE trust domain")
+	controllerCmd.Flags().StringVar(&bootstrapFormat, "bootstrapFormat", "yaml", "Format of the proxy bootstraps whose ProxyConfig does not set one: yaml writes the envoy.yaml key, json the envoy.json key.")
+
+	controllerCmd.Flags().StringVar(&controllerArgs.RateLimit.ListenAddr, "rateLimitListenAddr", ":8081", "Rate limit service listen address.")
+	controllerCmd.Flags().StringVar(&controllerArgs.RateLimit.ServiceHost, "rateLimitServiceHost", "", "Host proxies use to reach the rate limit service. The rate limit service is disabled if empty. Each replica counts hits on its own, so limits are multiplied by the number of replicas.")
+	controllerCmd.Flags().Uint32Var(&controllerArgs.RateLimit.ServicePort, "rateLimitServicePort", 8081, "Port proxies use to reach the rate limit service.")
+
+	controllerCmd.Flags().StringVar(&controllerArgs.AccessLog.ServiceHost, "accessLogServiceHost", "", "Host proxies use to reach the access log service, served by the registrar. gRPC access logs are disabled if empty.")
+	controllerCmd.Flags().Uint32Var(&controllerArgs.AccessLog.ServicePort, "accessLogServicePort", 8082, "Port proxies use to reach the access log service. Must match the port of the registrar --accessLogListenAddr.")
+	controllerCmd.Flags().StringVar(&controllerArgs.Tracing.ServiceHost, "tracingServiceHost", "", "Host of the OpenTelemetry collector proxies export spans to. Tracing is disabled if empty.")
+	controllerCmd.Flags().Uint32Var(&controllerArgs.Tracing.ServicePort, "tracingServicePort", 4317, "OTLP gRPC port of the OpenTelemetry collector.")
+
+	controllerCmd.Flags().BoolVar(&controllerArgs.Rollout.Enabled, "rolloutOnConfigChange", true, "Restart the deployments, statefulsets and daemonsets of a ProxyConfig when its bootstrap changes. Workloads annotated with maestro.io/rollout=false are never restarted.")
+	controllerCmd.Flags().DurationVar(&controllerArgs.Rollout.Interval, "rolloutInterval", time.Minute, "Minimum interval between two workload restarts in a namespace, once the burst is spent.")
+	controllerCmd.Flags().IntVar(&controllerArgs.Rollout.Burst, "rolloutBurst", 5, "Number of workloads of a namespace restarted at once.")
+}
+
+// addInjectionPolicyFlags adds the flags of the pods injected, shared by the commands serving
+// and configuring the mutating webhook so that they select the same pods.
+func addInjectionPolicyFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&injectionPolicyArgs.revision, "revision", "", "Revision of this maestro, injecting the pods and namespaces labelled with maestro.io/rev set to it. Bootstrap and sidecar template ConfigMap names are suffixed with it unless set explicitly.")
+	flags.BoolVar(&injectionPolicyArgs.defaultRevision, "defaultRevision", true, "Whether this revision injects the pods without revision.")
+	flags.StringSliceVar(&injectionPolicyArgs.ignoredNamespaces, "injectionIgnoredNamespaces", injection.DefaultIgnoredNamespaces, "Namespaces pods are never injected in.")
+	flags.StringVar(&injectionPolicyArgs.namespaceSelector, "injectionNamespaceSelector", injection.DefaultNamespaceSelector, "Label selector of the namespaces pods are injected in. All namespaces are selected if empty.")
+	flags.StringVar(&injectionPolicyArgs.objectSelector, "injectionObjectSelector", injection.DefaultObjectSelector, "Label selector of the pods injected. All pods are selected if empty.")
+	flags.StringArrayVar(&injectionPolicyArgs.neverInjectSelectors, "injectionNeverInjectSelector", []string{injection.DefaultNeverInjectSelector}, "Label selector of pods never injected, such as control plane pods. Can be repeated.")
+	flags.BoolVar(&injectionPolicyArgs.injectWorkloads, "injectWorkloads", false, "Whether the pod templates of deployments, statefulsets, daemonsets and jobs are injected, in addition to pods.")
 }
 
-func runController(_ *cobra.Command, _ []string) {
-	ctx, cancel := context.WithCancel(context.Background())
+// newInjectionPolicy returns the injection policy set by the injection policy flags.
+func newInjectionPolicy() (*injection.Policy, error) {
+	policy, err := injection.NewPolicy(
+		injectionPolicyArgs.ignoredNamespaces,
+		injectionPolicyArgs.namespaceSelector,
+		injectionPolicyArgs.objectSelector,
+		injectionPolicyArgs.neverInjectSelectors,
+	)
+	if err != nil {
+		return nil, err
+	}
+	policy.Revision = injectionPolicyArgs.revision
+	policy.DefaultRevision = injectionPolicyArgs.defaultRevision
+	policy.InjectWorkloads = injectionPolicyArgs.injectWorkloads
+	return policy, nil
+}
+
+func runController(cmd *cobra.Command, _ []string) {
+	ctx, cancel := context.WithCancel(signals.SetupSignalHandler())
 	defer cancel()
 
 	logger := klog.FromContext(ctx)
+	logf.SetLogger(logger)
+
+	injectionPolicy, err := newInjectionPolicy()
+	if err != nil {
+		logger.Error(err, "Invalid injection policy")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+	// kubelet only reaches the application through the proxy when the inbound listener requires mTLS
+	injectionPolicy.RewriteProbes = controllerArgs.Spire.TrustDomain != ""
+	if injectionPolicy.Drift, err = injection.ParseDriftPolicy(injectionPolicyArgs.driftPolicy); err != nil {
+		logger.Error(err, "Invalid injection policy")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+	httpServerArgs.InjectionPolicy = injectionPolicy
+
+	// revisions running side by side must not share their ConfigMaps
+	if revision := injectionPolicyArgs.revision; revision != "" {
+		if !cmd.Flags().Changed("configMapPrefix") {
+			controllerArgs.ConfigMapPrefix = controllerArgs.ConfigMapPrefix + revision + "-"
+		}
+		if !cmd.Flags().Changed("sidecarTemplateConfigMap") && httpServerArgs.TemplateConfigMap != "" {
+			httpServerArgs.TemplateConfigMap = httpServerArgs.TemplateConfigMap + "-" + revision
+		}
+		if !cmd.Flags().Changed("leaderElectionID") {
+			controllerArgs.LeaderElection.ID = controllerArgs.LeaderElection.ID + "-" + revision
+		}
+	}
+
+	if controllerArgs.LeaderElection.Enabled && controllerArgs.LeaderElection.Namespace == "" {
+		if controllerArgs.LeaderElection.Namespace, err = leaderElectionNamespace(); err != nil {
+			logger.Error(err, "Invalid leader election")
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		}
+	}
 
 	var opts []controller.MaestroControllerOption
 	if controllerArgs.ConfigMapPrefix != "" {
 		opts = append(opts, controller.WithConfigMapPrefix(controllerArgs.ConfigMapPrefix))
+		httpServerArgs.ConfigMapPrefix = controllerArgs.ConfigMapPrefix
 	}
 
-	c := controller.NewMaestroController(
-		ctx,
-		controllerArgs,
-		opts...,
-	)
+	format, err := proxy.ParseFormat(bootstrapFormat)
+	if err != nil {
+		logger.Error(err, "Invalid bootstrap format")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+	opts = append(opts, controller.WithBootstrapFormat(format))
+
+	var rateLimitServer *ratelimitserver.RateLimitServer
+	if controllerArgs.RateLimit.ServiceHost != "" {
+		rateLimitServer = ratelimitserver.NewRateLimitServer(
+			logger,
+			ratelimitserver.WithAddress(controllerArgs.RateLimit.ListenAddr),
+			ratelimitserver.WithShutdownTimeout(gracefulShutdownTimeout),
+		)
+		opts = append(opts, controller.WithRateLimitServer(rateLimitServer, proxy.ServiceAddress{
+			Host: controllerArgs.RateLimit.ServiceHost,
+			Port: controllerArgs.RateLimit.ServicePort,
+		}))
+	}
+
+	if controllerArgs.AccessLog.ServiceHost != "" {
+		opts = append(opts, controller.WithAccessLogService(proxy.ServiceAddress{
+			Host: controllerArgs.AccessLog.ServiceHost,
+			Port: controllerArgs.AccessLog.ServicePort,
+		}))
+	}
+
+	if controllerArgs.Tracing.ServiceHost != "" {
+		opts = append(opts, controller.WithTracingService(proxy.ServiceAddress{
+			Host: controllerArgs.Tracing.ServiceHost,
+			Port: controllerArgs.Tracing.ServicePort,
+		}))
+	}
+
+	if controllerArgs.Rollout.Enabled {
+		if err := controllerArgs.Rollout.Validate(); err != nil {
+			logger.Error(err, "Invalid rollout configuration")
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		}
+		opts = append(opts, controller.WithRollout(*controllerArgs.Rollout))
+	}
+
+	mgr, err := manager.NewControllerManager(ctx, cmd.Name(), controllerArgs, opts...)
+	if err != nil {
+		logger.Error(err, "Unable to create controller manager")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+
+	if rateLimitServer != nil {
+		// Add rate limit server to the manager as runnable
+		if err := mgr.Add(rateLimitServer); err != nil {
+			logger.Error(err, "Unable to add rate limit server to manager")
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		}
+	}
 
 	// Create a `workloadapi.X509Source`, it will connect to Workload API using the provided socket.
 	// If the socket path is not defined using `workloadapi.SourceOption`, the value from environment variable `SPIFFE_ENDPOINT_SOCKET` is used.
@@ -69,7 +243,25 @@ func runController(_ *cobra.Command, _ []string) {
 	}
 	defer util.MustClose(source)
 
-	s, err := server.NewServer(httpServerArgs, source, logger)
+	templateWatcher := injection.NewTemplateWatcher(logger, mgr.KubeClientSet(), httpServerArgs.TemplateNamespace, httpServerArgs.TemplateConfigMap)
+	if err := templateWatcher.Start(ctx); err != nil {
+		logger.Error(err, "Unable to watch the sidecar template")
+		cancel()
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+
+	// the namespaces of the pods, whose labels the injection policy selects on every admission
+	namespaceInformers := informers.NewSharedInformerFactory(mgr.KubeClientSet(), time.Minute*10)
+	namespaces := namespaceInformers.Core().V1().Namespaces()
+	namespaceLister := namespaces.Lister()
+	namespaceInformers.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), namespaces.Informer().HasSynced) {
+		logger.Error(nil, "Unable to sync the namespace cache")
+		cancel()
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+
+	s, err := server.NewServer(httpServerArgs, source, mgr.KubeClientSet(), namespaceLister, mgr.GetAPIReader(), templateWatcher, logger)
 	if err != nil {
 		logger.Error(err, "Could not create a HTTP server")
 		cancel()
@@ -78,7 +270,11 @@ func runController(_ *cobra.Command, _ []string) {
 
 	errChan := make(chan error, 1)
 
-	go c.Start(logger, errChan)
+	go func() {
+		if err := mgr.Start(ctx); err != nil {
+			errChan <- err
+		}
+	}()
 	go s.Start(logger, errChan)
 
 	go func() {
@@ -90,3 +286,16 @@ func runController(_ *cobra.Command, _ []string) {
 
 	shutdown.AddShutdownHook(ctx, logger, 30*time.Second)
 }
+
+// leaderElectionNamespace returns the namespace of the controller, from the downward API or
+// the service account mounted in its pod, as there is none to default to out of cluster.
+func leaderElectionNamespace() (string, error) {
+	if namespace := os.Getenv(podNamespaceEnv); namespace != "" {
+		return namespace, nil
+	}
+	if _, err := os.Stat(serviceAccountNamespaceFile); err == nil {
+		// read by the manager
+		return "", nil
+	}
+	return "", errors.New("--leaderElectionNamespace is required with --leaderElect when running out of cluster, or disable leader election with --leaderElect=false")
+}
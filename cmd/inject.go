@@ -0,0 +1,285 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bpalermo/maestro/internal/config"
+	"github.com/bpalermo/maestro/internal/config/constants"
+	"github.com/bpalermo/maestro/pkg/http/handlers"
+	"github.com/bpalermo/maestro/pkg/injection"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	yamlDocumentSeparator = "---\n"
+)
+
+var (
+	injectArgs struct {
+		filename        string
+		output          string
+		templateFile    string
+		configMapFiles  []string
+		configMapPrefix string
+		revision        string
+		defaultRevision bool
+		nativeSidecars  bool
+		rewriteProbes   bool
+	}
+
+	// injectCmd represents the inject command
+	injectCmd = &cobra.Command{
+		Use:   "inject",
+		Short: "Injects the proxy sidecar in manifests",
+		Long:  "Injects the proxy sidecar in the Pod, Deployment, StatefulSet, DaemonSet and Job manifests read from a file or stdin, as the mutating webhook would. Other manifests are written unchanged. The webhook reads the ConfigMap generated by the controller for the ProxyConfig of a pod: pass it with --configMap, as written by kubectl get configmap -o yaml, for the pods to be injected with the OPA sidecar of a ProxyConfig enabling authorization, the outbound listener of their ProxyConfig and the config hash. Pods whose ConfigMap is not given are injected without them.",
+		Run:   runInject,
+	}
+)
+
+// staticTemplate provides a sidecar template loaded once.
+type staticTemplate struct {
+	template *config.SidecarTemplate
+}
+
+func (t staticTemplate) Template() *config.SidecarTemplate {
+	return t.template
+}
+
+func init() {
+	rootCmd.AddCommand(injectCmd)
+
+	injectCmd.Flags().StringVarP(&injectArgs.filename, "filename", "f", "-", "Manifests to inject. Read from stdin if -.")
+	injectCmd.Flags().StringVarP(&injectArgs.output, "output", "o", "-", "File the injected manifests are written to. Written to stdout if -.")
+	injectCmd.Flags().StringVar(&injectArgs.templateFile, "sidecarTemplateFile", "", "ConfigMap manifest holding the sidecar injection template. The built-in template is used if empty.")
+	injectCmd.Flags().StringSliceVar(&injectArgs.configMapFiles, "configMap", nil, "Manifests of the proxy ConfigMaps generated by the controller for the ProxyConfigs of the injected pods. Can be repeated.")
+	injectCmd.Flags().StringVar(&injectArgs.configMapPrefix, "configMapPrefix", constants.ProxyConfigMapPrefix, "Prefix for proxy config config maps")
+	injectCmd.Flags().StringVar(&injectArgs.revision, "revision", "", "Revision of maestro injecting the manifests. Pods labelled with maestro.io/rev set to another revision are not injected.")
+	injectCmd.Flags().BoolVar(&injectArgs.defaultRevision, "defaultRevision", true, "Whether this revision injects the pods without revision.")
+	injectCmd.Flags().BoolVar(&injectArgs.nativeSidecars, "nativeSidecars", true, "Whether the target cluster supports native sidecars.")
+	injectCmd.Flags().BoolVar(&injectArgs.rewriteProbes, "rewriteProbes", false, "Whether the HTTP probes of the application are rewritten to go through the proxy, required when the proxies enforce mTLS.")
+}
+
+func runInject(_ *cobra.Command, _ []string) {
+	ctx := context.Background()
+	logger := klog.FromContext(ctx)
+
+	if err := inject(logger); err != nil {
+		logger.Error(err, "Unable to inject manifests")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+}
+
+func inject(logger klog.Logger) error {
+	template, err := loadSidecarTemplate(injectArgs.templateFile)
+	if err != nil {
+		return err
+	}
+
+	policy := injection.DefaultPolicy()
+	// the manifests are injected on request, whatever the labels of their namespace
+	policy.NamespaceSelector = nil
+	policy.Revision = injectArgs.revision
+	policy.DefaultRevision = injectArgs.defaultRevision
+	policy.RewriteProbes = injectArgs.rewriteProbes
+	configMaps, err := loadConfigMaps(injectArgs.configMapFiles)
+	if err != nil {
+		return err
+	}
+	handler := handlers.NewOfflineMutationHandler(logger, injectArgs.configMapPrefix, staticTemplate{template}, policy, injectArgs.nativeSidecars).WithConfigMaps(configMaps)
+
+	in := os.Stdin
+	if injectArgs.filename != "-" {
+		if in, err = os.Open(injectArgs.filename); err != nil {
+			return err
+		}
+		defer in.Close()
+	}
+
+	out := os.Stdout
+	if injectArgs.output != "-" {
+		if out, err = os.Create(injectArgs.output); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+
+	return injectManifests(handler, in, out)
+}
+
+// loadSidecarTemplate parses the sidecar template from a ConfigMap manifest.
+func loadSidecarTemplate(filename string) (*config.SidecarTemplate, error) {
+	if filename == "" {
+		return config.DefaultSidecarTemplate(), nil
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := yaml.Unmarshal(data, configMap); err != nil {
+		return nil, fmt.Errorf("invalid sidecar template ConfigMap %s: %w", filename, err)
+	}
+	return config.ParseSidecarTemplate(configMap.Data)
+}
+
+// loadConfigMaps reads the ConfigMaps of the YAML documents of the files. Other documents are
+// ignored.
+func loadConfigMaps(filenames []string) ([]corev1.ConfigMap, error) {
+	decoder := scheme.Codecs.UniversalDeserializer()
+
+	var configMaps []corev1.ConfigMap
+	for _, filename := range filenames {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+		for {
+			document, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid ConfigMap manifest %s: %w", filename, err)
+			}
+			if len(bytes.TrimSpace(document)) == 0 {
+				continue
+			}
+
+			decoded, err := decodeConfigMaps(decoder, document)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ConfigMap manifest %s: %w", filename, err)
+			}
+			configMaps = append(configMaps, decoded...)
+		}
+	}
+	return configMaps, nil
+}
+
+// decodeConfigMaps returns the ConfigMap of a document, or the ConfigMaps of a list such as the
+// ones written by kubectl get.
+func decodeConfigMaps(decoder runtime.Decoder, document []byte) ([]corev1.ConfigMap, error) {
+	obj, _, err := decoder.Decode(document, nil, nil)
+	if err != nil {
+		if runtime.IsNotRegisteredError(err) || runtime.IsMissingKind(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	switch o := obj.(type) {
+	case *corev1.ConfigMap:
+		return []corev1.ConfigMap{*o}, nil
+	case *corev1.ConfigMapList:
+		return o.Items, nil
+	case *corev1.List:
+		var configMaps []corev1.ConfigMap
+		for _, item := range o.Items {
+			decoded, err := decodeConfigMaps(decoder, item.Raw)
+			if err != nil {
+				return nil, err
+			}
+			configMaps = append(configMaps, decoded...)
+		}
+		return configMaps, nil
+	default:
+		return nil, nil
+	}
+}
+
+// injectManifests injects the YAML documents read from in and writes them to out.
+func injectManifests(handler *handlers.AdmissionMutationHandler, in io.Reader, out io.Writer) error {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(in))
+	decoder := scheme.Codecs.UniversalDeserializer()
+
+	first := true
+	for {
+		document, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(document)) == 0 {
+			continue
+		}
+		if !bytes.HasSuffix(document, []byte("\n")) {
+			document = append(document, '\n')
+		}
+
+		injected, err := injectManifest(handler, decoder, document)
+		if err != nil {
+			return err
+		}
+
+		if !first {
+			if _, err := io.WriteString(out, yamlDocumentSeparator); err != nil {
+				return err
+			}
+		}
+		first = false
+		if _, err := out.Write(injected); err != nil {
+			return err
+		}
+	}
+}
+
+// injectManifest injects a single YAML document, returned unchanged if it is not a pod or workload.
+func injectManifest(handler *handlers.AdmissionMutationHandler, decoder runtime.Decoder, document []byte) ([]byte, error) {
+	obj, gvk, err := decoder.Decode(document, nil, nil)
+	if err != nil {
+		if runtime.IsNotRegisteredError(err) || runtime.IsMissingKind(err) {
+			return document, nil
+		}
+		return nil, err
+	}
+
+	if pod, ok := obj.(*corev1.Pod); ok {
+		injected, err := handler.InjectPod(pod)
+		if err != nil {
+			return nil, fmt.Errorf("unable to inject pod %s: %w", klog.KObj(pod), err)
+		}
+		if equality.Semantic.DeepEqual(pod, injected) {
+			return document, nil
+		}
+		obj = injected
+	} else if template := injection.PodTemplate(obj); template != nil {
+		workload, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		pod, err := handler.InjectPod(injection.TemplatePod(workload.GetNamespace(), template))
+		if err != nil {
+			return nil, fmt.Errorf("unable to inject %s %s: %w", gvk.Kind, klog.KObj(workload), err)
+		}
+		if equality.Semantic.DeepEqual(template.Spec, pod.Spec) && equality.Semantic.DeepEqual(template.Annotations, pod.Annotations) {
+			return document, nil
+		}
+		template.ObjectMeta = pod.ObjectMeta
+		template.Spec = pod.Spec
+		template.Namespace = ""
+	} else {
+		return document, nil
+	}
+
+	obj.GetObjectKind().SetGroupVersionKind(*gvk)
+	return yaml.Marshal(obj)
+}
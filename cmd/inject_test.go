@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bpalermo/maestro/internal/config"
+	"github.com/bpalermo/maestro/internal/config/annotation"
+	"github.com/bpalermo/maestro/pkg/http/handlers"
+	"github.com/bpalermo/maestro/pkg/injection"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2/ktesting"
+	"sigs.k8s.io/yaml"
+)
+
+func TestInjectManifests(t *testing.T) {
+	const (
+		service = `apiVersion: v1
+kind: Service
+metadata:
+  name: orders
+spec:
+  ports:
+  - port: 8080
+`
+		proxyConfig = `apiVersion: config.maestro.io/v1
+kind: ProxyConfig
+metadata:
+  name: orders
+spec:
+  service:
+    name: orders
+`
+		deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: orders
+  namespace: shop
+spec:
+  selector:
+    matchLabels:
+      app: orders
+  template:
+    metadata:
+      labels:
+        app: orders
+    spec:
+      containers:
+      - name: app
+        image: orders
+`
+	)
+
+	policy := injection.DefaultPolicy()
+	policy.NamespaceSelector = nil
+	handler := handlers.NewOfflineMutationHandler(ktesting.NewLogger(t, ktesting.NewConfig()), "proxy-config-", staticTemplate{config.DefaultSidecarTemplate()}, policy, true)
+
+	out := &bytes.Buffer{}
+	require.NoError(t, injectManifests(handler, strings.NewReader(service+"---\n"+proxyConfig+"---\n\n---\n"+deployment), out))
+
+	documents := strings.Split(out.String(), yamlDocumentSeparator)
+	require.Len(t, documents, 3)
+	assert.Equal(t, service, documents[0])
+	assert.Equal(t, proxyConfig, documents[1])
+
+	injected := &appsv1.Deployment{}
+	require.NoError(t, yaml.Unmarshal([]byte(documents[2]), injected))
+	assert.Equal(t, "Deployment", injected.Kind)
+	assert.Equal(t, "shop", injected.Namespace)
+	assert.Empty(t, injected.Spec.Template.Namespace)
+	assert.Equal(t, map[string]string{"app": "orders"}, injected.Spec.Template.Labels)
+	assert.Contains(t, injected.Spec.Template.Annotations, annotation.SidecarStatus)
+	require.Len(t, injected.Spec.Template.Spec.InitContainers, 1)
+	assert.Equal(t, "proxy", injected.Spec.Template.Spec.InitContainers[0].Name)
+	require.Len(t, injected.Spec.Template.Spec.Containers, 1)
+	assert.Equal(t, "app", injected.Spec.Template.Spec.Containers[0].Name)
+
+	t.Run("not injected", func(t *testing.T) {
+		disabled := strings.Replace(deployment, "        app: orders\n    spec:", "        app: orders\n        maestro.io/injection: disabled\n    spec:", 1)
+
+		out := &bytes.Buffer{}
+		require.NoError(t, injectManifests(handler, strings.NewReader(disabled), out))
+		assert.Equal(t, disabled, out.String())
+	})
+
+	t.Run("pod", func(t *testing.T) {
+		const pod = `apiVersion: v1
+kind: Pod
+metadata:
+  name: orders
+  namespace: shop
+spec:
+  containers:
+  - name: app
+    image: orders
+`
+		out := &bytes.Buffer{}
+		require.NoError(t, injectManifests(handler, strings.NewReader(pod), out))
+
+		injected := &corev1.Pod{}
+		require.NoError(t, yaml.Unmarshal(out.Bytes(), injected))
+		assert.Equal(t, "Pod", injected.Kind)
+		assert.Equal(t, "shop", injected.Namespace)
+		assert.Contains(t, injected.Annotations, annotation.SidecarStatus)
+		assert.Equal(t, []string{"proxy"}, containerNames(injected.Spec.InitContainers))
+		assert.Equal(t, []string{"app"}, containerNames(injected.Spec.Containers))
+	})
+
+	t.Run("stateful set and job", func(t *testing.T) {
+		const (
+			statefulSet = `apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: ledger
+spec:
+  serviceName: ledger
+  selector:
+    matchLabels:
+      app: ledger
+  template:
+    metadata:
+      labels:
+        app: ledger
+    spec:
+      containers:
+      - name: app
+        image: ledger
+`
+			job = `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+spec:
+  template:
+    spec:
+      restartPolicy: Never
+      containers:
+      - name: migrate
+        image: migrate
+`
+		)
+
+		out := &bytes.Buffer{}
+		require.NoError(t, injectManifests(handler, strings.NewReader(statefulSet+"---\n"+job), out))
+		documents := strings.Split(out.String(), yamlDocumentSeparator)
+		require.Len(t, documents, 2)
+
+		injectedStatefulSet := &appsv1.StatefulSet{}
+		require.NoError(t, yaml.Unmarshal([]byte(documents[0]), injectedStatefulSet))
+		assert.Equal(t, "StatefulSet", injectedStatefulSet.Kind)
+		assert.Contains(t, injectedStatefulSet.Spec.Template.Annotations, annotation.SidecarStatus)
+		assert.Equal(t, []string{"proxy"}, containerNames(injectedStatefulSet.Spec.Template.Spec.InitContainers))
+
+		injectedJob := &batchv1.Job{}
+		require.NoError(t, yaml.Unmarshal([]byte(documents[1]), injectedJob))
+		assert.Equal(t, "Job", injectedJob.Kind)
+		assert.Contains(t, injectedJob.Spec.Template.Annotations, annotation.SidecarStatus)
+		assert.Equal(t, []string{"proxy"}, containerNames(injectedJob.Spec.Template.Spec.InitContainers))
+		assert.Equal(t, []string{"migrate"}, containerNames(injectedJob.Spec.Template.Spec.Containers))
+	})
+
+	t.Run("other revision", func(t *testing.T) {
+		policy := injection.DefaultPolicy()
+		policy.NamespaceSelector = nil
+		policy.Revision = "stable"
+		handler := handlers.NewOfflineMutationHandler(ktesting.NewLogger(t, ktesting.NewConfig()), "proxy-config-", staticTemplate{config.DefaultSidecarTemplate()}, policy, true)
+
+		canary := strings.Replace(deployment, "        app: orders\n    spec:", "        app: orders\n        maestro.io/rev: canary\n    spec:", 1)
+		out := &bytes.Buffer{}
+		require.NoError(t, injectManifests(handler, strings.NewReader(canary), out))
+		assert.Equal(t, canary, out.String())
+
+		stable := strings.Replace(deployment, "        app: orders\n    spec:", "        app: orders\n        maestro.io/rev: stable\n    spec:", 1)
+		out.Reset()
+		require.NoError(t, injectManifests(handler, strings.NewReader(stable), out))
+		assert.Contains(t, out.String(), annotation.SidecarStatus)
+	})
+}
+
+func TestInjectManifests_ConfigMaps(t *testing.T) {
+	const configMaps = `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: proxy-config-orders
+    namespace: shop
+  data:
+    envoy.yaml: bootstrap
+    authz-policy-configmap: orders-policy
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: proxy-config-payments
+    namespace: billing
+  data:
+    envoy.yaml: bootstrap
+`
+	filename := filepath.Join(t.TempDir(), "configmaps.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(configMaps), 0o600))
+
+	loaded, err := loadConfigMaps([]string{filename})
+	require.NoError(t, err)
+	require.Len(t, loaded, 2)
+	assert.Equal(t, "proxy-config-orders", loaded[0].Name)
+	assert.Equal(t, "orders-policy", loaded[0].Data["authz-policy-configmap"])
+
+	policy := injection.DefaultPolicy()
+	policy.NamespaceSelector = nil
+	handler := handlers.NewOfflineMutationHandler(ktesting.NewLogger(t, ktesting.NewConfig()), "proxy-config-", staticTemplate{config.DefaultSidecarTemplate()}, policy, true).WithConfigMaps(loaded)
+
+	pod := func(namespace string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "orders", Namespace: namespace},
+			Spec:       corev1.PodSpec{ServiceAccountName: "orders", Containers: []corev1.Container{{Name: "app"}}},
+		}
+	}
+
+	injected, err := handler.InjectPod(pod("shop"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"opa", "proxy"}, containerNames(injected.Spec.InitContainers))
+	assert.Contains(t, injected.Annotations, annotation.ConfigHash)
+
+	// the ConfigMap of another namespace does not apply
+	injected, err = handler.InjectPod(pod("billing"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"proxy"}, containerNames(injected.Spec.InitContainers))
+	assert.NotContains(t, injected.Annotations, annotation.ConfigHash)
+}
+
+func containerNames(containers []corev1.Container) []string {
+	names := make([]string, 0, len(containers))
+	for _, container := range containers {
+		names = append(names, container.Name)
+	}
+	return names
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/bpalermo/maestro/internal/config/constants"
+	"github.com/bpalermo/maestro/internal/iptables"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+var (
+	iptablesArgs struct {
+		proxyUID             int64
+		inboundPort          uint32
+		outboundPort         uint32
+		excludeInboundPorts  string
+		excludeOutboundPorts string
+		excludeOutboundCIDRs string
+		dryRun               bool
+	}
+
+	// iptablesCmd represents the iptables command
+	iptablesCmd = &cobra.Command{
+		Use:   "iptables",
+		Short: "Installs the rules redirecting the traffic of a pod to its proxy",
+		Long:  "Installs the rules redirecting the traffic of a pod to its proxy with iptables-restore, which must be available in the image running the command.",
+		Run:   runIptables,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(iptablesCmd)
+
+	iptablesCmd.Flags().Int64Var(&iptablesArgs.proxyUID, "proxyUID", constants.ProxyUID, "User the proxy runs as. Its traffic is not redirected.")
+	iptablesCmd.Flags().Uint32Var(&iptablesArgs.inboundPort, "inboundPort", constants.ProxyInboundPort, "Proxy port inbound traffic is redirected to.")
+	iptablesCmd.Flags().Uint32Var(&iptablesArgs.outboundPort, "outboundPort", constants.ProxyOutboundPort, "Proxy port outbound traffic is redirected to.")
+	iptablesCmd.Flags().StringVar(&iptablesArgs.excludeInboundPorts, "excludeInboundPorts", "", "Comma-separated inbound ports that are not redirected. The proxy admin and probe ports are always excluded.")
+	iptablesCmd.Flags().StringVar(&iptablesArgs.excludeOutboundPorts, "excludeOutboundPorts", "", "Comma-separated outbound ports that are not redirected.")
+	iptablesCmd.Flags().StringVar(&iptablesArgs.excludeOutboundCIDRs, "excludeOutboundCIDRs", "", "Comma-separated IPv4 ranges outbound traffic to is not redirected.")
+	iptablesCmd.Flags().BoolVar(&iptablesArgs.dryRun, "dryRun", false, "Print the rules instead of installing them.")
+}
+
+func runIptables(_ *cobra.Command, _ []string) {
+	ctx := context.Background()
+	logger := klog.FromContext(ctx)
+
+	ruleSet, err := iptablesRuleSet()
+	if err != nil {
+		logger.Error(err, "Invalid iptables configuration")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+
+	if iptablesArgs.dryRun {
+		fmt.Print(ruleSet.String())
+		return
+	}
+
+	cmd := exec.CommandContext(ctx, "iptables-restore", "--noflush")
+	cmd.Stdin = strings.NewReader(ruleSet.String())
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		logger.Error(err, "Unable to install iptables rules")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+
+	logger.Info("Installed iptables rules", "rules", len(ruleSet.Rules))
+}
+
+func iptablesRuleSet() (*iptables.RuleSet, error) {
+	excludeInboundPorts, err := iptables.ParsePorts(iptablesArgs.excludeInboundPorts)
+	if err != nil {
+		return nil, err
+	}
+	excludeOutboundPorts, err := iptables.ParsePorts(iptablesArgs.excludeOutboundPorts)
+	if err != nil {
+		return nil, err
+	}
+	excludeOutboundCIDRs, err := iptables.ParseCIDRs(iptablesArgs.excludeOutboundCIDRs)
+	if err != nil {
+		return nil, err
+	}
+
+	return iptables.Generate(&iptables.Config{
+		ProxyUID:             iptablesArgs.proxyUID,
+		InboundPort:          iptablesArgs.inboundPort,
+		OutboundPort:         iptablesArgs.outboundPort,
+		ExcludeInboundPorts:  append([]uint32{constants.ProxyAdminPort, constants.ProxyProbePort}, excludeInboundPorts...),
+		ExcludeOutboundPorts: excludeOutboundPorts,
+		ExcludeOutboundCIDRs: excludeOutboundCIDRs,
+	})
+}
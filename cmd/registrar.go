@@ -4,6 +4,7 @@ import (
 	"os"
 	"time"
 
+	accesslogserver "github.com/bpalermo/maestro/pkg/accesslog/server"
 	"github.com/bpalermo/maestro/pkg/manager"
 	"github.com/bpalermo/maestro/pkg/xds/server"
 	"github.com/spf13/cobra"
@@ -15,11 +16,14 @@ import (
 const (
 	defaultClusterName     = "unknown"
 	defaultShutdownTimeout = 30 * time.Second
+
+	defaultAccessLogListenAddr = ":8082"
 )
 
 var (
 	clusterName           string
 	serverShutdownTimeout time.Duration
+	accessLogListenAddr   string
 
 	// registrarCmd represents the controller command
 	registrarCmd = &cobra.Command{
@@ -34,6 +38,7 @@ func init() {
 
 	registrarCmd.Flags().StringVar(&clusterName, "cluster", defaultClusterName, "Cluster name. It will be used to push registration info to the control plane.")
 	registrarCmd.Flags().DurationVar(&serverShutdownTimeout, "serverShutdownTimeout", defaultShutdownTimeout, "Timeout for graceful shutdown.")
+	registrarCmd.Flags().StringVar(&accessLogListenAddr, "accessLogListenAddr", defaultAccessLogListenAddr, "Address the access log service listens on. The access log service is disabled if empty. The controller --accessLogServicePort must match its port.")
 }
 
 func runRegistrar(cmd *cobra.Command, _ []string) {
@@ -59,6 +64,26 @@ func runRegistrar(cmd *cobra.Command, _ []string) {
 		os.Exit(1)
 	}
 
+	if accessLogListenAddr != "" {
+		// Create access log server
+		als, err := accesslogserver.NewAccessLogServer(log,
+			accesslogserver.WithAddress(accessLogListenAddr),
+			accesslogserver.WithShutdownTimeout(serverShutdownTimeout),
+			accesslogserver.WithProxyConfigs(mgr.GetClient()),
+		)
+		if err != nil {
+			log.Error(err, "failed to create access log server")
+			os.Exit(1)
+		}
+
+		// Add access log server to the manager as runnable
+		err = mgr.Add(als)
+		if err != nil {
+			log.Error(err, "failed to add access log server to manager")
+			os.Exit(1)
+		}
+	}
+
 	log.Info("starting controller manager")
 	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
 		log.Error(err, "failed to start manager")
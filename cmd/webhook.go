@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/bpalermo/maestro/pkg/injection"
+	"github.com/spf13/cobra"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	webhookArgs struct {
+		name             string
+		webhookName      string
+		serviceName      string
+		serviceNamespace string
+		servicePort      int32
+		caBundleFile     string
+		output           string
+	}
+
+	// webhookCmd represents the webhook command
+	webhookCmd = &cobra.Command{
+		Use:   "webhook",
+		Short: "Generates the mutating webhook configuration of the injector",
+		Long:  "Generates the MutatingWebhookConfiguration sending the pods selected by the injection policy to the controller. It takes the injection policy flags of the controller, which must be set to the same values so that the webhooks select the pods the controller injects.",
+		Run:   runWebhook,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(webhookCmd)
+
+	addInjectionPolicyFlags(webhookCmd.Flags())
+	webhookCmd.Flags().StringVar(&webhookArgs.name, "name", "maestro-sidecar-injector", "Name of the MutatingWebhookConfiguration. Suffixed with the revision unless set explicitly.")
+	webhookCmd.Flags().StringVar(&webhookArgs.webhookName, "webhookName", "sidecar.maestro.io", "Name the webhooks of the configuration are prefixed with.")
+	webhookCmd.Flags().StringVar(&webhookArgs.serviceName, "serviceName", "maestro-controller", "Name of the Service of the controller.")
+	webhookCmd.Flags().StringVar(&webhookArgs.serviceNamespace, "serviceNamespace", "maestro", "Namespace of the Service of the controller.")
+	webhookCmd.Flags().Int32Var(&webhookArgs.servicePort, "servicePort", 443, "Port of the Service of the controller.")
+	webhookCmd.Flags().StringVar(&webhookArgs.caBundleFile, "caBundleFile", "", "PEM bundle of the CA of the certificate of the controller. Left empty, to be injected, if not set.")
+	webhookCmd.Flags().StringVarP(&webhookArgs.output, "output", "o", "-", "File the configuration is written to. Written to stdout if -.")
+}
+
+func runWebhook(cmd *cobra.Command, _ []string) {
+	logger := klog.FromContext(context.Background())
+
+	if err := webhook(cmd); err != nil {
+		logger.Error(err, "Unable to generate the mutating webhook configuration")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+}
+
+func webhook(cmd *cobra.Command) error {
+	policy, err := newInjectionPolicy()
+	if err != nil {
+		return fmt.Errorf("invalid injection policy: %w", err)
+	}
+
+	name := webhookArgs.name
+	if revision := injectionPolicyArgs.revision; revision != "" && !cmd.Flags().Changed("name") {
+		name = name + "-" + revision
+	}
+
+	clientConfig := admissionregistrationv1.WebhookClientConfig{
+		Service: &admissionregistrationv1.ServiceReference{
+			Name:      webhookArgs.serviceName,
+			Namespace: webhookArgs.serviceNamespace,
+			Path:      ptr.To("/mutate"),
+			Port:      ptr.To(webhookArgs.servicePort),
+		},
+	}
+	if webhookArgs.caBundleFile != "" {
+		if clientConfig.CABundle, err = os.ReadFile(webhookArgs.caBundleFile); err != nil {
+			return err
+		}
+	}
+
+	out := os.Stdout
+	if webhookArgs.output != "-" {
+		if out, err = os.Create(webhookArgs.output); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+
+	data, err := yaml.Marshal(mutatingWebhookConfiguration(name, webhookArgs.webhookName, policy, clientConfig))
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// mutatingWebhookConfiguration returns the configuration of the webhooks injecting the pods
+// selected by the policy.
+func mutatingWebhookConfiguration(name string, webhookName string, policy *injection.Policy, clientConfig admissionregistrationv1.WebhookClientConfig) *admissionregistrationv1.MutatingWebhookConfiguration {
+	return &admissionregistrationv1.MutatingWebhookConfiguration{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: admissionregistrationv1.SchemeGroupVersion.String(),
+			Kind:       "MutatingWebhookConfiguration",
+		},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Webhooks:   policy.MutatingWebhooks(webhookName, clientConfig),
+	}
+}
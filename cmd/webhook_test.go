@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/bpalermo/maestro/pkg/injection"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+)
+
+func TestMutatingWebhookConfiguration(t *testing.T) {
+	clientConfig := admissionregistrationv1.WebhookClientConfig{CABundle: []byte("ca")}
+
+	policy := injection.DefaultPolicy()
+	policy.Revision = "canary"
+	policy.InjectWorkloads = true
+
+	configuration := mutatingWebhookConfiguration("maestro-sidecar-injector-canary", "sidecar.maestro.io", policy, clientConfig)
+	assert.Equal(t, "MutatingWebhookConfiguration", configuration.Kind)
+	assert.Equal(t, "maestro-sidecar-injector-canary", configuration.Name)
+	require.Len(t, configuration.Webhooks, 4)
+
+	var names []string
+	for _, webhook := range configuration.Webhooks {
+		names = append(names, webhook.Name)
+		assert.Equal(t, clientConfig, webhook.ClientConfig)
+	}
+	assert.Equal(t, []string{
+		"rev.namespace.sidecar.maestro.io",
+		"rev.object.sidecar.maestro.io",
+		"namespace.sidecar.maestro.io",
+		"workload.sidecar.maestro.io",
+	}, names)
+}
@@ -4,8 +4,52 @@ const (
 	maestroNamespace = "maestro.io"
 	sidecarNamespace = "sidecar." + maestroNamespace
 
-	ServiceName = maestroNamespace + "/serviceName"
+	// ProxyConfig is the name of the ProxyConfig of a pod. Defaults to the service account name of the pod.
+	ProxyConfig = maestroNamespace + "/proxyConfig"
+	// ConfigHash is the hash of the proxy bootstrap a pod is started with. Set on the pod template
+	// of a workload, it restarts the pods of the workload when the bootstrap changes.
+	ConfigHash = maestroNamespace + "/config-hash"
+	// Rollout disables the restart of a workload when the bootstrap of its proxies changes, if set
+	// to false on the workload.
+	Rollout = maestroNamespace + "/rollout"
 
 	SidecarInject = sidecarNamespace + "/inject"
+	// SidecarStatus is the JSON document recording the sidecars injected in a pod, the hash of their
+	// rendered template and the injecting revision.
 	SidecarStatus = sidecarNamespace + "/status"
+
+	// SidecarProxyImage overrides the image of the injected proxy.
+	SidecarProxyImage = sidecarNamespace + "/proxyImage"
+	// SidecarOPAImage overrides the image of the injected OPA sidecar.
+	SidecarOPAImage = sidecarNamespace + "/opaImage"
+	// SidecarLogLevel overrides the log level of the injected proxy.
+	SidecarLogLevel = sidecarNamespace + "/logLevel"
+	// SidecarConcurrency overrides the number of worker threads of the injected proxy.
+	SidecarConcurrency = sidecarNamespace + "/concurrency"
+	// SidecarProxyCPU overrides the CPU request of the injected proxy.
+	SidecarProxyCPU = sidecarNamespace + "/proxyCPU"
+	// SidecarProxyCPULimit overrides the CPU limit of the injected proxy.
+	SidecarProxyCPULimit = sidecarNamespace + "/proxyCPULimit"
+	// SidecarProxyMemory overrides the memory request of the injected proxy.
+	SidecarProxyMemory = sidecarNamespace + "/proxyMemory"
+	// SidecarProxyMemoryLimit overrides the memory limit of the injected proxy.
+	SidecarProxyMemoryLimit = sidecarNamespace + "/proxyMemoryLimit"
+
+	// SidecarRewriteProbes enables or disables the rewrite of the HTTP probes of the application,
+	// enabled by default when a SPIRE trust domain is configured and always for pods intercepting
+	// traffic.
+	SidecarRewriteProbes = sidecarNamespace + "/rewriteProbes"
+	// SidecarOriginalProbes records the HTTP probes of the application rewritten at injection.
+	SidecarOriginalProbes = sidecarNamespace + "/originalProbes"
+
+	// SidecarInterceptTraffic enables the redirection of the pod traffic to the injected proxy. The
+	// initImage sidecar value must be set to an image shipping iptables-restore. The HTTP probes of
+	// intercepting pods are always rewritten, the ports of their other probes must be excluded.
+	SidecarInterceptTraffic = sidecarNamespace + "/interceptTraffic"
+	// SidecarExcludeInboundPorts are comma-separated inbound ports that are not redirected to the proxy.
+	SidecarExcludeInboundPorts = sidecarNamespace + "/excludeInboundPorts"
+	// SidecarExcludeOutboundPorts are comma-separated outbound ports that are not redirected to the proxy.
+	SidecarExcludeOutboundPorts = sidecarNamespace + "/excludeOutboundPorts"
+	// SidecarExcludeOutboundIPRanges are comma-separated IPv4 ranges outbound traffic to is not redirected to the proxy.
+	SidecarExcludeOutboundIPRanges = sidecarNamespace + "/excludeOutboundIPRanges"
 )
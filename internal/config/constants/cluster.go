@@ -3,7 +3,12 @@ package constants
 import "github.com/bpalermo/maestro/internal/types"
 
 const (
-	ClusterNameLocalXDS   types.ClusterName = "local_xds"
-	ClusterNameLocalSpire types.ClusterName = "local_spire"
-	ClusterNameLocalOPA   types.ClusterName = "local_opa"
+	ClusterNameLocalXDS    types.ClusterName = "local_xds"
+	ClusterNameLocalSpire  types.ClusterName = "local_spire"
+	ClusterNameLocalOPA    types.ClusterName = "local_opa"
+	ClusterNameRateLimit   types.ClusterName = "maestro_ratelimit"
+	ClusterNameAccessLog   types.ClusterName = "maestro_als"
+	ClusterNameTracing     types.ClusterName = "otel_collector"
+	ClusterNamePassthrough types.ClusterName = "passthrough"
+	ClusterNameAppProbe    types.ClusterName = "app_probe"
 )
@@ -0,0 +1,62 @@
+package constants
+
+const (
+	// ProxyConfigMapPrefix is the default prefix of the ConfigMaps holding the proxy bootstrap.
+	ProxyConfigMapPrefix = "proxy-config-"
+
+	// ProxyBootstrapKey is the ConfigMap key holding the proxy bootstrap.
+	ProxyBootstrapKey = "envoy.yaml"
+
+	// ProxyBootstrapJSONKey is the ConfigMap key holding the proxy bootstrap rendered as JSON.
+	ProxyBootstrapJSONKey = "envoy.json"
+
+	// ProxyBootstrapChecksumKey is the ConfigMap key holding the SHA-256 checksum of the proxy
+	// bootstrap, in the sha256sum format.
+	ProxyBootstrapChecksumKey = "envoy.sha256"
+
+	// ProxyOutboundBootstrapKey is the ConfigMap key holding the bootstrap of the outbound
+	// listener, merged by the injector into the bootstrap of the pods intercepting their traffic.
+	ProxyOutboundBootstrapKey = "outbound.yaml"
+
+	// ProxyConfigDir is the directory the proxy bootstrap is mounted at.
+	ProxyConfigDir = "/etc/envoy"
+)
+
+const (
+	// ProxyAdminPort is the port of the proxy admin interface.
+	ProxyAdminPort = 9901
+
+	// ProxyInboundPort is the port of the proxy inbound HTTP listener.
+	ProxyInboundPort = 18080
+
+	// ProxyOutboundPort is the port of the proxy listener receiving the intercepted outbound traffic.
+	ProxyOutboundPort = 15001
+
+	// ProxyProbePort is the port of the proxy listener serving the rewritten probes of the application.
+	ProxyProbePort = 15020
+
+	// ProxyUID is the user the proxy runs as.
+	ProxyUID = 65532
+)
+
+// ProxyContainerName is the name of the proxy container of the sidecar template.
+const ProxyContainerName = "proxy"
+
+// ProbePathPrefix is the prefix of the paths the HTTP probes of the application are rewritten to.
+const ProbePathPrefix = "/maestro/probes/"
+
+const (
+	// ProxyAuthzPolicyKey is the ConfigMap key holding the name of the ConfigMap of the OPA policies
+	// of the proxy, when its ProxyConfig enables authorization.
+	ProxyAuthzPolicyKey = "authz-policy-configmap"
+
+	// OPAGrpcPort is the local port of the OPA Envoy external authorization gRPC server.
+	OPAGrpcPort = 9191
+
+	// OPAPolicyDir is the directory the OPA policies are mounted at.
+	OPAPolicyDir = "/run/opa/policy"
+)
+
+// SpireAgentSocketPath is the path of the SPIRE agent socket in the proxy container, serving the
+// workload API and the SDS API.
+const SpireAgentSocketPath = "/spiffe-workload-api/spire-agent.sock"
@@ -0,0 +1,25 @@
+package label
+
+const (
+	maestroNamespace = "maestro.io"
+
+	// Environment is the environment of the workloads of a namespace.
+	Environment = maestroNamespace + "/environment"
+
+	// AllowFaultInjection allows ProxyConfigs of a production namespace to inject faults when set to "true".
+	AllowFaultInjection = maestroNamespace + "/allow-fault-injection"
+
+	// Injection enables the sidecar injection of the pods of a namespace when set to "enabled",
+	// and disables it for a pod when set to "disabled".
+	Injection = maestroNamespace + "/injection"
+
+	// Revision is the revision of maestro injecting the pods of a namespace, or a pod.
+	Revision = maestroNamespace + "/rev"
+)
+
+const (
+	EnvironmentProduction = "production"
+
+	InjectionEnabled  = "enabled"
+	InjectionDisabled = "disabled"
+)
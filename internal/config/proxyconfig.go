@@ -0,0 +1,58 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"slices"
+
+	"github.com/bpalermo/maestro/internal/config/annotation"
+	"github.com/bpalermo/maestro/internal/config/constants"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	defaultServiceAccountName = "default"
+
+	// configHashLength is the number of hexadecimal characters of the proxy configuration hash
+	configHashLength = 16
+)
+
+// ProxyConfigName returns the name of the ProxyConfig applying to a pod: the one set by
+// annotation if any, otherwise the one named after the service account of the pod.
+func ProxyConfigName(pod *corev1.Pod) string {
+	if name := pod.Annotations[annotation.ProxyConfig]; name != "" {
+		return name
+	}
+	if pod.Spec.ServiceAccountName != "" {
+		return pod.Spec.ServiceAccountName
+	}
+	return defaultServiceAccountName
+}
+
+// ProxyConfigMapName returns the name of the ConfigMap holding the bootstrap generated for a ProxyConfig.
+func ProxyConfigMapName(prefix string, proxyConfigName string) string {
+	return prefix + proxyConfigName
+}
+
+// ProxyBootstrapKey returns the key of the bootstrap in the data of a proxy ConfigMap. The YAML
+// bootstrap is expected in ConfigMaps not generated yet.
+func ProxyBootstrapKey(data map[string]string) string {
+	if _, ok := data[constants.ProxyBootstrapJSONKey]; ok {
+		return constants.ProxyBootstrapJSONKey
+	}
+	return constants.ProxyBootstrapKey
+}
+
+// ProxyConfigHash returns a short hash of the data of a proxy ConfigMap, identifying the
+// bootstrap proxies are started with.
+func ProxyConfigHash(data map[string]string) string {
+	hash := sha256.New()
+	for _, key := range slices.Sorted(maps.Keys(data)) {
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+		hash.Write([]byte(data[key]))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:configHashLength]
+}
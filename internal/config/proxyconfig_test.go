@@ -0,0 +1,54 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/bpalermo/maestro/internal/config/annotation"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestProxyConfigName(t *testing.T) {
+	tests := []struct {
+		name     string
+		pod      *corev1.Pod
+		expected string
+	}{
+		{
+			name: "annotation takes precedence",
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{annotation.ProxyConfig: "orders"},
+				},
+				Spec: corev1.PodSpec{ServiceAccountName: "orders-sa"},
+			},
+			expected: "orders",
+		},
+		{
+			name: "service account",
+			pod: &corev1.Pod{
+				Spec: corev1.PodSpec{ServiceAccountName: "orders-sa"},
+			},
+			expected: "orders-sa",
+		},
+		{
+			name:     "default service account",
+			pod:      &corev1.Pod{},
+			expected: "default",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ProxyConfigName(tt.pod))
+		})
+	}
+}
+
+func TestProxyConfigHash(t *testing.T) {
+	hash := ProxyConfigHash(map[string]string{"envoy.yaml": "a", "authz-policy-configmap": "b"})
+	assert.Len(t, hash, configHashLength)
+	assert.Equal(t, hash, ProxyConfigHash(map[string]string{"authz-policy-configmap": "b", "envoy.yaml": "a"}))
+	assert.NotEqual(t, hash, ProxyConfigHash(map[string]string{"envoy.yaml": "ab"}))
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// sidecarStatusInjected is the status annotation set by the first maestro releases, before
+	// the status recorded what was injected.
+	sidecarStatusInjected = "injected"
+
+	// sidecarStatusRevisionSeparator separates the legacy status from the revision of the injecting maestro
+	sidecarStatusRevisionSeparator = ":"
+
+	// templateHashLength is the number of hexadecimal characters of the template hash kept in the status
+	templateHashLength = 16
+)
+
+// SidecarStatus records what was injected in a pod, so that the injection can be compared with
+// the current template and reverted.
+type SidecarStatus struct {
+	InitContainers []string `json:"initContainers,omitempty"`
+	Containers     []string `json:"containers,omitempty"`
+	Volumes        []string `json:"volumes,omitempty"`
+	// TemplateHash is the hash of the rendered sidecar configuration. It is empty for pods
+	// injected before the status was recorded.
+	TemplateHash string `json:"templateHash,omitempty"`
+	Revision     string `json:"revision,omitempty"`
+}
+
+// OriginalProbes are the HTTP probes of the application rewritten at injection, by container
+// name and probe field.
+type OriginalProbes map[string]map[string]*corev1.HTTPGetAction
+
+// NewSidecarStatus returns the status of a pod injected with the given sidecar configuration.
+func NewSidecarStatus(sidecarConfig *SidecarConfig, revision string) (*SidecarStatus, error) {
+	hash, err := sidecarConfig.Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &SidecarStatus{
+		TemplateHash: hash,
+		Revision:     revision,
+	}
+	for _, container := range sidecarConfig.InitContainers {
+		status.InitContainers = append(status.InitContainers, container.Name)
+	}
+	for _, container := range sidecarConfig.Containers {
+		status.Containers = append(status.Containers, container.Name)
+	}
+	for _, volume := range sidecarConfig.Volumes {
+		status.Volumes = append(status.Volumes, volume.Name)
+	}
+	return status, nil
+}
+
+// ParseSidecarStatus parses the status annotation of a pod. It returns nil when the pod is not
+// injected. The legacy string status is parsed into a status without template hash.
+func ParseSidecarStatus(value string) (*SidecarStatus, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(strings.TrimSpace(value), "{") {
+		state, revision, _ := strings.Cut(value, sidecarStatusRevisionSeparator)
+		if !strings.EqualFold(state, sidecarStatusInjected) {
+			return nil, nil
+		}
+		return &SidecarStatus{Revision: revision}, nil
+	}
+
+	status := &SidecarStatus{}
+	if err := json.Unmarshal([]byte(value), status); err != nil {
+		return nil, fmt.Errorf("invalid sidecar status: %w", err)
+	}
+	return status, nil
+}
+
+// Legacy is whether the status was set by a maestro not recording what was injected.
+func (s *SidecarStatus) Legacy() bool {
+	return s.TemplateHash == ""
+}
+
+// String returns the status annotation value.
+func (s *SidecarStatus) String() string {
+	out, err := json.Marshal(s)
+	if err != nil {
+		// a struct of strings always marshals
+		panic(err)
+	}
+	return string(out)
+}
+
+// Hash returns a short hash identifying the rendered sidecar configuration.
+func (s *SidecarConfig) Hash() (string, error) {
+	out, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("unable to hash sidecar configuration: %w", err)
+	}
+	sum := sha256.Sum256(out)
+	return hex.EncodeToString(sum[:])[:templateHashLength], nil
+}
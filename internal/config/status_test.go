@@ -0,0 +1,65 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParseSidecarStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		expected *SidecarStatus
+		wantErr  bool
+	}{
+		{
+			name:     "json",
+			status:   `{"containers":["maestro-proxy"],"volumes":["envoy-config"],"templateHash":"0123456789abcdef","revision":"canary"}`,
+			expected: &SidecarStatus{Containers: []string{"maestro-proxy"}, Volumes: []string{"envoy-config"}, TemplateHash: "0123456789abcdef", Revision: "canary"},
+		},
+		{name: "legacy", status: "injected", expected: &SidecarStatus{}},
+		{name: "legacy revision", status: "Injected:canary", expected: &SidecarStatus{Revision: "canary"}},
+		{name: "not injected", status: "pending"},
+		{name: "empty", status: ""},
+		{name: "invalid", status: "{", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, err := ParseSidecarStatus(tt.status)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, status)
+		})
+	}
+}
+
+func TestNewSidecarStatus(t *testing.T) {
+	always := corev1.ContainerRestartPolicyAlways
+	sidecarConfig := &SidecarConfig{
+		InitContainers: []corev1.Container{{Name: "maestro-init"}, {Name: "maestro-proxy", RestartPolicy: &always}},
+		Volumes:        []corev1.Volume{{Name: "envoy-config"}},
+	}
+
+	status, err := NewSidecarStatus(sidecarConfig, "canary")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"maestro-init", "maestro-proxy"}, status.InitContainers)
+	assert.Empty(t, status.Containers)
+	assert.Equal(t, []string{"envoy-config"}, status.Volumes)
+	assert.Len(t, status.TemplateHash, templateHashLength)
+	assert.False(t, status.Legacy())
+
+	parsed, err := ParseSidecarStatus(status.String())
+	require.NoError(t, err)
+	assert.Equal(t, status, parsed)
+
+	other, err := NewSidecarStatus(sidecarConfig.WithoutNativeSidecars(), "canary")
+	require.NoError(t, err)
+	assert.NotEqual(t, status.TemplateHash, other.TemplateHash)
+}
@@ -0,0 +1,299 @@
+package config
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/bpalermo/maestro/internal/config/annotation"
+	"github.com/bpalermo/maestro/internal/config/constants"
+	"github.com/bpalermo/maestro/internal/iptables"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// SidecarTemplateKey is the ConfigMap key holding the sidecar template.
+	SidecarTemplateKey = "template"
+	// SidecarValuesKey is the ConfigMap key holding the default sidecar values, in YAML.
+	SidecarValuesKey = "values"
+)
+
+var (
+	//go:embed sidecar.yaml.tmpl
+	defaultSidecarTemplate string
+
+	// proxyLogLevels are the log levels accepted by the proxy
+	proxyLogLevels = map[string]bool{
+		"trace":    true,
+		"debug":    true,
+		"info":     true,
+		"warning":  true,
+		"warn":     true,
+		"error":    true,
+		"critical": true,
+		"off":      true,
+	}
+
+	templateFuncs = template.FuncMap{
+		"quote":  quote,
+		"toYaml": toYaml,
+		"indent": indent,
+	}
+)
+
+// SidecarValues are the values of the sidecar template that pods can override by annotation.
+type SidecarValues struct {
+	Image           string                      `json:"image"`
+	ImagePullPolicy corev1.PullPolicy           `json:"imagePullPolicy"`
+	LogLevel        string                      `json:"logLevel"`
+	Concurrency     int                         `json:"concurrency"`
+	Resources       corev1.ResourceRequirements `json:"resources"`
+
+	// InterceptTraffic injects an init container redirecting the traffic of the pod to the proxy.
+	InterceptTraffic bool `json:"interceptTraffic"`
+	// InitImage is the maestro image of the traffic interception init container. It must ship
+	// iptables-restore, which the maestro image built on distroless does not, so it has no default
+	// and must be set to intercept traffic.
+	InitImage               string `json:"initImage"`
+	ExcludeInboundPorts     string `json:"excludeInboundPorts"`
+	ExcludeOutboundPorts    string `json:"excludeOutboundPorts"`
+	ExcludeOutboundIPRanges string `json:"excludeOutboundIPRanges"`
+
+	// OPAImage is the image of the OPA sidecar injected when the ProxyConfig enables authorization.
+	OPAImage string `json:"opaImage"`
+}
+
+// DefaultSidecarValues returns the values used when the ConfigMap does not set them.
+func DefaultSidecarValues() SidecarValues {
+	return SidecarValues{
+		Image:           "envoyproxy/envoy:v1.32.4",
+		ImagePullPolicy: corev1.PullAlways,
+		LogLevel:        "warn",
+		OPAImage:        "openpolicyagent/opa:1.0.0-envoy",
+	}
+}
+
+// SidecarTemplateData is the data the sidecar template is executed with.
+type SidecarTemplateData struct {
+	Pod                *corev1.Pod
+	Values             SidecarValues
+	ProxyConfigMapName string
+	ProxyConfigDir     string
+	ProxyConfigPath    string
+	SpiffeCsiDriver    string
+	ProxyUID           int64
+	ProxyAdminPort     int
+	ProxyInboundPort   int
+	ProxyOutboundPort  int
+	ProxyProbePort     int
+	// AuthzPolicyConfigMap is the ConfigMap of the OPA policies, empty when no OPA sidecar is injected.
+	AuthzPolicyConfigMap string
+	OPAGrpcPort          int
+	OPAPolicyDir         string
+}
+
+// SidecarTemplate renders the containers and volumes injected in pods.
+type SidecarTemplate struct {
+	template *template.Template
+	values   SidecarValues
+}
+
+// NewSidecarTemplate parses a sidecar template rendered with the given default values.
+func NewSidecarTemplate(text string, values SidecarValues) (*SidecarTemplate, error) {
+	tmpl, err := template.New("sidecar").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sidecar template: %w", err)
+	}
+
+	return &SidecarTemplate{
+		template: tmpl,
+		values:   values,
+	}, nil
+}
+
+// DefaultSidecarTemplate returns the template built into maestro.
+func DefaultSidecarTemplate() *SidecarTemplate {
+	tmpl, err := NewSidecarTemplate(defaultSidecarTemplate, DefaultSidecarValues())
+	if err != nil {
+		panic(err)
+	}
+	return tmpl
+}
+
+// ParseSidecarTemplate parses the sidecar template from the data of a ConfigMap. Missing keys
+// fall back to the built-in template and default values.
+func ParseSidecarTemplate(data map[string]string) (*SidecarTemplate, error) {
+	text, ok := data[SidecarTemplateKey]
+	if !ok {
+		text = defaultSidecarTemplate
+	}
+
+	values := DefaultSidecarValues()
+	if raw, ok := data[SidecarValuesKey]; ok {
+		if err := yaml.UnmarshalStrict([]byte(raw), &values); err != nil {
+			return nil, fmt.Errorf("invalid sidecar values: %w", err)
+		}
+	}
+
+	return NewSidecarTemplate(text, values)
+}
+
+// Values returns the default values of the template.
+func (t *SidecarTemplate) Values() SidecarValues {
+	return t.values
+}
+
+// Render renders the sidecar configuration of a pod, mounting the proxy bootstrap from the
+// given ConfigMap, whose data selects the bootstrap file and the ConfigMap of the OPA policies,
+// if any. The values of the template are overridden by the annotations of the pod.
+func (t *SidecarTemplate) Render(pod *corev1.Pod, configMapName string, proxyConfigData map[string]string) (*SidecarConfig, error) {
+	values, err := t.values.WithOverrides(pod.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	if values.InterceptTraffic && values.InitImage == "" {
+		return nil, fmt.Errorf("traffic interception requires the %s value initImage, a maestro image shipping iptables-restore", SidecarValuesKey)
+	}
+
+	data := SidecarTemplateData{
+		Pod:                pod,
+		Values:             values,
+		ProxyConfigMapName: configMapName,
+		ProxyConfigDir:     constants.ProxyConfigDir,
+		ProxyConfigPath:    path.Join(constants.ProxyConfigDir, ProxyBootstrapKey(proxyConfigData)),
+		SpiffeCsiDriver:    constants.SpiffeCsiDriver,
+		ProxyUID:           constants.ProxyUID,
+		ProxyAdminPort:     constants.ProxyAdminPort,
+		ProxyInboundPort:   constants.ProxyInboundPort,
+		ProxyOutboundPort:  constants.ProxyOutboundPort,
+		ProxyProbePort:     constants.ProxyProbePort,
+
+		AuthzPolicyConfigMap: proxyConfigData[constants.ProxyAuthzPolicyKey],
+		OPAGrpcPort:          constants.OPAGrpcPort,
+		OPAPolicyDir:         constants.OPAPolicyDir,
+	}
+
+	var buf bytes.Buffer
+	if err := t.template.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("unable to render sidecar template: %w", err)
+	}
+
+	sidecarConfig := &SidecarConfig{}
+	if err := yaml.UnmarshalStrict(buf.Bytes(), sidecarConfig); err != nil {
+		return nil, fmt.Errorf("rendered sidecar template is invalid: %w", err)
+	}
+
+	return sidecarConfig, nil
+}
+
+// WithOverrides returns a copy of the values overridden by the sidecar annotations of a pod.
+func (v SidecarValues) WithOverrides(annotations map[string]string) (SidecarValues, error) {
+	out := v
+	out.Resources = *v.Resources.DeepCopy()
+
+	if image, ok := annotations[annotation.SidecarProxyImage]; ok {
+		if image == "" {
+			return out, fmt.Errorf("annotation %s cannot be empty", annotation.SidecarProxyImage)
+		}
+		out.Image = image
+	}
+
+	if image, ok := annotations[annotation.SidecarOPAImage]; ok {
+		if image == "" {
+			return out, fmt.Errorf("annotation %s cannot be empty", annotation.SidecarOPAImage)
+		}
+		out.OPAImage = image
+	}
+
+	if logLevel, ok := annotations[annotation.SidecarLogLevel]; ok {
+		if !proxyLogLevels[logLevel] {
+			return out, fmt.Errorf("annotation %s has an invalid log level %q", annotation.SidecarLogLevel, logLevel)
+		}
+		out.LogLevel = logLevel
+	}
+
+	if concurrency, ok := annotations[annotation.SidecarConcurrency]; ok {
+		n, err := strconv.Atoi(concurrency)
+		if err != nil || n < 0 {
+			return out, fmt.Errorf("annotation %s must be a non-negative integer, got %q", annotation.SidecarConcurrency, concurrency)
+		}
+		out.Concurrency = n
+	}
+
+	if intercept, ok := annotations[annotation.SidecarInterceptTraffic]; ok {
+		enabled, err := strconv.ParseBool(intercept)
+		if err != nil {
+			return out, fmt.Errorf("annotation %s must be a boolean, got %q", annotation.SidecarInterceptTraffic, intercept)
+		}
+		out.InterceptTraffic = enabled
+	}
+
+	for key, field := range map[string]*string{
+		annotation.SidecarExcludeInboundPorts:  &out.ExcludeInboundPorts,
+		annotation.SidecarExcludeOutboundPorts: &out.ExcludeOutboundPorts,
+	} {
+		if value, ok := annotations[key]; ok {
+			if _, err := iptables.ParsePorts(value); err != nil {
+				return out, fmt.Errorf("annotation %s is invalid: %w", key, err)
+			}
+			*field = value
+		}
+	}
+
+	if ranges, ok := annotations[annotation.SidecarExcludeOutboundIPRanges]; ok {
+		if _, err := iptables.ParseCIDRs(ranges); err != nil {
+			return out, fmt.Errorf("annotation %s is invalid: %w", annotation.SidecarExcludeOutboundIPRanges, err)
+		}
+		out.ExcludeOutboundIPRanges = ranges
+	}
+
+	for key, override := range map[string]struct {
+		list *corev1.ResourceList
+		name corev1.ResourceName
+	}{
+		annotation.SidecarProxyCPU:         {&out.Resources.Requests, corev1.ResourceCPU},
+		annotation.SidecarProxyCPULimit:    {&out.Resources.Limits, corev1.ResourceCPU},
+		annotation.SidecarProxyMemory:      {&out.Resources.Requests, corev1.ResourceMemory},
+		annotation.SidecarProxyMemoryLimit: {&out.Resources.Limits, corev1.ResourceMemory},
+	} {
+		value, ok := annotations[key]
+		if !ok {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return out, fmt.Errorf("annotation %s has an invalid quantity %q: %w", key, value, err)
+		}
+		if *override.list == nil {
+			*override.list = corev1.ResourceList{}
+		}
+		(*override.list)[override.name] = quantity
+	}
+
+	return out, nil
+}
+
+// quote returns the value as a double-quoted YAML scalar, so that values set by annotation
+// cannot alter the structure of the rendered template.
+func quote(value any) string {
+	return strconv.Quote(fmt.Sprint(value))
+}
+
+func toYaml(value any) (string, error) {
+	out, err := yaml.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func indent(spaces int, text string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(text, "\n", "\n"+pad)
+}
@@ -0,0 +1,258 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bpalermo/maestro/internal/config/annotation"
+	"github.com/bpalermo/maestro/internal/config/constants"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSidecarTemplate_Render(t *testing.T) {
+	tests := []struct {
+		name                string
+		annotations         map[string]string
+		expectedImage       string
+		expectedArgs        []string
+		expectedRequests    corev1.ResourceList
+		expectedLimits      corev1.ResourceList
+		expectedErrorSubstr string
+	}{
+		{
+			name:          "default values",
+			expectedImage: "envoyproxy/envoy:v1.32.4",
+			expectedArgs: []string{
+				"--service-cluster", "$(SERVICE_CLUSTER)",
+				"--service-node", "$(SERVICE_NODE)",
+				"--config-path", "/etc/envoy/envoy.yaml",
+				"--log-level", "warn",
+			},
+		},
+		{
+			name: "annotation overrides",
+			annotations: map[string]string{
+				annotation.SidecarProxyImage:       "envoyproxy/envoy:v1.33.0",
+				annotation.SidecarLogLevel:         "debug",
+				annotation.SidecarConcurrency:      "2",
+				annotation.SidecarProxyCPU:         "100m",
+				annotation.SidecarProxyMemory:      "64Mi",
+				annotation.SidecarProxyMemoryLimit: "128Mi",
+			},
+			expectedImage: "envoyproxy/envoy:v1.33.0",
+			expectedArgs: []string{
+				"--service-cluster", "$(SERVICE_CLUSTER)",
+				"--service-node", "$(SERVICE_NODE)",
+				"--config-path", "/etc/envoy/envoy.yaml",
+				"--log-level", "debug",
+				"--concurrency", "2",
+			},
+			expectedRequests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("100m"),
+				corev1.ResourceMemory: resource.MustParse("64Mi"),
+			},
+			expectedLimits: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("128Mi"),
+			},
+		},
+		{
+			name:                "invalid log level",
+			annotations:         map[string]string{annotation.SidecarLogLevel: "verbose"},
+			expectedErrorSubstr: "invalid log level",
+		},
+		{
+			name:                "invalid concurrency",
+			annotations:         map[string]string{annotation.SidecarConcurrency: "-1"},
+			expectedErrorSubstr: "non-negative integer",
+		},
+		{
+			name:                "invalid quantity",
+			annotations:         map[string]string{annotation.SidecarProxyCPULimit: "lots"},
+			expectedErrorSubstr: "invalid quantity",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+
+			sidecarConfig, err := DefaultSidecarTemplate().Render(pod, "proxy-config-test", nil)
+			if tt.expectedErrorSubstr != "" {
+				assert.ErrorContains(t, err, tt.expectedErrorSubstr)
+				return
+			}
+			require.NoError(t, err)
+
+			require.Len(t, sidecarConfig.InitContainers, 1)
+			proxy := sidecarConfig.InitContainers[0]
+			assert.Equal(t, tt.expectedImage, proxy.Image)
+			assert.Equal(t, tt.expectedArgs, proxy.Args)
+			assert.True(t, tt.expectedRequests.Cpu().Equal(*proxy.Resources.Requests.Cpu()))
+			assert.True(t, tt.expectedRequests.Memory().Equal(*proxy.Resources.Requests.Memory()))
+			assert.True(t, tt.expectedLimits.Memory().Equal(*proxy.Resources.Limits.Memory()))
+
+			require.Len(t, sidecarConfig.Volumes, 2)
+			assert.Equal(t, "proxy-config-test", sidecarConfig.Volumes[0].ConfigMap.Name)
+		})
+	}
+}
+
+func TestParseSidecarTemplate(t *testing.T) {
+	tests := []struct {
+		name                string
+		data                map[string]string
+		expectedImage       string
+		expectedErrorSubstr string
+	}{
+		{
+			name:          "values only",
+			data:          map[string]string{SidecarValuesKey: "image: envoyproxy/envoy:v1.34.0\n"},
+			expectedImage: "envoyproxy/envoy:v1.34.0",
+		},
+		{
+			name: "custom template",
+			data: map[string]string{
+				SidecarTemplateKey: "containers:\n  - name: proxy\n    image: {{ .Values.Image | quote }}\n",
+				SidecarValuesKey:   "image: registry.local/envoy:latest\n",
+			},
+			expectedImage: "registry.local/envoy:latest",
+		},
+		{
+			name:                "unknown value",
+			data:                map[string]string{SidecarValuesKey: "tag: v1.34.0\n"},
+			expectedErrorSubstr: "invalid sidecar values",
+		},
+		{
+			name:                "invalid template",
+			data:                map[string]string{SidecarTemplateKey: "{{ .Values.Image "},
+			expectedErrorSubstr: "invalid sidecar template",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseSidecarTemplate(tt.data)
+			if tt.expectedErrorSubstr != "" {
+				assert.ErrorContains(t, err, tt.expectedErrorSubstr)
+				return
+			}
+			require.NoError(t, err)
+
+			sidecarConfig, err := tmpl.Render(&corev1.Pod{}, "proxy-config-test", nil)
+			require.NoError(t, err)
+
+			containers := append(sidecarConfig.InitContainers, sidecarConfig.Containers...)
+			require.NotEmpty(t, containers)
+			assert.Equal(t, tt.expectedImage, containers[0].Image)
+		})
+	}
+}
+
+func TestSidecarTemplate_RenderInterception(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		annotation.SidecarInterceptTraffic:        "true",
+		annotation.SidecarExcludeOutboundPorts:    "5432",
+		annotation.SidecarExcludeOutboundIPRanges: "10.96.0.0/12",
+	}}}
+
+	_, err := DefaultSidecarTemplate().Render(pod, "proxy-config-test", nil)
+	assert.ErrorContains(t, err, "initImage", "the default maestro image does not ship iptables")
+
+	values := DefaultSidecarValues()
+	values.InitImage = "example.com/maestro-init:v1"
+	tmpl, err := NewSidecarTemplate(defaultSidecarTemplate, values)
+	require.NoError(t, err)
+
+	sidecarConfig, err := tmpl.Render(pod, "proxy-config-test", nil)
+	require.NoError(t, err)
+
+	require.Len(t, sidecarConfig.InitContainers, 2)
+	init := sidecarConfig.InitContainers[0]
+	assert.Equal(t, "maestro-init", init.Name)
+	assert.Equal(t, "example.com/maestro-init:v1", init.Image)
+	assert.Nil(t, init.RestartPolicy)
+	assert.Equal(t, []string{
+		"iptables",
+		"--proxyUID", "65532",
+		"--inboundPort", "18080",
+		"--outboundPort", "15001",
+		"--excludeInboundPorts", "",
+		"--excludeOutboundPorts", "5432",
+		"--excludeOutboundCIDRs", "10.96.0.0/12",
+	}, init.Args)
+	assert.Equal(t, []corev1.Capability{"NET_ADMIN", "NET_RAW"}, init.SecurityContext.Capabilities.Add)
+	// iptables-restore creates its lock in /run, which is writable on the read-only root filesystem
+	require.True(t, *init.SecurityContext.ReadOnlyRootFilesystem)
+	assert.Equal(t, []corev1.VolumeMount{{Name: "maestro-init-run", MountPath: "/run"}}, init.VolumeMounts)
+	var run *corev1.Volume
+	for i := range sidecarConfig.Volumes {
+		if sidecarConfig.Volumes[i].Name == "maestro-init-run" {
+			run = &sidecarConfig.Volumes[i]
+		}
+	}
+	require.NotNil(t, run, "volume maestro-init-run not found")
+	require.NotNil(t, run.EmptyDir)
+	assert.Equal(t, corev1.StorageMediumMemory, run.EmptyDir.Medium)
+	assert.Equal(t, "proxy", sidecarConfig.InitContainers[1].Name)
+
+	pod.Annotations[annotation.SidecarExcludeOutboundIPRanges] = "fd00::/8"
+	_, err = tmpl.Render(pod, "proxy-config-test", nil)
+	assert.ErrorContains(t, err, "not an IPv4 range")
+}
+
+func TestSidecarTemplate_RenderBootstrapPath(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         map[string]string
+		expectedPath string
+	}{
+		{
+			name:         "not generated",
+			expectedPath: "/etc/envoy/envoy.yaml",
+		},
+		{
+			name:         "yaml",
+			data:         map[string]string{constants.ProxyBootstrapKey: "{}"},
+			expectedPath: "/etc/envoy/envoy.yaml",
+		},
+		{
+			name:         "json",
+			data:         map[string]string{constants.ProxyBootstrapJSONKey: "{}"},
+			expectedPath: "/etc/envoy/envoy.json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sidecarConfig, err := DefaultSidecarTemplate().Render(&corev1.Pod{}, "proxy-config-test", tt.data)
+			require.NoError(t, err)
+
+			proxy := sidecarConfig.InitContainers[len(sidecarConfig.InitContainers)-1]
+			assert.Contains(t, strings.Join(proxy.Args, " "), "--config-path "+tt.expectedPath)
+		})
+	}
+}
+
+func TestSidecarTemplate_RenderAuthz(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		annotation.SidecarOPAImage: "registry.example.com/opa:1.0.0-envoy",
+	}}}
+
+	sidecarConfig, err := DefaultSidecarTemplate().Render(pod, "proxy-config-test", map[string]string{constants.ProxyAuthzPolicyKey: "authz-policy"})
+	require.NoError(t, err)
+
+	require.Len(t, sidecarConfig.InitContainers, 2)
+	opa := sidecarConfig.InitContainers[0]
+	assert.Equal(t, "opa", opa.Name)
+	assert.Equal(t, "registry.example.com/opa:1.0.0-envoy", opa.Image)
+	assert.Contains(t, opa.Args, "--set=plugins.envoy_ext_authz_grpc.addr=127.0.0.1:9191")
+	assert.Equal(t, "/run/opa/policy", opa.Args[len(opa.Args)-1])
+	assert.Equal(t, "opa-policy", opa.VolumeMounts[0].Name)
+
+	require.Len(t, sidecarConfig.Volumes, 3)
+	assert.Equal(t, "authz-policy", sidecarConfig.Volumes[2].ConfigMap.Name)
+}
@@ -0,0 +1,167 @@
+// Package iptables generates the NAT rules redirecting the traffic of a pod to its proxy.
+//
+// The rules are rendered in the iptables-restore format, accepted by both the legacy and the
+// nftables backends of iptables, so that they can be checked without installing them.
+package iptables
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+const (
+	tableNAT = "nat"
+
+	chainPrerouting = "PREROUTING"
+	chainOutput     = "OUTPUT"
+
+	// ChainInbound filters the inbound traffic redirected to the proxy.
+	ChainInbound = "MAESTRO_INBOUND"
+	// ChainInboundRedirect redirects the inbound traffic to the proxy.
+	ChainInboundRedirect = "MAESTRO_IN_REDIRECT"
+	// ChainOutbound filters the outbound traffic redirected to the proxy.
+	ChainOutbound = "MAESTRO_OUTPUT"
+	// ChainOutboundRedirect redirects the outbound traffic to the proxy.
+	ChainOutboundRedirect = "MAESTRO_REDIRECT"
+)
+
+// Config holds the settings of the generated rules.
+type Config struct {
+	// ProxyUID is the user the proxy runs as. Its traffic is never redirected.
+	ProxyUID int64
+	// InboundPort is the proxy port inbound traffic is redirected to.
+	InboundPort uint32
+	// OutboundPort is the proxy port outbound traffic is redirected to.
+	OutboundPort uint32
+	// ExcludeInboundPorts are destination ports of the inbound traffic that are not redirected.
+	ExcludeInboundPorts []uint32
+	// ExcludeOutboundPorts are destination ports of the outbound traffic that are not redirected.
+	ExcludeOutboundPorts []uint32
+	// ExcludeOutboundCIDRs are destination ranges of the outbound traffic that are not redirected.
+	ExcludeOutboundCIDRs []netip.Prefix
+}
+
+// Rule is a rule appended to a chain.
+type Rule struct {
+	Chain string
+	Args  []string
+}
+
+// String returns the rule as an iptables-restore line.
+func (r Rule) String() string {
+	return strings.Join(append([]string{"-A", r.Chain}, r.Args...), " ")
+}
+
+// RuleSet is the set of chains and rules of a table.
+type RuleSet struct {
+	Table string
+	// Chains are the chains created by the rule set.
+	Chains []string
+	Rules  []Rule
+}
+
+// String returns the rule set in the iptables-restore format.
+func (s *RuleSet) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "*%s\n", s.Table)
+	for _, chain := range s.Chains {
+		fmt.Fprintf(&b, ":%s - [0:0]\n", chain)
+	}
+	for _, rule := range s.Rules {
+		b.WriteString(rule.String())
+		b.WriteString("\n")
+	}
+	b.WriteString("COMMIT\n")
+
+	return b.String()
+}
+
+// Generate returns the NAT rules redirecting inbound and outbound TCP traffic to the proxy.
+// Only IPv4 ranges are supported.
+func Generate(config *Config) (*RuleSet, error) {
+	if config.InboundPort == 0 || config.OutboundPort == 0 {
+		return nil, fmt.Errorf("inbound and outbound ports are required")
+	}
+
+	set := &RuleSet{
+		Table:  tableNAT,
+		Chains: []string{ChainInbound, ChainInboundRedirect, ChainOutbound, ChainOutboundRedirect},
+	}
+	add := func(chain string, args ...string) {
+		set.Rules = append(set.Rules, Rule{Chain: chain, Args: args})
+	}
+
+	add(ChainInboundRedirect, "-p", "tcp", "-j", "REDIRECT", "--to-ports", port(config.InboundPort))
+	add(ChainOutboundRedirect, "-p", "tcp", "-j", "REDIRECT", "--to-ports", port(config.OutboundPort))
+
+	// inbound
+	add(chainPrerouting, "-p", "tcp", "-j", ChainInbound)
+	for _, p := range config.ExcludeInboundPorts {
+		add(ChainInbound, "-p", "tcp", "--dport", port(p), "-j", "RETURN")
+	}
+	add(ChainInbound, "-p", "tcp", "-j", ChainInboundRedirect)
+
+	// outbound
+	add(chainOutput, "-p", "tcp", "-j", ChainOutbound)
+	// the traffic of the proxy itself leaves the pod
+	add(ChainOutbound, "-m", "owner", "--uid-owner", strconv.FormatInt(config.ProxyUID, 10), "-j", "RETURN")
+	add(ChainOutbound, "-d", "127.0.0.1/32", "-j", "RETURN")
+	for _, p := range config.ExcludeOutboundPorts {
+		add(ChainOutbound, "-p", "tcp", "--dport", port(p), "-j", "RETURN")
+	}
+	for _, cidr := range config.ExcludeOutboundCIDRs {
+		if !cidr.Addr().Is4() {
+			return nil, fmt.Errorf("excluded range %s is not an IPv4 range", cidr)
+		}
+		add(ChainOutbound, "-d", cidr.Masked().String(), "-j", "RETURN")
+	}
+	add(ChainOutbound, "-j", ChainOutboundRedirect)
+
+	return set, nil
+}
+
+// ParsePorts parses a comma-separated list of ports.
+func ParsePorts(value string) ([]uint32, error) {
+	var ports []uint32
+	for _, field := range splitList(value) {
+		p, err := strconv.ParseUint(field, 10, 16)
+		if err != nil || p == 0 {
+			return nil, fmt.Errorf("invalid port %q", field)
+		}
+		ports = append(ports, uint32(p))
+	}
+	return ports, nil
+}
+
+// ParseCIDRs parses a comma-separated list of IPv4 ranges.
+func ParseCIDRs(value string) ([]netip.Prefix, error) {
+	var cidrs []netip.Prefix
+	for _, field := range splitList(value) {
+		cidr, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %q: %w", field, err)
+		}
+		if !cidr.Addr().Is4() {
+			return nil, fmt.Errorf("range %q is not an IPv4 range", field)
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	return cidrs, nil
+}
+
+func splitList(value string) []string {
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func port(p uint32) string {
+	return strconv.FormatUint(uint64(p), 10)
+}
@@ -0,0 +1,116 @@
+package iptables
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name                string
+		config              *Config
+		expected            string
+		expectedErrorSubstr string
+	}{
+		{
+			name: "default",
+			config: &Config{
+				ProxyUID:     65532,
+				InboundPort:  18080,
+				OutboundPort: 15001,
+			},
+			expected: `*nat
+:MAESTRO_INBOUND - [0:0]
+:MAESTRO_IN_REDIRECT - [0:0]
+:MAESTRO_OUTPUT - [0:0]
+:MAESTRO_REDIRECT - [0:0]
+-A MAESTRO_IN_REDIRECT -p tcp -j REDIRECT --to-ports 18080
+-A MAESTRO_REDIRECT -p tcp -j REDIRECT --to-ports 15001
+-A PREROUTING -p tcp -j MAESTRO_INBOUND
+-A MAESTRO_INBOUND -p tcp -j MAESTRO_IN_REDIRECT
+-A OUTPUT -p tcp -j MAESTRO_OUTPUT
+-A MAESTRO_OUTPUT -m owner --uid-owner 65532 -j RETURN
+-A MAESTRO_OUTPUT -d 127.0.0.1/32 -j RETURN
+-A MAESTRO_OUTPUT -j MAESTRO_REDIRECT
+COMMIT
+`,
+		},
+		{
+			name: "exclusions",
+			config: &Config{
+				ProxyUID:             1337,
+				InboundPort:          18080,
+				OutboundPort:         15001,
+				ExcludeInboundPorts:  []uint32{9901, 8081},
+				ExcludeOutboundPorts: []uint32{5432},
+				ExcludeOutboundCIDRs: []netip.Prefix{netip.MustParsePrefix("10.96.0.1/12")},
+			},
+			expected: `*nat
+:MAESTRO_INBOUND - [0:0]
+:MAESTRO_IN_REDIRECT - [0:0]
+:MAESTRO_OUTPUT - [0:0]
+:MAESTRO_REDIRECT - [0:0]
+-A MAESTRO_IN_REDIRECT -p tcp -j REDIRECT --to-ports 18080
+-A MAESTRO_REDIRECT -p tcp -j REDIRECT --to-ports 15001
+-A PREROUTING -p tcp -j MAESTRO_INBOUND
+-A MAESTRO_INBOUND -p tcp --dport 9901 -j RETURN
+-A MAESTRO_INBOUND -p tcp --dport 8081 -j RETURN
+-A MAESTRO_INBOUND -p tcp -j MAESTRO_IN_REDIRECT
+-A OUTPUT -p tcp -j MAESTRO_OUTPUT
+-A MAESTRO_OUTPUT -m owner --uid-owner 1337 -j RETURN
+-A MAESTRO_OUTPUT -d 127.0.0.1/32 -j RETURN
+-A MAESTRO_OUTPUT -p tcp --dport 5432 -j RETURN
+-A MAESTRO_OUTPUT -d 10.96.0.0/12 -j RETURN
+-A MAESTRO_OUTPUT -j MAESTRO_REDIRECT
+COMMIT
+`,
+		},
+		{
+			name:                "missing ports",
+			config:              &Config{ProxyUID: 65532},
+			expectedErrorSubstr: "ports are required",
+		},
+		{
+			name: "IPv6 range",
+			config: &Config{
+				InboundPort:          18080,
+				OutboundPort:         15001,
+				ExcludeOutboundCIDRs: []netip.Prefix{netip.MustParsePrefix("fd00::/8")},
+			},
+			expectedErrorSubstr: "not an IPv4 range",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := Generate(tt.config)
+			if tt.expectedErrorSubstr != "" {
+				assert.ErrorContains(t, err, tt.expectedErrorSubstr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, set.String())
+		})
+	}
+}
+
+func TestParsePorts(t *testing.T) {
+	ports, err := ParsePorts(" 8080, 9090,,")
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{8080, 9090}, ports)
+
+	_, err = ParsePorts("8080,70000")
+	assert.ErrorContains(t, err, "invalid port")
+}
+
+func TestParseCIDRs(t *testing.T) {
+	cidrs, err := ParseCIDRs("10.0.0.0/8,192.168.0.0/16")
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.168.0.0/16")}, cidrs)
+
+	_, err = ParseCIDRs("10.0.0.0")
+	assert.ErrorContains(t, err, "invalid range")
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"fmt"
+
+	configv1 "github.com/bpalermo/maestro/api/config/v1"
+	"github.com/bpalermo/maestro/internal/config/constants"
+	"github.com/bpalermo/maestro/internal/proxy/envoy"
+	accesslogv3 "github.com/envoyproxy/go-control-plane/envoy/config/accesslog/v3"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+)
+
+func generateAccessLogs(svc *configv1.Service, options *bootstrapOptions) ([]*accesslogv3.AccessLog, error) {
+	accessLogs := make([]*accesslogv3.AccessLog, 0, len(svc.GetAccessLogs()))
+	for i, accessLog := range svc.GetAccessLogs() {
+		filter := accessLogFilter(fmt.Sprintf("access_log.%d", i), accessLog.GetFilter())
+
+		var generated *accesslogv3.AccessLog
+		var err error
+		switch sink := accessLog.GetSink().(type) {
+		case *configv1.AccessLog_Stdout_:
+			generated, err = envoy.StdoutAccessLog(accessLogFormat(accessLog), filter)
+		case *configv1.AccessLog_File_:
+			generated, err = envoy.FileAccessLog(sink.File.GetPath(), accessLogFormat(accessLog), filter)
+		case *configv1.AccessLog_Grpc_:
+			// reported by IgnoredSettings
+			if options.accessLogService == nil {
+				continue
+			}
+			generated, err = envoy.GrpcAccessLog(qualifiedServiceName(options.namespace, svc), constants.ClusterNameAccessLog.ToString(), filter)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		accessLogs = append(accessLogs, generated)
+	}
+	return accessLogs, nil
+}
+
+func accessLogFilter(runtimePrefix string, filter *configv1.AccessLog_Filter) *accesslogv3.AccessLogFilter {
+	var samplePercentage *uint32
+	if filter != nil && filter.SamplePercentage != nil {
+		samplePercentage = filter.SamplePercentage
+	}
+	return envoy.AccessLogFilter(runtimePrefix, filter.GetMinStatusCode(), filter.GetMinDurationMs(), samplePercentage)
+}
+
+func accessLogFormat(accessLog *configv1.AccessLog) *corev3.SubstitutionFormatString {
+	switch accessLog.GetFormat() {
+	case configv1.AccessLog_FORMAT_JSON:
+		return envoy.JsonLogFormat(accessLog.GetJsonFormat())
+	case configv1.AccessLog_FORMAT_TEXT:
+		return envoy.TextLogFormat(accessLog.GetTextFormat())
+	default:
+		return nil
+	}
+}
+
+func grpcAccessLogEnabled(svc *configv1.Service, options *bootstrapOptions) bool {
+	if options.accessLogService == nil {
+		return false
+	}
+	for _, accessLog := range svc.GetAccessLogs() {
+		if accessLog.GetGrpc() != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"testing"
+
+	"buf.build/go/protoyaml"
+	configv1api "github.com/bpalermo/maestro/api/config/v1"
+	"github.com/bpalermo/maestro/internal/config/constants"
+	configv1 "github.com/bpalermo/maestro/pkg/apis/config/v1"
+	accesslogv3 "github.com/envoyproxy/go-control-plane/envoy/config/accesslog/v3"
+	bootstrapv3 "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
+	filev3 "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/file/v3"
+	grpcv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/grpc/v3"
+	streamv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/stream/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGenerateBootstrap_AccessLogs(t *testing.T) {
+	svc := testService()
+	svc.AccessLogs = []*configv1api.AccessLog{
+		{
+			Sink: &configv1api.AccessLog_Stdout_{Stdout: &configv1api.AccessLog_Stdout{}},
+		},
+		{
+			Sink:       &configv1api.AccessLog_Stdout_{Stdout: &configv1api.AccessLog_Stdout{}},
+			Format:     configv1api.AccessLog_FORMAT_JSON,
+			JsonFormat: map[string]string{"status": "%RESPONSE_CODE%"},
+			Filter:     &configv1api.AccessLog_Filter{MinStatusCode: 500},
+		},
+		{
+			Sink:       &configv1api.AccessLog_File_{File: &configv1api.AccessLog_File{Path: "/var/log/envoy/access.log"}},
+			Format:     configv1api.AccessLog_FORMAT_TEXT,
+			TextFormat: "%RESPONSE_CODE% %DURATION%\n",
+			Filter:     &configv1api.AccessLog_Filter{MinDurationMs: 250, SamplePercentage: proto.Uint32(10)},
+		},
+		{
+			Sink: &configv1api.AccessLog_Grpc_{Grpc: &configv1api.AccessLog_Grpc{}},
+		},
+	}
+
+	t.Run("without access log service", func(t *testing.T) {
+		b := generateTestBootstrap(t, svc)
+		accessLogs := inboundHttpConnectionManager(t, b).GetAccessLog()
+		require.Len(t, accessLogs, 3)
+		for _, accessLog := range accessLogs {
+			assert.NotEqual(t, "envoy.access_loggers.http_grpc", accessLog.GetName())
+		}
+		for _, cluster := range b.GetStaticResources().GetClusters() {
+			assert.NotEqual(t, constants.ClusterNameAccessLog.ToString(), cluster.GetName())
+		}
+	})
+
+	proxyConfig := &configv1.ProxyConfig{Spec: &configv1api.ProxyConfigSpec{Service: svc}}
+	proxyConfig.Namespace = "payments"
+	bootstrap, err := GenerateBootstrap(proxyConfig, "", WithAccessLogService(ServiceAddress{Host: "maestro.maestro-system", Port: 9002}))
+	require.NoError(t, err)
+	b := &bootstrapv3.Bootstrap{}
+	require.NoError(t, protoyaml.Unmarshal([]byte(bootstrap), b))
+	accessLogs := inboundHttpConnectionManager(t, b).GetAccessLog()
+	require.Len(t, accessLogs, 4)
+
+	t.Run("stdout with default format", func(t *testing.T) {
+		accessLog := accessLogs[0]
+		assert.Equal(t, "envoy.access_loggers.stdout", accessLog.GetName())
+		assert.Nil(t, accessLog.GetFilter())
+
+		stdout := &streamv3.StdoutAccessLog{}
+		require.NoError(t, accessLog.GetTypedConfig().UnmarshalTo(stdout))
+		assert.Nil(t, stdout.GetLogFormat())
+	})
+
+	t.Run("stdout with JSON format and status filter", func(t *testing.T) {
+		accessLog := accessLogs[1]
+		assert.Equal(t, "envoy.access_loggers.stdout", accessLog.GetName())
+
+		stdout := &streamv3.StdoutAccessLog{}
+		require.NoError(t, accessLog.GetTypedConfig().UnmarshalTo(stdout))
+		fields := stdout.GetLogFormat().GetJsonFormat().GetFields()
+		require.Len(t, fields, 1)
+		assert.Equal(t, "%RESPONSE_CODE%", fields["status"].GetStringValue())
+
+		comparison := accessLog.GetFilter().GetStatusCodeFilter().GetComparison()
+		require.NotNil(t, comparison)
+		assert.Equal(t, accesslogv3.ComparisonFilter_GE, comparison.GetOp())
+		assert.Equal(t, uint32(500), comparison.GetValue().GetDefaultValue())
+		assert.Equal(t, "access_log.1.min_status_code", comparison.GetValue().GetRuntimeKey())
+	})
+
+	t.Run("file with text format, duration filter and sampling", func(t *testing.T) {
+		accessLog := accessLogs[2]
+		assert.Equal(t, "envoy.access_loggers.file", accessLog.GetName())
+
+		file := &filev3.FileAccessLog{}
+		require.NoError(t, accessLog.GetTypedConfig().UnmarshalTo(file))
+		assert.Equal(t, "/var/log/envoy/access.log", file.GetPath())
+		assert.Equal(t, "%RESPONSE_CODE% %DURATION%\n", file.GetLogFormat().GetTextFormatSource().GetInlineString())
+
+		filters := accessLog.GetFilter().GetAndFilter().GetFilters()
+		require.Len(t, filters, 2)
+		duration := filters[0].GetDurationFilter().GetComparison()
+		require.NotNil(t, duration)
+		assert.Equal(t, accesslogv3.ComparisonFilter_GE, duration.GetOp())
+		assert.Equal(t, uint32(250), duration.GetValue().GetDefaultValue())
+		assert.Equal(t, "access_log.2.min_duration_ms", duration.GetValue().GetRuntimeKey())
+
+		sampling := filters[1].GetRuntimeFilter()
+		require.NotNil(t, sampling)
+		assert.Equal(t, "access_log.2.sample_percentage", sampling.GetRuntimeKey())
+		assert.Equal(t, uint32(10), sampling.GetPercentSampled().GetNumerator())
+		assert.Equal(t, typev3.FractionalPercent_HUNDRED, sampling.GetPercentSampled().GetDenominator())
+	})
+
+	t.Run("grpc", func(t *testing.T) {
+		accessLog := accessLogs[3]
+		assert.Equal(t, "envoy.access_loggers.http_grpc", accessLog.GetName())
+
+		grpc := &grpcv3.HttpGrpcAccessLogConfig{}
+		require.NoError(t, accessLog.GetTypedConfig().UnmarshalTo(grpc))
+		// services of different namespaces are reported apart
+		assert.Equal(t, "payments/orders", grpc.GetCommonConfig().GetLogName())
+		assert.Equal(t, constants.ClusterNameAccessLog.ToString(), grpc.GetCommonConfig().GetGrpcService().GetEnvoyGrpc().GetClusterName())
+
+		var service bool
+		for _, cluster := range b.GetStaticResources().GetClusters() {
+			service = service || cluster.GetName() == constants.ClusterNameAccessLog.ToString()
+		}
+		assert.True(t, service, "access log service cluster not found")
+	})
+}
+
+func TestIgnoredSettings(t *testing.T) {
+	svc := testService()
+	svc.AccessLogs = []*configv1api.AccessLog{
+		{Sink: &configv1api.AccessLog_Stdout_{Stdout: &configv1api.AccessLog_Stdout{}}},
+		{Sink: &configv1api.AccessLog_Grpc_{Grpc: &configv1api.AccessLog_Grpc{}}},
+	}
+	svc.RateLimit = &configv1api.RateLimit{}
+	svc.Tracing = &configv1api.Tracing{}
+	proxyConfig := &configv1.ProxyConfig{Spec: &configv1api.ProxyConfigSpec{Service: svc}}
+
+	assert.Equal(t, []string{
+		"gRPC access log 1 is ignored: no access log service is configured",
+		"rate limit is ignored: no rate limit service is configured",
+		"tracing is ignored: no tracing service is configured",
+	}, IgnoredSettings(proxyConfig))
+
+	address := ServiceAddress{Host: "maestro.maestro-system", Port: 9002}
+	assert.Empty(t, IgnoredSettings(proxyConfig,
+		WithAccessLogService(address),
+		WithRateLimitService(address),
+		WithTracingService(address),
+	))
+}
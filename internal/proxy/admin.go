@@ -1,13 +1,13 @@
 package proxy
 
 import (
+	"github.com/bpalermo/maestro/internal/config/constants"
 	bootstrapv3 "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 )
 
 const (
 	adminAddress = "0.0.0.0"
-	adminPort    = 9901
 )
 
 func generateAdminResource() *bootstrapv3.Admin {
@@ -17,7 +17,7 @@ func generateAdminResource() *bootstrapv3.Admin {
 				SocketAddress: &corev3.SocketAddress{
 					Address: adminAddress,
 					PortSpecifier: &corev3.SocketAddress_PortValue{
-						PortValue: adminPort,
+						PortValue: constants.ProxyAdminPort,
 					},
 				},
 			},
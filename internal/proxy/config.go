@@ -1,20 +1,158 @@
 package proxy
 
 import (
+	"fmt"
+
+	configv1api "github.com/bpalermo/maestro/api/config/v1"
 	"github.com/bpalermo/maestro/internal/util"
 	configv1 "github.com/bpalermo/maestro/pkg/apis/config/v1"
 	bootstrapv3 "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
 )
 
-func GenerateBootstrap(proxyConfig *configv1.ProxyConfig, spiffeDomain string) string {
-	bootstrap := generateBootstrap(proxyConfig, spiffeDomain)
-	return string(util.MustMarshalProtoToYaml(bootstrap))
+// BootstrapOption is a functional option used to configure the generated bootstrap.
+type BootstrapOption func(*bootstrapOptions)
+
+type bootstrapOptions struct {
+	spiffeDomain string
+
+	// namespace is the namespace of the ProxyConfig
+	namespace string
+
+	// rateLimitService is the address of the rate limit service hosted by maestro
+	rateLimitService *ServiceAddress
+
+	// accessLogService is the address of the access log service hosted by maestro
+	accessLogService *ServiceAddress
+
+	// tracingService is the address of the OpenTelemetry collector
+	tracingService *ServiceAddress
+
+	// format is the format the bootstrap is rendered in
+	format configv1api.Bootstrap_Format
+}
+
+// ServiceAddress is the address of a service, hosted by maestro or not, that proxies connect to.
+type ServiceAddress struct {
+	Host string
+	Port uint32
+}
+
+// qualifiedServiceName returns the name of a service qualified by the namespace of its
+// ProxyConfig, as services of different namespaces can have the same name. It is the rate limit
+// domain of the service and the name its gRPC access logs are reported under.
+func qualifiedServiceName(namespace string, svc *configv1api.Service) string {
+	return namespace + "/" + svc.GetName()
+}
+
+// WithRateLimitService sets the address of the rate limit service. Rate limits
+// configured in a ProxyConfig are only rendered when it is set.
+func WithRateLimitService(address ServiceAddress) BootstrapOption {
+	return func(o *bootstrapOptions) {
+		o.rateLimitService = &address
+	}
+}
+
+// WithAccessLogService sets the address of the access log service. gRPC access logs
+// configured in a ProxyConfig are only rendered when it is set.
+func WithAccessLogService(address ServiceAddress) BootstrapOption {
+	return func(o *bootstrapOptions) {
+		o.accessLogService = &address
+	}
+}
+
+// WithTracingService sets the address of the OpenTelemetry collector receiving spans
+// over gRPC. Tracing configured in a ProxyConfig is only rendered when it is set.
+func WithTracingService(address ServiceAddress) BootstrapOption {
+	return func(o *bootstrapOptions) {
+		o.tracingService = &address
+	}
+}
+
+// WithFormat sets the format the bootstrap is rendered in. It is rendered in YAML by default.
+func WithFormat(format configv1api.Bootstrap_Format) BootstrapOption {
+	return func(o *bootstrapOptions) {
+		o.format = format
+	}
+}
+
+// ParseFormat returns the bootstrap format of the given name, yaml or json.
+func ParseFormat(name string) (configv1api.Bootstrap_Format, error) {
+	switch name {
+	case "yaml":
+		return configv1api.Bootstrap_FORMAT_YAML, nil
+	case "json":
+		return configv1api.Bootstrap_FORMAT_JSON, nil
+	default:
+		return configv1api.Bootstrap_FORMAT_UNSPECIFIED, fmt.Errorf("unknown bootstrap format %q, must be one of yaml or json", name)
+	}
+}
+
+// GenerateBootstrap returns the bootstrap of the proxies of a ProxyConfig. An error is
+// returned when the bootstrap is invalid, so it is never written.
+func GenerateBootstrap(proxyConfig *configv1.ProxyConfig, spiffeDomain string, opts ...BootstrapOption) (string, error) {
+	options := &bootstrapOptions{
+		spiffeDomain: spiffeDomain,
+		namespace:    proxyConfig.Namespace,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	b, err := generateBootstrap(proxyConfig, options)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate bootstrap: %w", err)
+	}
+	if err := validateBootstrap(b); err != nil {
+		return "", fmt.Errorf("invalid bootstrap: %w", err)
+	}
+
+	var out []byte
+	if options.format == configv1api.Bootstrap_FORMAT_JSON {
+		out, err = util.MarshalProtoToJSON(b)
+	} else {
+		out, err = util.MarshalProtoToYaml(b)
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal bootstrap: %w", err)
+	}
+	return string(out), nil
 }
 
-func generateBootstrap(proxyConfig *configv1.ProxyConfig, spiffeDomain string) *bootstrapv3.Bootstrap {
-	svc := proxyConfig.Spec.Service
+func generateBootstrap(proxyConfig *configv1.ProxyConfig, options *bootstrapOptions) (*bootstrapv3.Bootstrap, error) {
+	staticResources, err := generateStaticResources(proxyConfig.Spec.GetService(), options)
+	if err != nil {
+		return nil, err
+	}
+
 	return &bootstrapv3.Bootstrap{
 		Admin:           generateAdminResource(),
-		StaticResources: generateStaticResources(svc, spiffeDomain),
+		StaticResources: staticResources,
+	}, nil
+}
+
+// IgnoredSettings returns why settings of a ProxyConfig are not rendered in its bootstrap because
+// the service they depend on is not configured with the given options. These settings are valid,
+// so the bootstrap is still generated, but they should be reported to the owner of the ProxyConfig.
+func IgnoredSettings(proxyConfig *configv1.ProxyConfig, opts ...BootstrapOption) []string {
+	options := &bootstrapOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	svc := proxyConfig.Spec.GetService()
+	var ignored []string
+	if options.accessLogService == nil {
+		for i, accessLog := range svc.GetAccessLogs() {
+			if accessLog.GetGrpc() != nil {
+				ignored = append(ignored, fmt.Sprintf("gRPC access log %d is ignored: no access log service is configured", i))
+			}
+		}
+	}
+	if options.rateLimitService == nil && svc.GetRateLimit() != nil {
+		ignored = append(ignored, "rate limit is ignored: no rate limit service is configured")
+	}
+	if options.tracingService == nil && svc.GetTracing() != nil {
+		ignored = append(ignored, "tracing is ignored: no tracing service is configured")
 	}
+	return ignored
 }
@@ -0,0 +1,203 @@
+package envoy
+
+import (
+	"fmt"
+
+	accesslogv3 "github.com/envoyproxy/go-control-plane/envoy/config/accesslog/v3"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	filev3 "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/file/v3"
+	grpcv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/grpc/v3"
+	streamv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/stream/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var (
+	defaultJsonLogFormat = map[string]string{
+		"start_time":            "%START_TIME%",
+		"method":                "%REQ(:METHOD)%",
+		"path":                  "%REQ(X-ENVOY-ORIGINAL-PATH?:PATH)%",
+		"protocol":              "%PROTOCOL%",
+		"response_code":         "%RESPONSE_CODE%",
+		"response_flags":        "%RESPONSE_FLAGS%",
+		"bytes_received":        "%BYTES_RECEIVED%",
+		"bytes_sent":            "%BYTES_SENT%",
+		"duration":              "%DURATION%",
+		"upstream_host":         "%UPSTREAM_HOST%",
+		"downstream_remote":     "%DOWNSTREAM_REMOTE_ADDRESS%",
+		"downstream_peer_uri":   "%DOWNSTREAM_PEER_URI_SAN%",
+		"user_agent":            "%REQ(USER-AGENT)%",
+		"request_id":            "%REQ(X-REQUEST-ID)%",
+		"authority":             "%REQ(:AUTHORITY)%",
+		"upstream_service_time": "%RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)%",
+	}
+)
+
+// StdoutAccessLog returns an access log writing to the standard output. A nil format uses the Envoy default format.
+func StdoutAccessLog(format *corev3.SubstitutionFormatString, filter *accesslogv3.AccessLogFilter) (*accesslogv3.AccessLog, error) {
+	typedConfig := &streamv3.StdoutAccessLog{}
+	if format != nil {
+		typedConfig.AccessLogFormat = &streamv3.StdoutAccessLog_LogFormat{
+			LogFormat: format,
+		}
+	}
+	return accessLog("envoy.access_loggers.stdout", typedConfig, filter)
+}
+
+// FileAccessLog returns an access log writing to path. A nil format uses the Envoy default format.
+func FileAccessLog(path string, format *corev3.SubstitutionFormatString, filter *accesslogv3.AccessLogFilter) (*accesslogv3.AccessLog, error) {
+	typedConfig := &filev3.FileAccessLog{
+		Path: path,
+	}
+	if format != nil {
+		typedConfig.AccessLogFormat = &filev3.FileAccessLog_LogFormat{
+			LogFormat: format,
+		}
+	}
+	return accessLog("envoy.access_loggers.file", typedConfig, filter)
+}
+
+// GrpcAccessLog returns an access log streaming to the access log service behind clusterName.
+func GrpcAccessLog(logName string, clusterName string, filter *accesslogv3.AccessLogFilter) (*accesslogv3.AccessLog, error) {
+	typedConfig := &grpcv3.HttpGrpcAccessLogConfig{
+		CommonConfig: &grpcv3.CommonGrpcAccessLogConfig{
+			LogName:             logName,
+			TransportApiVersion: corev3.ApiVersion_V3,
+			GrpcService: &corev3.GrpcService{
+				TargetSpecifier: &corev3.GrpcService_EnvoyGrpc_{
+					EnvoyGrpc: &corev3.GrpcService_EnvoyGrpc{
+						ClusterName: clusterName,
+					},
+				},
+			},
+		},
+	}
+	return accessLog("envoy.access_loggers.http_grpc", typedConfig, filter)
+}
+
+// TextLogFormat returns a text log format. An empty format returns nil, selecting the Envoy default format.
+func TextLogFormat(format string) *corev3.SubstitutionFormatString {
+	return textFormat(format)
+}
+
+func textFormat(format string) *corev3.SubstitutionFormatString {
+	if format == "" {
+		return nil
+	}
+	return &corev3.SubstitutionFormatString{
+		Format: &corev3.SubstitutionFormatString_TextFormatSource{
+			TextFormatSource: &corev3.DataSource{
+				Specifier: &corev3.DataSource_InlineString{
+					InlineString: format,
+				},
+			},
+		},
+	}
+}
+
+// JsonLogFormat returns a JSON log format with the given fields, or a default set of fields if empty.
+func JsonLogFormat(fields map[string]string) *corev3.SubstitutionFormatString {
+	if len(fields) == 0 {
+		fields = defaultJsonLogFormat
+	}
+	return jsonFormat(fields)
+}
+
+func jsonFormat(fields map[string]string) *corev3.SubstitutionFormatString {
+	jsonStruct := &structpb.Struct{
+		Fields: make(map[string]*structpb.Value, len(fields)),
+	}
+	for key, value := range fields {
+		jsonStruct.Fields[key] = structpb.NewStringValue(value)
+	}
+
+	return &corev3.SubstitutionFormatString{
+		Format: &corev3.SubstitutionFormatString_JsonFormat{
+			JsonFormat: jsonStruct,
+		},
+	}
+}
+
+// AccessLogFilter returns a filter matching requests with at least the given status code and
+// duration, sampled at samplePercentage. Zero values and a nil percentage disable the matching
+// condition. runtimePrefix namespaces the runtime keys of the filter. It returns nil if no
+// condition is enabled.
+func AccessLogFilter(runtimePrefix string, minStatusCode uint32, minDurationMs uint32, samplePercentage *uint32) *accesslogv3.AccessLogFilter {
+	filters := make([]*accesslogv3.AccessLogFilter, 0)
+
+	if minStatusCode > 0 {
+		filters = append(filters, &accesslogv3.AccessLogFilter{
+			FilterSpecifier: &accesslogv3.AccessLogFilter_StatusCodeFilter{
+				StatusCodeFilter: &accesslogv3.StatusCodeFilter{
+					Comparison: comparisonFilter(fmt.Sprintf("%s.min_status_code", runtimePrefix), minStatusCode),
+				},
+			},
+		})
+	}
+
+	if minDurationMs > 0 {
+		filters = append(filters, &accesslogv3.AccessLogFilter{
+			FilterSpecifier: &accesslogv3.AccessLogFilter_DurationFilter{
+				DurationFilter: &accesslogv3.DurationFilter{
+					Comparison: comparisonFilter(fmt.Sprintf("%s.min_duration_ms", runtimePrefix), minDurationMs),
+				},
+			},
+		})
+	}
+
+	if samplePercentage != nil {
+		filters = append(filters, &accesslogv3.AccessLogFilter{
+			FilterSpecifier: &accesslogv3.AccessLogFilter_RuntimeFilter{
+				RuntimeFilter: &accesslogv3.RuntimeFilter{
+					RuntimeKey: fmt.Sprintf("%s.sample_percentage", runtimePrefix),
+					PercentSampled: &typev3.FractionalPercent{
+						Numerator:   *samplePercentage,
+						Denominator: typev3.FractionalPercent_HUNDRED,
+					},
+				},
+			},
+		})
+	}
+
+	switch len(filters) {
+	case 0:
+		return nil
+	case 1:
+		return filters[0]
+	default:
+		return &accesslogv3.AccessLogFilter{
+			FilterSpecifier: &accesslogv3.AccessLogFilter_AndFilter{
+				AndFilter: &accesslogv3.AndFilter{
+					Filters: filters,
+				},
+			},
+		}
+	}
+}
+
+func comparisonFilter(runtimeKey string, value uint32) *accesslogv3.ComparisonFilter {
+	return &accesslogv3.ComparisonFilter{
+		Op: accesslogv3.ComparisonFilter_GE,
+		Value: &corev3.RuntimeUInt32{
+			DefaultValue: value,
+			RuntimeKey:   runtimeKey,
+		},
+	}
+}
+
+func accessLog(name string, typedConfig proto.Message, filter *accesslogv3.AccessLogFilter) (*accesslogv3.AccessLog, error) {
+	config, err := anypb.New(typedConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to pack access log %s: %w", name, err)
+	}
+
+	return &accesslogv3.AccessLog{
+		Name:   name,
+		Filter: filter,
+		ConfigType: &accesslogv3.AccessLog_TypedConfig{
+			TypedConfig: config,
+		},
+	}, nil
+}
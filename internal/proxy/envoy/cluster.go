@@ -0,0 +1,102 @@
+package envoy
+
+import (
+	"fmt"
+	"time"
+
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpointv3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	httpv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/upstreams/http/v3"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	clusterConnectTimeout = time.Second
+
+	httpProtocolOptionsName = "envoy.extensions.upstreams.http.v3.HttpProtocolOptions"
+)
+
+// GrpcCluster returns a STRICT_DNS cluster speaking HTTP/2 to the given host and port.
+func GrpcCluster(name string, host string, port uint32) (*clusterv3.Cluster, error) {
+	cluster := staticCluster(name, clusterv3.Cluster_STRICT_DNS, socketAddress(host, port))
+	return withHttp2ProtocolOptions(cluster)
+}
+
+// PipeGrpcCluster returns a STATIC cluster speaking HTTP/2 to the given unix domain socket.
+func PipeGrpcCluster(name string, path string) (*clusterv3.Cluster, error) {
+	cluster := staticCluster(name, clusterv3.Cluster_STATIC, &corev3.Address{
+		Address: &corev3.Address_Pipe{
+			Pipe: &corev3.Pipe{
+				Path: path,
+			},
+		},
+	})
+	return withHttp2ProtocolOptions(cluster)
+}
+
+// LocalCluster returns a STATIC cluster connecting to the given port of the loopback address.
+func LocalCluster(name string, port uint32) *clusterv3.Cluster {
+	return staticCluster(name, clusterv3.Cluster_STATIC, socketAddress("127.0.0.1", port))
+}
+
+func staticCluster(name string, discoveryType clusterv3.Cluster_DiscoveryType, address *corev3.Address) *clusterv3.Cluster {
+	return &clusterv3.Cluster{
+		Name: name,
+		ClusterDiscoveryType: &clusterv3.Cluster_Type{
+			Type: discoveryType,
+		},
+		ConnectTimeout: durationpb.New(clusterConnectTimeout),
+		LoadAssignment: &endpointv3.ClusterLoadAssignment{
+			ClusterName: name,
+			Endpoints: []*endpointv3.LocalityLbEndpoints{
+				{
+					LbEndpoints: []*endpointv3.LbEndpoint{
+						{
+							HostIdentifier: &endpointv3.LbEndpoint_Endpoint{
+								Endpoint: &endpointv3.Endpoint{
+									Address: address,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func socketAddress(host string, port uint32) *corev3.Address {
+	return &corev3.Address{
+		Address: &corev3.Address_SocketAddress{
+			SocketAddress: &corev3.SocketAddress{
+				Address: host,
+				PortSpecifier: &corev3.SocketAddress_PortValue{
+					PortValue: port,
+				},
+			},
+		},
+	}
+}
+
+// withHttp2ProtocolOptions sets the protocol options of a cluster to speak HTTP/2 upstream.
+func withHttp2ProtocolOptions(cluster *clusterv3.Cluster) (*clusterv3.Cluster, error) {
+	options, err := anypb.New(&httpv3.HttpProtocolOptions{
+		UpstreamProtocolOptions: &httpv3.HttpProtocolOptions_ExplicitHttpConfig_{
+			ExplicitHttpConfig: &httpv3.HttpProtocolOptions_ExplicitHttpConfig{
+				ProtocolConfig: &httpv3.HttpProtocolOptions_ExplicitHttpConfig_Http2ProtocolOptions{
+					Http2ProtocolOptions: &corev3.Http2ProtocolOptions{},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to pack the protocol options of cluster %s: %w", cluster.GetName(), err)
+	}
+
+	cluster.TypedExtensionProtocolOptions = map[string]*anypb.Any{
+		httpProtocolOptionsName: options,
+	}
+	return cluster, nil
+}
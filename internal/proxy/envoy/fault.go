@@ -0,0 +1,32 @@
+package envoy
+
+import (
+	"fmt"
+
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	faultv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/fault/v3"
+	http_connection_managerv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const (
+	faultFilterName = "envoy.filters.http.fault"
+)
+
+func fault(config *faultv3.HTTPFault) (*http_connection_managerv3.HttpFilter, error) {
+	return httpFilter(faultFilterName, config)
+}
+
+// SetVirtualHostFault replaces the fault filter configuration for the requests of the virtual host.
+func SetVirtualHostFault(vhost *routev3.VirtualHost, config *faultv3.HTTPFault) error {
+	typedConfig, err := anypb.New(config)
+	if err != nil {
+		return fmt.Errorf("unable to pack the fault of virtual host %s: %w", vhost.GetName(), err)
+	}
+
+	if vhost.TypedPerFilterConfig == nil {
+		vhost.TypedPerFilterConfig = map[string]*anypb.Any{}
+	}
+	vhost.TypedPerFilterConfig[faultFilterName] = typedConfig
+	return nil
+}
@@ -1,12 +1,14 @@
 package envoy
 
 import (
-	"github.com/bpalermo/maestro/internal/util"
+	"fmt"
+
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
 	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	http_connection_managerv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
@@ -31,7 +33,12 @@ var (
 	}
 )
 
-func HttpConnectionManager(statPrefix string, vhosts []*routev3.VirtualHost) *http_connection_managerv3.HttpConnectionManager {
+func HttpConnectionManager(statPrefix string, vhosts []*routev3.VirtualHost) (*http_connection_managerv3.HttpConnectionManager, error) {
+	requestIdExtension, err := uuidRequestId()
+	if err != nil {
+		return nil, err
+	}
+
 	return &http_connection_managerv3.HttpConnectionManager{
 		CodecType:  http_connection_managerv3.HttpConnectionManager_AUTO,
 		StatPrefix: statPrefix,
@@ -44,14 +51,21 @@ func HttpConnectionManager(statPrefix string, vhosts []*routev3.VirtualHost) *ht
 		InternalAddressConfig: &http_connection_managerv3.HttpConnectionManager_InternalAddressConfig{
 			CidrRanges: rfc1918CidrRanges,
 		},
-	}
+		GenerateRequestId:  wrapperspb.Bool(true),
+		RequestIdExtension: requestIdExtension,
+	}, nil
 }
 
-func networkFilter(name string, message proto.Message) *listenerv3.Filter {
+func networkFilter(name string, message proto.Message) (*listenerv3.Filter, error) {
+	typedConfig, err := anypb.New(message)
+	if err != nil {
+		return nil, fmt.Errorf("unable to pack network filter %s: %w", name, err)
+	}
+
 	return &listenerv3.Filter{
 		Name: name,
 		ConfigType: &listenerv3.Filter_TypedConfig{
-			TypedConfig: util.MustAny(message),
+			TypedConfig: typedConfig,
 		},
-	}
+	}, nil
 }
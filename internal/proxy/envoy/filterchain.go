@@ -4,34 +4,52 @@ import (
 	"fmt"
 
 	"github.com/bpalermo/maestro/internal/config/constants"
-	"github.com/bpalermo/maestro/internal/util"
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
-	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	http_connection_managerv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	transport_sockets_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	"google.golang.org/protobuf/types/known/anypb"
 )
 
-func generateInboundHTTPFilterChain(enableAuthn bool, authzClusterName string, spireDomain string, vhosts []*routev3.VirtualHost) []*listenerv3.FilterChain {
+func generateInboundHTTPFilterChain(args *InboundHTTPListenerArgs) ([]*listenerv3.FilterChain, error) {
 	filterChains := make([]*listenerv3.FilterChain, 0)
 
-	filterChains = append(filterChains, httpTLSFilterChain(enableAuthn, authzClusterName, spireDomain, vhosts))
+	filterChain, err := httpTLSFilterChain(args)
+	if err != nil {
+		return nil, err
+	}
+	filterChains = append(filterChains, filterChain)
 
-	return filterChains
+	return filterChains, nil
 }
 
-func httpTLSFilterChain(enableAuthn bool, authzClusterName string, spireDomain string, vhosts []*routev3.VirtualHost) *listenerv3.FilterChain {
+func httpTLSFilterChain(args *InboundHTTPListenerArgs) (*listenerv3.FilterChain, error) {
 	filters := make([]*listenerv3.Filter, 0)
 
-	hcm := HttpConnectionManager("inbound_http", vhosts)
-	hcm.HttpFilters = hcmHttpFilters(enableAuthn, authzClusterName)
+	hcm, err := HttpConnectionManager("inbound_http", args.VirtualHosts)
+	if err != nil {
+		return nil, err
+	}
+	if hcm.HttpFilters, err = hcmHttpFilters(args); err != nil {
+		return nil, err
+	}
+	hcm.AccessLog = args.AccessLogs
+	if args.Tracing != nil {
+		if hcm.Tracing, err = tracing(args.Tracing); err != nil {
+			return nil, err
+		}
+	}
+	hcm.LocalReplyConfig = args.LocalReply
 
 	hcm.ForwardClientCertDetails = http_connection_managerv3.HttpConnectionManager_SANITIZE_SET
 	hcm.SetCurrentClientCertDetails = &http_connection_managerv3.HttpConnectionManager_SetCurrentClientCertDetails{
 		Uri: true,
 	}
 
-	hcmFilter := networkFilter("envoy.http_connection_manager", hcm)
+	hcmFilter, err := networkFilter("envoy.http_connection_manager", hcm)
+	if err != nil {
+		return nil, err
+	}
 
 	filters = append(filters, hcmFilter)
 
@@ -39,29 +57,23 @@ func httpTLSFilterChain(enableAuthn bool, authzClusterName string, spireDomain s
 		Filters: filters,
 	}
 
+	spireDomain := args.SpiffeDomain
 	if spireDomain != "" {
-		filterChain.TransportSocket = &corev3.TransportSocket{
-			Name: "envoy.transport_sockets.tls",
-			ConfigType: &corev3.TransportSocket_TypedConfig{
-				TypedConfig: util.MustAny(
-					&transport_sockets_v3.DownstreamTlsContext{
-						CommonTlsContext: &transport_sockets_v3.CommonTlsContext{
-							ValidationContextType: &transport_sockets_v3.CommonTlsContext_ValidationContextSdsSecretConfig{
-								ValidationContextSdsSecretConfig: &transport_sockets_v3.SdsSecretConfig{
-									Name: fmt.Sprintf("spiffe://%s", spireDomain),
-									SdsConfig: &corev3.ConfigSource{
-										ResourceApiVersion: corev3.ApiVersion_V3,
-										ConfigSourceSpecifier: &corev3.ConfigSource_ApiConfigSource{
-											ApiConfigSource: &corev3.ApiConfigSource{
-												ApiType: corev3.ApiConfigSource_GRPC,
-												GrpcServices: []*corev3.GrpcService{
-													{
-														TargetSpecifier: &corev3.GrpcService_EnvoyGrpc_{
-															EnvoyGrpc: &corev3.GrpcService_EnvoyGrpc{
-																ClusterName: constants.ClusterNameLocalSpire.ToString(),
-															},
-														},
-													},
+		tlsContext, err := anypb.New(&transport_sockets_v3.DownstreamTlsContext{
+			CommonTlsContext: &transport_sockets_v3.CommonTlsContext{
+				ValidationContextType: &transport_sockets_v3.CommonTlsContext_ValidationContextSdsSecretConfig{
+					ValidationContextSdsSecretConfig: &transport_sockets_v3.SdsSecretConfig{
+						Name: fmt.Sprintf("spiffe://%s", spireDomain),
+						SdsConfig: &corev3.ConfigSource{
+							ResourceApiVersion: corev3.ApiVersion_V3,
+							ConfigSourceSpecifier: &corev3.ConfigSource_ApiConfigSource{
+								ApiConfigSource: &corev3.ApiConfigSource{
+									ApiType: corev3.ApiConfigSource_GRPC,
+									GrpcServices: []*corev3.GrpcService{
+										{
+											TargetSpecifier: &corev3.GrpcService_EnvoyGrpc_{
+												EnvoyGrpc: &corev3.GrpcService_EnvoyGrpc{
+													ClusterName: constants.ClusterNameLocalSpire.ToString(),
 												},
 											},
 										},
@@ -70,26 +82,62 @@ func httpTLSFilterChain(enableAuthn bool, authzClusterName string, spireDomain s
 							},
 						},
 					},
-				),
+				},
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to pack the downstream TLS context: %w", err)
+		}
+
+		filterChain.TransportSocket = &corev3.TransportSocket{
+			Name: "envoy.transport_sockets.tls",
+			ConfigType: &corev3.TransportSocket_TypedConfig{
+				TypedConfig: tlsContext,
 			},
 		}
 	}
 
-	return filterChain
+	return filterChain, nil
 }
 
-func hcmHttpFilters(enableAuthn bool, authzClusterName string) []*http_connection_managerv3.HttpFilter {
+func hcmHttpFilters(args *InboundHTTPListenerArgs) ([]*http_connection_managerv3.HttpFilter, error) {
 	filters := make([]*http_connection_managerv3.HttpFilter, 0)
 
-	if enableAuthn {
-		filters = append(filters, authn())
+	add := func(filter *http_connection_managerv3.HttpFilter, err error) error {
+		if err != nil {
+			return err
+		}
+		filters = append(filters, filter)
+		return nil
 	}
 
-	if authzClusterName != "" {
-		filters = append(filters, authz(authzClusterName))
+	if args.EnableAuthn {
+		if err := add(authn()); err != nil {
+			return nil, err
+		}
 	}
 
-	filters = append(filters, router())
+	if args.AuthzClusterName != "" {
+		if err := add(authz(args.AuthzClusterName)); err != nil {
+			return nil, err
+		}
+	}
+
+	if args.Fault != nil {
+		if err := add(fault(args.Fault)); err != nil {
+			return nil, err
+		}
+	}
+
+	if args.RateLimit != nil {
+		if err := add(rateLimit(args.RateLimit)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := add(router()); err != nil {
+		return nil, err
+	}
 
-	return filters
+	return filters, nil
 }
@@ -0,0 +1,17 @@
+package envoy
+
+import (
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+)
+
+// HeaderValueOption returns a header to add with the given append action. The value may
+// contain Envoy substitution formatters.
+func HeaderValueOption(key string, value string, action corev3.HeaderValueOption_HeaderAppendAction) *corev3.HeaderValueOption {
+	return &corev3.HeaderValueOption{
+		AppendAction: action,
+		Header: &corev3.HeaderValue{
+			Key:   key,
+			Value: value,
+		},
+	}
+}
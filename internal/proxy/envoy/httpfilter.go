@@ -1,30 +1,34 @@
 package envoy
 
 import (
+	"fmt"
 	"time"
 
-	"github.com/bpalermo/maestro/internal/util"
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ratelimitconfv3 "github.com/envoyproxy/go-control-plane/envoy/config/ratelimit/v3"
 	ext_authzv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_authz/v3"
 	jwt_authnv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/jwt_authn/v3"
+	ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ratelimit/v3"
 	routerv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/router/v3"
 	http_connection_managerv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 const (
-	authzTimeout = time.Millisecond * 500
+	authzTimeout     = time.Millisecond * 500
+	rateLimitTimeout = time.Millisecond * 100
 )
 
-func authn() *http_connection_managerv3.HttpFilter {
+func authn() (*http_connection_managerv3.HttpFilter, error) {
 	typedConfig := &jwt_authnv3.JwtAuthentication{
 		BypassCorsPreflight: false,
 	}
 	return httpFilter("envoy.filters.http.jwt_authn", typedConfig)
 }
 
-func authz(clusterName string) *http_connection_managerv3.HttpFilter {
+func authz(clusterName string) (*http_connection_managerv3.HttpFilter, error) {
 	typedConfig := &ext_authzv3.ExtAuthz{
 		TransportApiVersion: corev3.ApiVersion_V3,
 		Services: &ext_authzv3.ExtAuthz_GrpcService{
@@ -46,16 +50,40 @@ func authz(clusterName string) *http_connection_managerv3.HttpFilter {
 	return httpFilter("envoy.filters.http.ext_authz", typedConfig)
 }
 
-func router() *http_connection_managerv3.HttpFilter {
+func rateLimit(args *RateLimitArgs) (*http_connection_managerv3.HttpFilter, error) {
+	typedConfig := &ratelimitv3.RateLimit{
+		Domain:          args.Domain,
+		Timeout:         durationpb.New(rateLimitTimeout),
+		FailureModeDeny: args.FailureModeDeny,
+		RateLimitService: &ratelimitconfv3.RateLimitServiceConfig{
+			TransportApiVersion: corev3.ApiVersion_V3,
+			GrpcService: &corev3.GrpcService{
+				TargetSpecifier: &corev3.GrpcService_EnvoyGrpc_{
+					EnvoyGrpc: &corev3.GrpcService_EnvoyGrpc{
+						ClusterName: args.ClusterName,
+					},
+				},
+			},
+		},
+	}
+	return httpFilter("envoy.filters.http.ratelimit", typedConfig)
+}
+
+func router() (*http_connection_managerv3.HttpFilter, error) {
 	typedConfig := &routerv3.Router{}
 	return httpFilter("envoy.filters.http.router", typedConfig)
 }
 
-func httpFilter(name string, typedConfig proto.Message) *http_connection_managerv3.HttpFilter {
+func httpFilter(name string, typedConfig proto.Message) (*http_connection_managerv3.HttpFilter, error) {
+	config, err := anypb.New(typedConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to pack HTTP filter %s: %w", name, err)
+	}
+
 	return &http_connection_managerv3.HttpFilter{
 		Name: name,
 		ConfigType: &http_connection_managerv3.HttpFilter_TypedConfig{
-			TypedConfig: util.MustAny(typedConfig),
+			TypedConfig: config,
 		},
-	}
+	}, nil
 }
@@ -1,17 +1,51 @@
 package envoy
 
 import (
+	"github.com/bpalermo/maestro/internal/config/constants"
+	accesslogv3 "github.com/envoyproxy/go-control-plane/envoy/config/accesslog/v3"
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
 	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	faultv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/fault/v3"
+	http_connection_managerv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 )
 
 const (
 	inboundHTTPListenerAddress = "0.0.0.0"
-	inboundHTTPListenerPort    = 18080
 )
 
-func GenerateInboundHTTPListener(enableAuthn bool, authzClusterName string, spiffeDomain string, vhosts []*routev3.VirtualHost) *listenerv3.Listener {
+// InboundHTTPListenerArgs holds the settings used to render the inbound HTTP listener.
+type InboundHTTPListenerArgs struct {
+	EnableAuthn      bool
+	AuthzClusterName string
+	SpiffeDomain     string
+	VirtualHosts     []*routev3.VirtualHost
+	// Fault enables the fault injection filter when set. An empty fault injects nothing
+	// unless overridden by a virtual host.
+	Fault *faultv3.HTTPFault
+	// RateLimit enables the global rate limit filter when set.
+	RateLimit *RateLimitArgs
+	// AccessLogs are the access logs of the HTTP connection manager.
+	AccessLogs []*accesslogv3.AccessLog
+	// Tracing enables tracing of the HTTP connection manager when set.
+	Tracing *TracingArgs
+	// LocalReply formats the replies generated by Envoy when set.
+	LocalReply *http_connection_managerv3.LocalReplyConfig
+}
+
+// RateLimitArgs holds the settings of the global rate limit filter.
+type RateLimitArgs struct {
+	Domain          string
+	ClusterName     string
+	FailureModeDeny bool
+}
+
+func GenerateInboundHTTPListener(args *InboundHTTPListenerArgs) (*listenerv3.Listener, error) {
+	filterChains, err := generateInboundHTTPFilterChain(args)
+	if err != nil {
+		return nil, err
+	}
+
 	return &listenerv3.Listener{
 		Name: "inbound_http",
 		Address: &corev3.Address{
@@ -19,11 +53,11 @@ func GenerateInboundHTTPListener(enableAuthn bool, authzClusterName string, spif
 				SocketAddress: &corev3.SocketAddress{
 					Address: inboundHTTPListenerAddress,
 					PortSpecifier: &corev3.SocketAddress_PortValue{
-						PortValue: inboundHTTPListenerPort,
+						PortValue: constants.ProxyInboundPort,
 					},
 				},
 			},
 		},
-		FilterChains: generateInboundHTTPFilterChain(enableAuthn, authzClusterName, spiffeDomain, vhosts),
-	}
+		FilterChains: filterChains,
+	}, nil
 }
@@ -0,0 +1,35 @@
+package envoy
+
+import (
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	http_connection_managerv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+)
+
+var (
+	defaultJsonLocalReplyFormat = map[string]string{
+		"code":       "%RESPONSE_CODE%",
+		"message":    "%LOCAL_REPLY_BODY%",
+		"details":    "%RESPONSE_CODE_DETAILS%",
+		"request_id": "%REQ(X-REQUEST-ID)%",
+	}
+)
+
+// JsonLocalReplyFormat returns a JSON local reply body with the given fields, or a default error envelope if empty.
+func JsonLocalReplyFormat(fields map[string]string) *corev3.SubstitutionFormatString {
+	if len(fields) == 0 {
+		fields = defaultJsonLocalReplyFormat
+	}
+	return jsonFormat(fields)
+}
+
+// TextLocalReplyFormat returns a text local reply body. An empty format returns nil, selecting the Envoy default body.
+func TextLocalReplyFormat(format string) *corev3.SubstitutionFormatString {
+	return textFormat(format)
+}
+
+// LocalReplyConfig returns a local reply configuration formatting all the replies generated by Envoy with format.
+func LocalReplyConfig(format *corev3.SubstitutionFormatString) *http_connection_managerv3.LocalReplyConfig {
+	return &http_connection_managerv3.LocalReplyConfig{
+		BodyFormat: format,
+	}
+}
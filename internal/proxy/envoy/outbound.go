@@ -0,0 +1,208 @@
+package envoy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bpalermo/maestro/internal/config/constants"
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	http_inspectorv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/listener/http_inspector/v3"
+	original_dstv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/listener/original_dst/v3"
+	http_connection_managerv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tcp_proxyv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
+	httpv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/upstreams/http/v3"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	outboundListenerAddress = "0.0.0.0"
+
+	// protocolDetectionTimeout bounds the time the HTTP inspector waits for the first bytes of a
+	// connection, after which it is proxied as TCP. Clients of server-first protocols, such as
+	// MySQL, send nothing before the server does.
+	protocolDetectionTimeout = 100 * time.Millisecond
+)
+
+var (
+	// outboundHTTPProtocols are the protocols detected by the HTTP inspector routed by the
+	// outbound HTTP connection manager
+	outboundHTTPProtocols = []string{"http/1.0", "http/1.1", "h2c"}
+)
+
+// OutboundListenerArgs holds the settings used to render the outbound listener.
+type OutboundListenerArgs struct {
+	// ClusterName is the cluster forwarding the traffic to its original destination.
+	ClusterName string
+	// VirtualHosts route the outbound traffic detected as HTTP when set. All the outbound
+	// traffic is proxied as TCP otherwise.
+	VirtualHosts []*routev3.VirtualHost
+	// Tracing enables tracing of the outbound HTTP traffic when set.
+	Tracing *TracingArgs
+}
+
+// GenerateOutboundListener returns the listener receiving the outbound traffic intercepted
+// in the pod, forwarded to its original destination through the cluster of the args. The
+// traffic detected as HTTP is routed by the virtual hosts of the args, if any, and the rest
+// is proxied as TCP.
+func GenerateOutboundListener(args *OutboundListenerArgs) (*listenerv3.Listener, error) {
+	originalDst, err := listenerFilter("envoy.filters.listener.original_dst", &original_dstv3.OriginalDst{})
+	if err != nil {
+		return nil, err
+	}
+
+	tcpProxy, err := networkFilter("envoy.filters.network.tcp_proxy", &tcp_proxyv3.TcpProxy{
+		StatPrefix: "outbound",
+		ClusterSpecifier: &tcp_proxyv3.TcpProxy_Cluster{
+			Cluster: args.ClusterName,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	listener := &listenerv3.Listener{
+		Name: "outbound",
+		Address: &corev3.Address{
+			Address: &corev3.Address_SocketAddress{
+				SocketAddress: &corev3.SocketAddress{
+					Address: outboundListenerAddress,
+					PortSpecifier: &corev3.SocketAddress_PortValue{
+						PortValue: constants.ProxyOutboundPort,
+					},
+				},
+			},
+		},
+		TrafficDirection: corev3.TrafficDirection_OUTBOUND,
+		ListenerFilters:  []*listenerv3.ListenerFilter{originalDst},
+		FilterChains: []*listenerv3.FilterChain{
+			{
+				Filters: []*listenerv3.Filter{tcpProxy},
+			},
+		},
+	}
+	if len(args.VirtualHosts) == 0 {
+		return listener, nil
+	}
+
+	httpInspector, err := listenerFilter("envoy.filters.listener.http_inspector", &http_inspectorv3.HttpInspector{})
+	if err != nil {
+		return nil, err
+	}
+	httpFilterChain, err := outboundHTTPFilterChain(args)
+	if err != nil {
+		return nil, err
+	}
+
+	listener.ListenerFilters = append(listener.ListenerFilters, httpInspector)
+	listener.ListenerFiltersTimeout = durationpb.New(protocolDetectionTimeout)
+	listener.ContinueOnListenerFiltersTimeout = true
+	listener.FilterChains = append([]*listenerv3.FilterChain{httpFilterChain}, listener.FilterChains...)
+	return listener, nil
+}
+
+func outboundHTTPFilterChain(args *OutboundListenerArgs) (*listenerv3.FilterChain, error) {
+	hcm, err := HttpConnectionManager("outbound_http", args.VirtualHosts)
+	if err != nil {
+		return nil, err
+	}
+	routerFilter, err := router()
+	if err != nil {
+		return nil, err
+	}
+	hcm.HttpFilters = []*http_connection_managerv3.HttpFilter{routerFilter}
+	// the virtual hosts match the names of the services, whatever port they are addressed on
+	hcm.StripPortMode = &http_connection_managerv3.HttpConnectionManager_StripAnyHostPort{
+		StripAnyHostPort: true,
+	}
+	if args.Tracing != nil {
+		if hcm.Tracing, err = tracing(args.Tracing); err != nil {
+			return nil, err
+		}
+	}
+
+	hcmFilter, err := networkFilter("envoy.http_connection_manager", hcm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &listenerv3.FilterChain{
+		FilterChainMatch: &listenerv3.FilterChainMatch{
+			ApplicationProtocols: outboundHTTPProtocols,
+		},
+		Filters: []*listenerv3.Filter{hcmFilter},
+	}, nil
+}
+
+// OutboundVirtualHost returns a virtual host forwarding the requests for the given domains to
+// their original destination through the given cluster. Requests are not timed out, as the
+// application sets its own timeouts.
+func OutboundVirtualHost(name string, domains []string, clusterName string) *routev3.VirtualHost {
+	return &routev3.VirtualHost{
+		Name:    name,
+		Domains: domains,
+		Routes: []*routev3.Route{
+			{
+				Match: &routev3.RouteMatch{
+					PathSpecifier: &routev3.RouteMatch_Prefix{
+						Prefix: "/",
+					},
+				},
+				Action: &routev3.Route_Route{
+					Route: &routev3.RouteAction{
+						ClusterSpecifier: &routev3.RouteAction_Cluster{
+							Cluster: clusterName,
+						},
+						Timeout: durationpb.New(0),
+					},
+				},
+			},
+		},
+	}
+}
+
+// OriginalDstCluster returns a cluster connecting to the original destination of the downstream
+// connection. HTTP requests are sent upstream with the protocol they were received with.
+func OriginalDstCluster(name string) (*clusterv3.Cluster, error) {
+	options, err := anypb.New(&httpv3.HttpProtocolOptions{
+		UpstreamProtocolOptions: &httpv3.HttpProtocolOptions_UseDownstreamProtocolConfig{
+			UseDownstreamProtocolConfig: &httpv3.HttpProtocolOptions_UseDownstreamHttpConfig{
+				HttpProtocolOptions:  &corev3.Http1ProtocolOptions{},
+				Http2ProtocolOptions: &corev3.Http2ProtocolOptions{},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to pack the protocol options of cluster %s: %w", name, err)
+	}
+
+	return &clusterv3.Cluster{
+		Name: name,
+		ClusterDiscoveryType: &clusterv3.Cluster_Type{
+			Type: clusterv3.Cluster_ORIGINAL_DST,
+		},
+		LbPolicy:       clusterv3.Cluster_CLUSTER_PROVIDED,
+		ConnectTimeout: durationpb.New(clusterConnectTimeout),
+		TypedExtensionProtocolOptions: map[string]*anypb.Any{
+			httpProtocolOptionsName: options,
+		},
+	}, nil
+}
+
+func listenerFilter(name string, message proto.Message) (*listenerv3.ListenerFilter, error) {
+	typedConfig, err := anypb.New(message)
+	if err != nil {
+		return nil, fmt.Errorf("unable to pack listener filter %s: %w", name, err)
+	}
+
+	return &listenerv3.ListenerFilter{
+		Name: name,
+		ConfigType: &listenerv3.ListenerFilter_TypedConfig{
+			TypedConfig: typedConfig,
+		},
+	}, nil
+}
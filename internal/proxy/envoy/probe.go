@@ -0,0 +1,126 @@
+package envoy
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/bpalermo/maestro/internal/config/constants"
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+)
+
+const (
+	probeListenerAddress = "0.0.0.0"
+)
+
+// ProbeRoute is a probe of the application rewritten at injection.
+type ProbeRoute struct {
+	// Path is the path the probe is rewritten to, matched exactly.
+	Path string
+	// OriginalPath is the path of the probe on the application.
+	OriginalPath string
+	// Port is the local port of the application the probe is forwarded to.
+	Port uint32
+}
+
+// ProbeClusterName returns the name of the cluster forwarding probes to the given local port.
+func ProbeClusterName(port uint32) string {
+	return fmt.Sprintf("%s_%d", constants.ClusterNameAppProbe, port)
+}
+
+// GenerateProbeListener returns the plaintext listener serving the probes of the application
+// rewritten at injection. Each probe is only forwarded to the path and port it was rewritten
+// from, any other request is rejected, so the listener gives no access to the application.
+func GenerateProbeListener(probes []ProbeRoute) (*listenerv3.Listener, error) {
+	routes := make([]*routev3.Route, 0, len(probes)+1)
+	for _, probe := range probes {
+		originalPath := probe.OriginalPath
+		if originalPath == "" {
+			originalPath = "/"
+		}
+
+		routes = append(routes, &routev3.Route{
+			Match: &routev3.RouteMatch{
+				PathSpecifier: &routev3.RouteMatch_Path{
+					Path: probe.Path,
+				},
+			},
+			Action: &routev3.Route_Route{
+				Route: &routev3.RouteAction{
+					ClusterSpecifier: &routev3.RouteAction_Cluster{
+						Cluster: ProbeClusterName(probe.Port),
+					},
+					PrefixRewrite: originalPath,
+				},
+			},
+		})
+	}
+	routes = append(routes, &routev3.Route{
+		Match: &routev3.RouteMatch{
+			PathSpecifier: &routev3.RouteMatch_Prefix{
+				Prefix: "/",
+			},
+		},
+		Action: &routev3.Route_DirectResponse{
+			DirectResponse: &routev3.DirectResponseAction{
+				Status: http.StatusForbidden,
+			},
+		},
+	})
+
+	hcm, err := HttpConnectionManager("app_probe", []*routev3.VirtualHost{
+		{
+			Name:    "app_probe",
+			Domains: []string{"*"},
+			Routes:  routes,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	routerFilter, err := router()
+	if err != nil {
+		return nil, err
+	}
+	hcm.HttpFilters = append(hcm.HttpFilters, routerFilter)
+
+	hcmFilter, err := networkFilter("envoy.http_connection_manager", hcm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &listenerv3.Listener{
+		Name: "app_probe",
+		Address: &corev3.Address{
+			Address: &corev3.Address_SocketAddress{
+				SocketAddress: &corev3.SocketAddress{
+					Address: probeListenerAddress,
+					PortSpecifier: &corev3.SocketAddress_PortValue{
+						PortValue: constants.ProxyProbePort,
+					},
+				},
+			},
+		},
+		FilterChains: []*listenerv3.FilterChain{
+			{
+				Filters: []*listenerv3.Filter{hcmFilter},
+			},
+		},
+	}, nil
+}
+
+// ProbeClusters returns the clusters of the local ports the given probes are forwarded to.
+func ProbeClusters(probes []ProbeRoute) []*clusterv3.Cluster {
+	var clusters []*clusterv3.Cluster
+	seen := map[uint32]bool{}
+	for _, probe := range probes {
+		if seen[probe.Port] {
+			continue
+		}
+		seen[probe.Port] = true
+		clusters = append(clusters, LocalCluster(ProbeClusterName(probe.Port), probe.Port))
+	}
+	return clusters
+}
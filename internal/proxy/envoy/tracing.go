@@ -0,0 +1,119 @@
+package envoy
+
+import (
+	"fmt"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	tracev3 "github.com/envoyproxy/go-control-plane/envoy/config/trace/v3"
+	http_connection_managerv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	uuidv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/request_id/uuid/v3"
+	tracingv3 "github.com/envoyproxy/go-control-plane/envoy/type/tracing/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// TracingArgs holds the tracing settings of an HTTP connection manager.
+type TracingArgs struct {
+	// ServiceName is the service name reported in the spans.
+	ServiceName string
+	// ClusterName is the cluster of the OpenTelemetry collector.
+	ClusterName string
+	// RandomSampling, ClientSampling and OverallSampling are percentages. Nil uses the Envoy default of 100%.
+	RandomSampling  *float64
+	ClientSampling  *float64
+	OverallSampling *float64
+	CustomTags      []*tracingv3.CustomTag
+}
+
+func tracing(args *TracingArgs) (*http_connection_managerv3.HttpConnectionManager_Tracing, error) {
+	typedConfig, err := anypb.New(&tracev3.OpenTelemetryConfig{
+		ServiceName: args.ServiceName,
+		GrpcService: &corev3.GrpcService{
+			TargetSpecifier: &corev3.GrpcService_EnvoyGrpc_{
+				EnvoyGrpc: &corev3.GrpcService_EnvoyGrpc{
+					ClusterName: args.ClusterName,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to pack the OpenTelemetry tracer: %w", err)
+	}
+
+	return &http_connection_managerv3.HttpConnectionManager_Tracing{
+		RandomSampling:  percent(args.RandomSampling),
+		ClientSampling:  percent(args.ClientSampling),
+		OverallSampling: percent(args.OverallSampling),
+		CustomTags:      args.CustomTags,
+		Provider: &tracev3.Tracing_Http{
+			Name: "envoy.tracers.opentelemetry",
+			ConfigType: &tracev3.Tracing_Http_TypedConfig{
+				TypedConfig: typedConfig,
+			},
+		},
+	}, nil
+}
+
+// LiteralCustomTag returns a custom tag with a fixed value.
+func LiteralCustomTag(tag string, value string) *tracingv3.CustomTag {
+	return &tracingv3.CustomTag{
+		Tag: tag,
+		Type: &tracingv3.CustomTag_Literal_{
+			Literal: &tracingv3.CustomTag_Literal{
+				Value: value,
+			},
+		},
+	}
+}
+
+// HeaderCustomTag returns a custom tag valued from a request header.
+func HeaderCustomTag(tag string, name string, defaultValue string) *tracingv3.CustomTag {
+	return &tracingv3.CustomTag{
+		Tag: tag,
+		Type: &tracingv3.CustomTag_RequestHeader{
+			RequestHeader: &tracingv3.CustomTag_Header{
+				Name:         name,
+				DefaultValue: defaultValue,
+			},
+		},
+	}
+}
+
+// EnvironmentCustomTag returns a custom tag valued from an environment variable of the proxy.
+func EnvironmentCustomTag(tag string, name string, defaultValue string) *tracingv3.CustomTag {
+	return &tracingv3.CustomTag{
+		Tag: tag,
+		Type: &tracingv3.CustomTag_Environment_{
+			Environment: &tracingv3.CustomTag_Environment{
+				Name:         name,
+				DefaultValue: defaultValue,
+			},
+		},
+	}
+}
+
+// uuidRequestId generates x-request-id headers carrying the trace decision, so that
+// a request keeps the same sampling decision across all the services it goes through.
+func uuidRequestId() (*http_connection_managerv3.RequestIDExtension, error) {
+	typedConfig, err := anypb.New(&uuidv3.UuidRequestIdConfig{
+		PackTraceReason:              wrapperspb.Bool(true),
+		UseRequestIdForTraceSampling: wrapperspb.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to pack the request ID extension: %w", err)
+	}
+
+	return &http_connection_managerv3.RequestIDExtension{
+		TypedConfig: typedConfig,
+	}, nil
+}
+
+func percent(value *float64) *typev3.Percent {
+	if value == nil {
+		return nil
+	}
+	return &typev3.Percent{
+		Value: *value,
+	}
+}
@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	configv1 "github.com/bpalermo/maestro/api/config/v1"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	commonfaultv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/common/fault/v3"
+	faultv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/fault/v3"
+	matcherv3 "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+)
+
+// generateFault returns the configuration of the fault filter, or nil if neither the
+// service nor any of its ports configures a fault.
+func generateFault(svc *configv1.Service) *faultv3.HTTPFault {
+	if !FaultEnabled(svc) {
+		return nil
+	}
+	return httpFault(svc.GetFault())
+}
+
+func httpFault(fault *configv1.Fault) *faultv3.HTTPFault {
+	config := &faultv3.HTTPFault{}
+	if fault == nil {
+		return config
+	}
+
+	if delay := fault.GetDelay(); delay != nil {
+		config.Delay = &commonfaultv3.FaultDelay{
+			FaultDelaySecifier: &commonfaultv3.FaultDelay_FixedDelay{
+				FixedDelay: delay.GetFixedDelay(),
+			},
+			Percentage: faultPercentage(delay.Percentage),
+		}
+	}
+
+	if abort := fault.GetAbort(); abort != nil {
+		config.Abort = &faultv3.FaultAbort{
+			Percentage: faultPercentage(abort.Percentage),
+		}
+		switch status := abort.GetStatus().(type) {
+		case *configv1.Fault_Abort_HttpStatus:
+			config.Abort.ErrorType = &faultv3.FaultAbort_HttpStatus{HttpStatus: status.HttpStatus}
+		case *configv1.Fault_Abort_GrpcStatus:
+			config.Abort.ErrorType = &faultv3.FaultAbort_GrpcStatus{GrpcStatus: status.GrpcStatus}
+		}
+	}
+
+	for _, header := range fault.GetHeaders() {
+		config.Headers = append(config.Headers, faultHeaderMatcher(header))
+	}
+
+	return config
+}
+
+func faultHeaderMatcher(header *configv1.Fault_Header) *routev3.HeaderMatcher {
+	if header.GetValue() == "" {
+		return &routev3.HeaderMatcher{
+			Name: header.GetName(),
+			HeaderMatchSpecifier: &routev3.HeaderMatcher_PresentMatch{
+				PresentMatch: true,
+			},
+		}
+	}
+	return &routev3.HeaderMatcher{
+		Name: header.GetName(),
+		HeaderMatchSpecifier: &routev3.HeaderMatcher_StringMatch{
+			StringMatch: &matcherv3.StringMatcher{
+				MatchPattern: &matcherv3.StringMatcher_Exact{
+					Exact: header.GetValue(),
+				},
+			},
+		},
+	}
+}
+
+func faultPercentage(percentage *uint32) *typev3.FractionalPercent {
+	numerator := uint32(100)
+	if percentage != nil {
+		numerator = *percentage
+	}
+	return &typev3.FractionalPercent{
+		Numerator:   numerator,
+		Denominator: typev3.FractionalPercent_HUNDRED,
+	}
+}
+
+// FaultEnabled returns whether the service or any of its ports configures a fault.
+func FaultEnabled(svc *configv1.Service) bool {
+	if svc.GetFault() != nil {
+		return true
+	}
+	for _, svcPort := range svc.GetServicePorts() {
+		if svcPort.GetFault() != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	configv1 "github.com/bpalermo/maestro/api/config/v1"
+	"github.com/bpalermo/maestro/internal/proxy/envoy"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+)
+
+var (
+	headerAppendActions = map[configv1.HeaderRules_Header_Action]corev3.HeaderValueOption_HeaderAppendAction{
+		configv1.HeaderRules_Header_ACTION_UNSPECIFIED:         corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+		configv1.HeaderRules_Header_ACTION_APPEND:              corev3.HeaderValueOption_APPEND_IF_EXISTS_OR_ADD,
+		configv1.HeaderRules_Header_ACTION_ADD_IF_ABSENT:       corev3.HeaderValueOption_ADD_IF_ABSENT,
+		configv1.HeaderRules_Header_ACTION_OVERWRITE_IF_EXISTS: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS,
+	}
+)
+
+// applyHeaderRules renders the header rules on the virtual host, in order.
+func applyHeaderRules(vhost *routev3.VirtualHost, rules ...*configv1.HeaderRules) {
+	for _, r := range rules {
+		vhost.RequestHeadersToAdd = append(vhost.RequestHeadersToAdd, headersToAdd(r.GetRequest())...)
+		vhost.RequestHeadersToRemove = append(vhost.RequestHeadersToRemove, r.GetRequest().GetRemove()...)
+		vhost.ResponseHeadersToAdd = append(vhost.ResponseHeadersToAdd, headersToAdd(r.GetResponse())...)
+		vhost.ResponseHeadersToRemove = append(vhost.ResponseHeadersToRemove, r.GetResponse().GetRemove()...)
+	}
+}
+
+func headersToAdd(rules *configv1.HeaderRules_Rules) []*corev3.HeaderValueOption {
+	headers := make([]*corev3.HeaderValueOption, 0, len(rules.GetSet()))
+	for _, header := range rules.GetSet() {
+		headers = append(headers, envoy.HeaderValueOption(header.GetName(), header.GetValue(), headerAppendActions[header.GetAction()]))
+	}
+	return headers
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"testing"
+
+	configv1api "github.com/bpalermo/maestro/api/config/v1"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateVHosts_Headers(t *testing.T) {
+	svc := &configv1api.Service{
+		Name: "orders",
+		Headers: &configv1api.HeaderRules{
+			Request: &configv1api.HeaderRules_Rules{
+				Set: []*configv1api.HeaderRules_Header{
+					{Name: "x-peer", Value: "%DOWNSTREAM_PEER_URI_SAN%"},
+					{Name: "x-env", Value: "production", Action: configv1api.HeaderRules_Header_ACTION_ADD_IF_ABSENT},
+				},
+				Remove: []string{"x-internal"},
+			},
+			Response: &configv1api.HeaderRules_Rules{
+				Remove: []string{"server"},
+			},
+		},
+		ServicePorts: []*configv1api.Service_ServicePort{
+			{
+				Port: 8080,
+				Headers: &configv1api.HeaderRules{
+					Response: &configv1api.HeaderRules_Rules{
+						Set:    []*configv1api.HeaderRules_Header{{Name: "x-port", Value: "8080", Action: configv1api.HeaderRules_Header_ACTION_APPEND}},
+						Remove: []string{"x-powered-by"},
+					},
+				},
+			},
+			{Port: 9090},
+		},
+	}
+
+	vhosts, err := generateVHosts(svc, nil)
+	require.NoError(t, err)
+	require.Len(t, vhosts, 3)
+
+	type header struct {
+		name   string
+		value  string
+		action corev3.HeaderValueOption_HeaderAppendAction
+	}
+	headers := func(options []*corev3.HeaderValueOption) []header {
+		out := make([]header, 0, len(options))
+		for _, option := range options {
+			out = append(out, header{option.GetHeader().GetKey(), option.GetHeader().GetValue(), option.GetAppendAction()})
+		}
+		return out
+	}
+
+	// the service rules apply to all ports, followed by the rules of the port
+	for _, vhost := range vhosts[:2] {
+		assert.Equal(t, []header{
+			{"x-peer", "%DOWNSTREAM_PEER_URI_SAN%", corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD},
+			{"x-env", "production", corev3.HeaderValueOption_ADD_IF_ABSENT},
+		}, headers(vhost.GetRequestHeadersToAdd()), vhost.GetName())
+		assert.Equal(t, []string{"x-internal"}, vhost.GetRequestHeadersToRemove(), vhost.GetName())
+	}
+	assert.Equal(t, []header{{"x-port", "8080", corev3.HeaderValueOption_APPEND_IF_EXISTS_OR_ADD}}, headers(vhosts[0].GetResponseHeadersToAdd()))
+	assert.Equal(t, []string{"server", "x-powered-by"}, vhosts[0].GetResponseHeadersToRemove())
+	assert.Empty(t, vhosts[1].GetResponseHeadersToAdd())
+	assert.Equal(t, []string{"server"}, vhosts[1].GetResponseHeadersToRemove())
+
+	// the catch all virtual host does not apply the rules of the service
+	assert.Empty(t, vhosts[2].GetRequestHeadersToRemove())
+	assert.Empty(t, vhosts[2].GetResponseHeadersToRemove())
+}
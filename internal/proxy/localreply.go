@@ -0,0 +1,20 @@
+package proxy
+
+import (
+	configv1 "github.com/bpalermo/maestro/api/config/v1"
+	"github.com/bpalermo/maestro/internal/proxy/envoy"
+	http_connection_managerv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+)
+
+func generateLocalReply(svc *configv1.Service) *http_connection_managerv3.LocalReplyConfig {
+	localReply := svc.GetLocalReply()
+	switch localReply.GetFormat() {
+	case configv1.LocalReply_FORMAT_JSON:
+		return envoy.LocalReplyConfig(envoy.JsonLocalReplyFormat(localReply.GetJsonFormat()))
+	case configv1.LocalReply_FORMAT_TEXT:
+		if format := envoy.TextLocalReplyFormat(localReply.GetTextFormat()); format != nil {
+			return envoy.LocalReplyConfig(format)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"testing"
+
+	configv1api "github.com/bpalermo/maestro/api/config/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateBootstrap_LocalReply(t *testing.T) {
+	tests := []struct {
+		name           string
+		localReply     *configv1api.LocalReply
+		expectedText   string
+		expectedFields map[string]string
+	}{
+		{
+			name: "default",
+		},
+		{
+			name:       "text without format",
+			localReply: &configv1api.LocalReply{Format: configv1api.LocalReply_FORMAT_TEXT},
+		},
+		{
+			name:         "text",
+			localReply:   &configv1api.LocalReply{Format: configv1api.LocalReply_FORMAT_TEXT, TextFormat: "%RESPONSE_CODE%: %LOCAL_REPLY_BODY%\n"},
+			expectedText: "%RESPONSE_CODE%: %LOCAL_REPLY_BODY%\n",
+		},
+		{
+			name:       "json with default envelope",
+			localReply: &configv1api.LocalReply{Format: configv1api.LocalReply_FORMAT_JSON},
+			expectedFields: map[string]string{
+				"code":       "%RESPONSE_CODE%",
+				"message":    "%LOCAL_REPLY_BODY%",
+				"details":    "%RESPONSE_CODE_DETAILS%",
+				"request_id": "%REQ(X-REQUEST-ID)%",
+			},
+		},
+		{
+			name:           "json",
+			localReply:     &configv1api.LocalReply{Format: configv1api.LocalReply_FORMAT_JSON, JsonFormat: map[string]string{"error": "%LOCAL_REPLY_BODY%"}},
+			expectedFields: map[string]string{"error": "%LOCAL_REPLY_BODY%"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := testService()
+			svc.LocalReply = tt.localReply
+
+			localReply := inboundHttpConnectionManager(t, generateTestBootstrap(t, svc)).GetLocalReplyConfig()
+			if tt.expectedText == "" && tt.expectedFields == nil {
+				assert.Nil(t, localReply)
+				return
+			}
+			require.NotNil(t, localReply)
+
+			format := localReply.GetBodyFormat()
+			assert.Equal(t, tt.expectedText, format.GetTextFormatSource().GetInlineString())
+			if tt.expectedFields == nil {
+				assert.Nil(t, format.GetJsonFormat())
+				return
+			}
+			fields := map[string]string{}
+			for key, value := range format.GetJsonFormat().GetFields() {
+				fields[key] = value.GetStringValue()
+			}
+			assert.Equal(t, tt.expectedFields, fields)
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"fmt"
+
+	configv1api "github.com/bpalermo/maestro/api/config/v1"
+	"github.com/bpalermo/maestro/internal/config/constants"
+	"github.com/bpalermo/maestro/internal/proxy/envoy"
+	"github.com/bpalermo/maestro/internal/util"
+	configv1 "github.com/bpalermo/maestro/pkg/apis/config/v1"
+	bootstrapv3 "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+)
+
+const (
+	// clusterDomain is the DNS domain of the Kubernetes cluster
+	clusterDomain = "cluster.local"
+)
+
+// GenerateOutboundBootstrap returns the bootstrap of the outbound listener of the proxies of a
+// ProxyConfig, and of the cluster forwarding their outbound traffic to its original destination.
+// The injector merges it into the bootstrap of the pods intercepting their traffic, so it is
+// always rendered in YAML. It is validated against the bootstrap of the ProxyConfig, whose
+// clusters it references.
+func GenerateOutboundBootstrap(proxyConfig *configv1.ProxyConfig, spiffeDomain string, opts ...BootstrapOption) (string, error) {
+	options := &bootstrapOptions{
+		spiffeDomain: spiffeDomain,
+		namespace:    proxyConfig.Namespace,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	resources, err := generateOutboundResources(proxyConfig, options)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate outbound bootstrap: %w", err)
+	}
+
+	b, err := generateBootstrap(proxyConfig, options)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate bootstrap: %w", err)
+	}
+	b.StaticResources.Listeners = append(b.StaticResources.Listeners, resources.Listeners...)
+	b.StaticResources.Clusters = append(b.StaticResources.Clusters, resources.Clusters...)
+	if err := validateBootstrap(b); err != nil {
+		return "", fmt.Errorf("invalid outbound bootstrap: %w", err)
+	}
+
+	out, err := util.MarshalProtoToYaml(&bootstrapv3.Bootstrap{StaticResources: resources})
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal outbound bootstrap: %w", err)
+	}
+	return string(out), nil
+}
+
+// generateOutboundResources returns the outbound listener and the passthrough cluster. The
+// outbound traffic detected as HTTP is routed by a connection manager, which traces it, when
+// upstreams have header rules or tracing is enabled, and is proxied as TCP otherwise. A nil ProxyConfig proxies
+// all the outbound traffic as TCP.
+func generateOutboundResources(proxyConfig *configv1.ProxyConfig, options *bootstrapOptions) (*bootstrapv3.Bootstrap_StaticResources, error) {
+	clusterName := constants.ClusterNamePassthrough.ToString()
+	args := &envoy.OutboundListenerArgs{
+		ClusterName: clusterName,
+	}
+	if proxyConfig != nil {
+		args.Tracing = generateTracing(proxyConfig.Spec.GetService(), options)
+		args.VirtualHosts = generateOutboundVHosts(options.namespace, proxyConfig.Spec.GetUpstreams())
+		if args.VirtualHosts == nil && args.Tracing != nil {
+			args.VirtualHosts = []*routev3.VirtualHost{outboundCatchAllVHost()}
+		}
+	}
+
+	listener, err := envoy.GenerateOutboundListener(args)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate outbound listener: %w", err)
+	}
+	cluster, err := envoy.OriginalDstCluster(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	return &bootstrapv3.Bootstrap_StaticResources{
+		Listeners: []*listenerv3.Listener{listener},
+		Clusters:  []*clusterv3.Cluster{cluster},
+	}, nil
+}
+
+// generateOutboundVHosts returns a virtual host per upstream with header rules, matching the
+// names the upstream Service is addressed by from the namespace of the ProxyConfig, followed by
+// the catch-all virtual host. It returns nil when no upstream has header rules. The rules of
+// upstreams listed more than once are applied in order.
+func generateOutboundVHosts(namespace string, upstreams *configv1api.Upstreams) []*routev3.VirtualHost {
+	vhosts := make([]*routev3.VirtualHost, 0)
+	byService := map[string]*routev3.VirtualHost{}
+	for _, upstream := range upstreams.GetUpstreamServices() {
+		if upstream.GetHeaders() == nil {
+			continue
+		}
+
+		upstreamNamespace := upstream.GetNamespace()
+		if upstreamNamespace == "" {
+			upstreamNamespace = namespace
+		}
+		name := fmt.Sprintf("outbound_%s_%s", upstreamNamespace, upstream.GetName())
+		vhost, ok := byService[name]
+		if !ok {
+			vhost = envoy.OutboundVirtualHost(name, serviceDomains(namespace, upstreamNamespace, upstream.GetName()), constants.ClusterNamePassthrough.ToString())
+			byService[name] = vhost
+			vhosts = append(vhosts, vhost)
+		}
+		applyHeaderRules(vhost, upstream.GetHeaders())
+	}
+	if len(vhosts) == 0 {
+		return nil
+	}
+
+	return append(vhosts, outboundCatchAllVHost())
+}
+
+func outboundCatchAllVHost() *routev3.VirtualHost {
+	return envoy.OutboundVirtualHost("outbound_catch_all", []string{"*"}, constants.ClusterNamePassthrough.ToString())
+}
+
+// serviceDomains returns the names a Service is resolved by from the given namespace.
+func serviceDomains(fromNamespace string, namespace string, name string) []string {
+	domains := make([]string, 0, 4)
+	if namespace == fromNamespace {
+		domains = append(domains, name)
+	}
+	qualified := name + "." + namespace
+	return append(domains, qualified, qualified+".svc", qualified+".svc."+clusterDomain)
+}
@@ -0,0 +1,213 @@
+package proxy
+
+import (
+	"testing"
+
+	"buf.build/go/protoyaml"
+	configv1api "github.com/bpalermo/maestro/api/config/v1"
+	"github.com/bpalermo/maestro/internal/config/constants"
+	configv1 "github.com/bpalermo/maestro/pkg/apis/config/v1"
+	bootstrapv3 "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	tracev3 "github.com/envoyproxy/go-control-plane/envoy/config/trace/v3"
+	http_connection_managerv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func generateTestOutboundBootstrap(t *testing.T, spec *configv1api.ProxyConfigSpec, opts ...BootstrapOption) *bootstrapv3.Bootstrap {
+	t.Helper()
+
+	proxyConfig := &configv1.ProxyConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders", Namespace: "shop"},
+		Spec:       spec,
+	}
+	outbound, err := GenerateOutboundBootstrap(proxyConfig, "", opts...)
+	require.NoError(t, err)
+
+	b := &bootstrapv3.Bootstrap{}
+	require.NoError(t, protoyaml.Unmarshal([]byte(outbound), b))
+	return b
+}
+
+// outboundListener returns the outbound listener of a bootstrap, and the HTTP connection manager
+// of its HTTP filter chain if any.
+func outboundListener(t *testing.T, b *bootstrapv3.Bootstrap) (*listenerv3.Listener, *http_connection_managerv3.HttpConnectionManager) {
+	t.Helper()
+
+	listeners := b.GetStaticResources().GetListeners()
+	require.Len(t, listeners, 1)
+	listener := listeners[0]
+	require.Equal(t, uint32(constants.ProxyOutboundPort), listener.GetAddress().GetSocketAddress().GetPortValue())
+
+	for _, filterChain := range listener.GetFilterChains() {
+		if filterChain.GetFilterChainMatch() == nil {
+			continue
+		}
+		hcm := &http_connection_managerv3.HttpConnectionManager{}
+		require.NoError(t, filterChain.GetFilters()[0].GetTypedConfig().UnmarshalTo(hcm))
+		return listener, hcm
+	}
+	return listener, nil
+}
+
+func TestGenerateOutboundBootstrap_TCP(t *testing.T) {
+	b := generateTestOutboundBootstrap(t, &configv1api.ProxyConfigSpec{
+		Service:   &configv1api.Service{Name: "orders"},
+		Upstreams: &configv1api.Upstreams{UpstreamServices: []*configv1api.Upstreams_UpstreamService{{Name: "inventory"}}},
+	})
+
+	assert.Nil(t, b.GetAdmin())
+	clusters := b.GetStaticResources().GetClusters()
+	require.Len(t, clusters, 1)
+	assert.Equal(t, constants.ClusterNamePassthrough.ToString(), clusters[0].GetName())
+
+	listener, hcm := outboundListener(t, b)
+	assert.Nil(t, hcm)
+	assert.Len(t, listener.GetFilterChains(), 1)
+	assert.Len(t, listener.GetListenerFilters(), 1)
+}
+
+func TestGenerateOutboundBootstrap_HeaderRules(t *testing.T) {
+	b := generateTestOutboundBootstrap(t, &configv1api.ProxyConfigSpec{
+		Service: &configv1api.Service{Name: "orders"},
+		Upstreams: &configv1api.Upstreams{
+			UpstreamServices: []*configv1api.Upstreams_UpstreamService{
+				{
+					Name: "inventory",
+					Headers: &configv1api.HeaderRules{
+						Request: &configv1api.HeaderRules_Rules{
+							Set:    []*configv1api.HeaderRules_Header{{Name: "x-caller", Value: "orders"}},
+							Remove: []string{"x-debug"},
+						},
+					},
+				},
+				{Name: "payments"},
+				{
+					Name:      "ledger",
+					Namespace: "finance",
+					Headers: &configv1api.HeaderRules{
+						Response: &configv1api.HeaderRules_Rules{Remove: []string{"server"}},
+					},
+				},
+				{
+					Name: "inventory",
+					Headers: &configv1api.HeaderRules{
+						Request: &configv1api.HeaderRules_Rules{Remove: []string{"x-trace"}},
+					},
+				},
+			},
+		},
+	})
+
+	listener, hcm := outboundListener(t, b)
+	require.NotNil(t, hcm)
+	require.Len(t, listener.GetFilterChains(), 2)
+	assert.Equal(t, []string{"http/1.0", "http/1.1", "h2c"}, listener.GetFilterChains()[0].GetFilterChainMatch().GetApplicationProtocols())
+	// the rest of the traffic is still proxied as TCP
+	assert.Nil(t, listener.GetFilterChains()[1].GetFilterChainMatch())
+	assert.True(t, listener.GetContinueOnListenerFiltersTimeout())
+	assert.Nil(t, hcm.GetTracing())
+	assert.True(t, hcm.GetStripAnyHostPort())
+
+	vhosts := hcm.GetRouteConfig().GetVirtualHosts()
+	require.Len(t, vhosts, 3)
+
+	inventory := vhosts[0]
+	assert.Equal(t, "outbound_shop_inventory", inventory.GetName())
+	assert.Equal(t, []string{"inventory", "inventory.shop", "inventory.shop.svc", "inventory.shop.svc.cluster.local"}, inventory.GetDomains())
+	require.Len(t, inventory.GetRequestHeadersToAdd(), 1)
+	assert.Equal(t, "x-caller", inventory.GetRequestHeadersToAdd()[0].GetHeader().GetKey())
+	assert.Equal(t, []string{"x-debug", "x-trace"}, inventory.GetRequestHeadersToRemove())
+
+	ledger := vhosts[1]
+	assert.Equal(t, "outbound_finance_ledger", ledger.GetName())
+	assert.Equal(t, []string{"ledger.finance", "ledger.finance.svc", "ledger.finance.svc.cluster.local"}, ledger.GetDomains())
+	assert.Equal(t, []string{"server"}, ledger.GetResponseHeadersToRemove())
+
+	catchAll := vhosts[2]
+	assert.Equal(t, []string{"*"}, catchAll.GetDomains())
+	assert.Empty(t, catchAll.GetRequestHeadersToAdd())
+	for _, vhost := range vhosts {
+		route := vhost.GetRoutes()[0].GetRoute()
+		assert.Equal(t, constants.ClusterNamePassthrough.ToString(), route.GetCluster())
+		// streams are not cut by the default route timeout
+		assert.Zero(t, route.GetTimeout().AsDuration())
+	}
+}
+
+func TestGenerateSidecarBootstrap_OutboundBootstrap(t *testing.T) {
+	proxyConfig := &configv1.ProxyConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders", Namespace: "shop"},
+		Spec: &configv1api.ProxyConfigSpec{
+			Upstreams: &configv1api.Upstreams{
+				UpstreamServices: []*configv1api.Upstreams_UpstreamService{
+					{
+						Name:    "inventory",
+						Headers: &configv1api.HeaderRules{Request: &configv1api.HeaderRules_Rules{Remove: []string{"x-debug"}}},
+					},
+				},
+			},
+		},
+	}
+	outbound, err := GenerateOutboundBootstrap(proxyConfig, "")
+	require.NoError(t, err)
+
+	t.Run("intercepted traffic", func(t *testing.T) {
+		bootstrap, err := GenerateSidecarBootstrap(nil, true, outbound)
+		require.NoError(t, err)
+
+		b := &bootstrapv3.Bootstrap{}
+		require.NoError(t, protoyaml.Unmarshal([]byte(bootstrap), b))
+		_, hcm := outboundListener(t, b)
+		require.NotNil(t, hcm)
+		assert.Equal(t, "outbound_shop_inventory", hcm.GetRouteConfig().GetVirtualHosts()[0].GetName())
+	})
+
+	t.Run("traffic not intercepted", func(t *testing.T) {
+		bootstrap, err := GenerateSidecarBootstrap(nil, false, outbound)
+		require.NoError(t, err)
+		assert.Empty(t, bootstrap)
+	})
+
+	t.Run("invalid outbound bootstrap", func(t *testing.T) {
+		_, err := GenerateSidecarBootstrap(nil, true, "static_resources: [")
+		assert.Error(t, err)
+	})
+}
+
+func TestGenerateOutboundBootstrap_Tracing(t *testing.T) {
+	svc := testService()
+	svc.Tracing = &configv1api.Tracing{RandomSampling: proto.Float64(10)}
+	spec := &configv1api.ProxyConfigSpec{Service: svc}
+
+	t.Run("without collector", func(t *testing.T) {
+		_, hcm := outboundListener(t, generateTestOutboundBootstrap(t, spec))
+		assert.Nil(t, hcm)
+	})
+
+	b := generateTestOutboundBootstrap(t, spec, WithTracingService(ServiceAddress{Host: "otel-collector.observability", Port: 4317}))
+	// the collector cluster is part of the bootstrap of the ProxyConfig
+	assert.Len(t, b.GetStaticResources().GetClusters(), 1)
+
+	listener, hcm := outboundListener(t, b)
+	require.NotNil(t, hcm)
+	// spans of outbound requests are client spans
+	assert.Equal(t, corev3.TrafficDirection_OUTBOUND, listener.GetTrafficDirection())
+
+	tracing := hcm.GetTracing()
+	require.NotNil(t, tracing)
+	assert.Equal(t, 10.0, tracing.GetRandomSampling().GetValue())
+	otel := &tracev3.OpenTelemetryConfig{}
+	require.NoError(t, tracing.GetProvider().GetTypedConfig().UnmarshalTo(otel))
+	assert.Equal(t, "orders", otel.GetServiceName())
+	assert.Equal(t, constants.ClusterNameTracing.ToString(), otel.GetGrpcService().GetEnvoyGrpc().GetClusterName())
+
+	// without header rules, all the HTTP traffic goes through the catch-all virtual host
+	vhosts := hcm.GetRouteConfig().GetVirtualHosts()
+	require.Len(t, vhosts, 1)
+	assert.Equal(t, []string{"*"}, vhosts[0].GetDomains())
+}
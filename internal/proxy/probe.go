@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"fmt"
+
+	"buf.build/go/protoyaml"
+	"github.com/bpalermo/maestro/internal/proxy/envoy"
+	"github.com/bpalermo/maestro/internal/util"
+	bootstrapv3 "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
+)
+
+// GenerateSidecarBootstrap returns the bootstrap of the listeners specific to a pod: the probe
+// listener serving its probes rewritten at injection, and the outbound listener receiving its
+// intercepted traffic when interceptTraffic is set. The outbound listener is the one of the
+// outbound bootstrap of the ProxyConfig when given, which the controller validated against the
+// bootstrap of the ProxyConfig, and a listener proxying all the traffic as TCP otherwise. It is
+// passed to the proxy of the pod with --config-yaml, which merges it into the bootstrap of the
+// ProxyConfig. It returns an empty bootstrap when the pod needs neither.
+func GenerateSidecarBootstrap(probes []envoy.ProbeRoute, interceptTraffic bool, outbound string) (string, error) {
+	resources := &bootstrapv3.Bootstrap_StaticResources{}
+
+	if len(probes) > 0 {
+		listener, err := envoy.GenerateProbeListener(probes)
+		if err != nil {
+			return "", fmt.Errorf("unable to generate probe listener: %w", err)
+		}
+		resources.Listeners = append(resources.Listeners, listener)
+		resources.Clusters = append(resources.Clusters, envoy.ProbeClusters(probes)...)
+	}
+
+	if interceptTraffic && outbound == "" {
+		outboundResources, err := generateOutboundResources(nil, &bootstrapOptions{})
+		if err != nil {
+			return "", err
+		}
+		resources.Listeners = append(resources.Listeners, outboundResources.Listeners...)
+		resources.Clusters = append(resources.Clusters, outboundResources.Clusters...)
+	}
+
+	b := &bootstrapv3.Bootstrap{StaticResources: resources}
+	if err := validateBootstrap(b); err != nil {
+		return "", fmt.Errorf("invalid sidecar bootstrap: %w", err)
+	}
+
+	if interceptTraffic && outbound != "" {
+		outboundBootstrap := &bootstrapv3.Bootstrap{}
+		if err := protoyaml.Unmarshal([]byte(outbound), outboundBootstrap); err != nil {
+			return "", fmt.Errorf("invalid outbound bootstrap: %w", err)
+		}
+		resources.Listeners = append(resources.Listeners, outboundBootstrap.GetStaticResources().GetListeners()...)
+		resources.Clusters = append(resources.Clusters, outboundBootstrap.GetStaticResources().GetClusters()...)
+	}
+
+	if len(resources.Listeners) == 0 {
+		return "", nil
+	}
+
+	out, err := util.MarshalProtoToYaml(b)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal sidecar bootstrap: %w", err)
+	}
+	return string(out), nil
+}
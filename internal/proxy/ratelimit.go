@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	configv1 "github.com/bpalermo/maestro/api/config/v1"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	rlsconfv3 "github.com/envoyproxy/go-control-plane/ratelimit/config/ratelimit/v3"
+)
+
+const (
+	// remoteAddressDescriptorKey is the descriptor key Envoy uses for the remote address action.
+	remoteAddressDescriptorKey = "remote_address"
+)
+
+var (
+	rateLimitUnits = map[configv1.RateLimit_Unit]rlsconfv3.RateLimitUnit{
+		configv1.RateLimit_UNIT_SECOND: rlsconfv3.RateLimitUnit_SECOND,
+		configv1.RateLimit_UNIT_MINUTE: rlsconfv3.RateLimitUnit_MINUTE,
+		configv1.RateLimit_UNIT_HOUR:   rlsconfv3.RateLimitUnit_HOUR,
+		configv1.RateLimit_UNIT_DAY:    rlsconfv3.RateLimitUnit_DAY,
+	}
+)
+
+// GenerateRateLimitConfig returns the rate limit service configuration named name for a
+// service of the given namespace, or nil if the service does not configure rate limits.
+func GenerateRateLimitConfig(name string, namespace string, svc *configv1.Service) *rlsconfv3.RateLimitConfig {
+	if svc.GetRateLimit() == nil {
+		return nil
+	}
+
+	config := &rlsconfv3.RateLimitConfig{
+		Name:   name,
+		Domain: qualifiedServiceName(namespace, svc),
+	}
+
+	for _, descriptor := range svc.GetRateLimit().GetDescriptors() {
+		descriptors := &config.Descriptors
+		var node *rlsconfv3.RateLimitDescriptor
+		for _, entry := range descriptor.GetEntries() {
+			node = findOrAddDescriptor(descriptors, descriptorKey(entry), entry.GetValue())
+			descriptors = &node.Descriptors
+		}
+		if node == nil {
+			continue
+		}
+		node.ShadowMode = descriptor.GetShadowMode()
+		node.RateLimit = &rlsconfv3.RateLimitPolicy{
+			Unit:            rateLimitUnits[descriptor.GetLimit().GetUnit()],
+			RequestsPerUnit: descriptor.GetLimit().GetRequestsPerUnit(),
+		}
+	}
+
+	return config
+}
+
+func findOrAddDescriptor(descriptors *[]*rlsconfv3.RateLimitDescriptor, key string, value string) *rlsconfv3.RateLimitDescriptor {
+	for _, descriptor := range *descriptors {
+		if descriptor.GetKey() == key && descriptor.GetValue() == value {
+			return descriptor
+		}
+	}
+
+	descriptor := &rlsconfv3.RateLimitDescriptor{
+		Key:   key,
+		Value: value,
+	}
+	*descriptors = append(*descriptors, descriptor)
+	return descriptor
+}
+
+func generateRateLimitActions(rateLimit *configv1.RateLimit) []*routev3.RateLimit {
+	rateLimits := make([]*routev3.RateLimit, 0, len(rateLimit.GetDescriptors()))
+	for _, descriptor := range rateLimit.GetDescriptors() {
+		actions := make([]*routev3.RateLimit_Action, 0, len(descriptor.GetEntries()))
+		for _, entry := range descriptor.GetEntries() {
+			actions = append(actions, rateLimitAction(entry))
+		}
+		rateLimits = append(rateLimits, &routev3.RateLimit{
+			Actions: actions,
+		})
+	}
+	return rateLimits
+}
+
+func rateLimitAction(entry *configv1.RateLimit_Entry) *routev3.RateLimit_Action {
+	switch entry.GetValueSpecifier().(type) {
+	case *configv1.RateLimit_Entry_HeaderName:
+		return &routev3.RateLimit_Action{
+			ActionSpecifier: &routev3.RateLimit_Action_RequestHeaders_{
+				RequestHeaders: &routev3.RateLimit_Action_RequestHeaders{
+					HeaderName:    entry.GetHeaderName(),
+					DescriptorKey: entry.GetKey(),
+				},
+			},
+		}
+	case *configv1.RateLimit_Entry_RemoteAddress:
+		return &routev3.RateLimit_Action{
+			ActionSpecifier: &routev3.RateLimit_Action_RemoteAddress_{
+				RemoteAddress: &routev3.RateLimit_Action_RemoteAddress{},
+			},
+		}
+	default:
+		return &routev3.RateLimit_Action{
+			ActionSpecifier: &routev3.RateLimit_Action_GenericKey_{
+				GenericKey: &routev3.RateLimit_Action_GenericKey{
+					DescriptorKey:   entry.GetKey(),
+					DescriptorValue: entry.GetValue(),
+				},
+			},
+		}
+	}
+}
+
+func descriptorKey(entry *configv1.RateLimit_Entry) string {
+	if entry.GetRemoteAddress() {
+		return remoteAddressDescriptorKey
+	}
+	return entry.GetKey()
+}
+
+func rateLimitEnabled(svc *configv1.Service, options *bootstrapOptions) bool {
+	return svc.GetRateLimit() != nil && options.rateLimitService != nil
+}
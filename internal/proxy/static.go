@@ -7,22 +7,27 @@ import (
 	bootstrapv3 "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
 	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 )
 
-func generateStaticResources(svc *configv1.Service, spiffeDomain string) *bootstrapv3.Bootstrap_StaticResources {
+func generateStaticResources(svc *configv1.Service, options *bootstrapOptions) (*bootstrapv3.Bootstrap_StaticResources, error) {
 	resources := &bootstrapv3.Bootstrap_StaticResources{}
 	if svc == nil {
-		return resources
+		return resources, nil
 	}
 
-	resources.Listeners = generateStaticListeners(svc, spiffeDomain)
-	resources.Clusters = generateStaticClusters(svc)
+	var err error
+	if resources.Listeners, err = generateStaticListeners(svc, options); err != nil {
+		return nil, err
+	}
+	if resources.Clusters, err = generateStaticClusters(svc, options); err != nil {
+		return nil, err
+	}
 
-	return resources
+	return resources, nil
 }
 
-func generateStaticListeners(svc *configv1.Service, spiffeDomain string) []*listenerv3.Listener {
-	servicePorts := svc.ServicePorts
+func generateStaticListeners(svc *configv1.Service, options *bootstrapOptions) ([]*listenerv3.Listener, error) {
 	enableAuthn := svc.GetAuthn() != nil
 
 	authzClusterName := ""
@@ -30,17 +35,94 @@ func generateStaticListeners(svc *configv1.Service, spiffeDomain string) []*list
 		authzClusterName = string(constants.ClusterNameLocalOPA)
 	}
 
+	var rateLimitArgs *envoy.RateLimitArgs
+	var rateLimits []*routev3.RateLimit
+	if rateLimitEnabled(svc, options) {
+		rateLimitArgs = &envoy.RateLimitArgs{
+			Domain:          qualifiedServiceName(options.namespace, svc),
+			ClusterName:     constants.ClusterNameRateLimit.ToString(),
+			FailureModeDeny: svc.GetRateLimit().GetFailureModeDeny(),
+		}
+		rateLimits = generateRateLimitActions(svc.GetRateLimit())
+	}
+
 	listeners := make([]*listenerv3.Listener, 0)
 
-	vhosts := generateVHosts(svc.Name, servicePorts)
+	vhosts, err := generateVHosts(svc, rateLimits)
+	if err != nil {
+		return nil, err
+	}
+	accessLogs, err := generateAccessLogs(svc, options)
+	if err != nil {
+		return nil, err
+	}
 
-	listeners = append(listeners, envoy.GenerateInboundHTTPListener(enableAuthn, authzClusterName, spiffeDomain, vhosts))
+	inbound, err := envoy.GenerateInboundHTTPListener(&envoy.InboundHTTPListenerArgs{
+		EnableAuthn:      enableAuthn,
+		AuthzClusterName: authzClusterName,
+		SpiffeDomain:     options.spiffeDomain,
+		VirtualHosts:     vhosts,
+		Fault:            generateFault(svc),
+		RateLimit:        rateLimitArgs,
+		AccessLogs:       accessLogs,
+		Tracing:          generateTracing(svc, options),
+		LocalReply:       generateLocalReply(svc),
+	})
+	if err != nil {
+		return nil, err
+	}
+	listeners = append(listeners, inbound)
 
-	return listeners
+	return listeners, nil
 }
 
-func generateStaticClusters(_ *configv1.Service) []*clusterv3.Cluster {
+func generateStaticClusters(svc *configv1.Service, options *bootstrapOptions) ([]*clusterv3.Cluster, error) {
 	clusters := make([]*clusterv3.Cluster, 0)
 
-	return clusters
+	// the application ports the inbound routes forward to
+	for _, port := range localServicePorts(svc) {
+		clusters = append(clusters, envoy.LocalCluster(localServiceName(port), port))
+	}
+
+	add := func(cluster *clusterv3.Cluster, err error) error {
+		if err != nil {
+			return err
+		}
+		clusters = append(clusters, cluster)
+		return nil
+	}
+
+	// the SPIRE agent serving the trust bundle the client certificates are validated with
+	if options.spiffeDomain != "" {
+		if err := add(envoy.PipeGrpcCluster(constants.ClusterNameLocalSpire.ToString(), constants.SpireAgentSocketPath)); err != nil {
+			return nil, err
+		}
+	}
+
+	// the OPA sidecar injected alongside the proxy
+	if svc.GetAuthz() != nil {
+		if err := add(envoy.GrpcCluster(constants.ClusterNameLocalOPA.ToString(), "127.0.0.1", constants.OPAGrpcPort)); err != nil {
+			return nil, err
+		}
+	}
+
+	if rateLimitEnabled(svc, options) {
+		if err := add(envoy.GrpcCluster(constants.ClusterNameRateLimit.ToString(), options.rateLimitService.Host, options.rateLimitService.Port)); err != nil {
+			return nil, err
+		}
+	}
+
+	if grpcAccessLogEnabled(svc, options) {
+		if err := add(envoy.GrpcCluster(constants.ClusterNameAccessLog.ToString(), options.accessLogService.Host, options.accessLogService.Port)); err != nil {
+			return nil, err
+		}
+	}
+
+	if tracingEnabled(svc, options) {
+		if err := add(envoy.GrpcCluster(constants.ClusterNameTracing.ToString(), options.tracingService.Host, options.tracingService.Port)); err != nil {
+			return nil, err
+		}
+	}
+
+	return clusters, nil
 }
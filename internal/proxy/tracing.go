@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	configv1 "github.com/bpalermo/maestro/api/config/v1"
+	"github.com/bpalermo/maestro/internal/config/constants"
+	"github.com/bpalermo/maestro/internal/proxy/envoy"
+	tracingv3 "github.com/envoyproxy/go-control-plane/envoy/type/tracing/v3"
+)
+
+func generateTracing(svc *configv1.Service, options *bootstrapOptions) *envoy.TracingArgs {
+	if !tracingEnabled(svc, options) {
+		return nil
+	}
+
+	tracing := svc.GetTracing()
+	return &envoy.TracingArgs{
+		ServiceName:     svc.GetName(),
+		ClusterName:     constants.ClusterNameTracing.ToString(),
+		RandomSampling:  tracing.RandomSampling,
+		ClientSampling:  tracing.ClientSampling,
+		OverallSampling: tracing.OverallSampling,
+		CustomTags:      generateCustomTags(tracing.GetCustomTags()),
+	}
+}
+
+func generateCustomTags(customTags []*configv1.Tracing_CustomTag) []*tracingv3.CustomTag {
+	tags := make([]*tracingv3.CustomTag, 0, len(customTags))
+	for _, customTag := range customTags {
+		switch t := customTag.GetType().(type) {
+		case *configv1.Tracing_CustomTag_Literal_:
+			tags = append(tags, envoy.LiteralCustomTag(customTag.GetTag(), t.Literal.GetValue()))
+		case *configv1.Tracing_CustomTag_Header_:
+			tags = append(tags, envoy.HeaderCustomTag(customTag.GetTag(), t.Header.GetName(), t.Header.GetDefaultValue()))
+		case *configv1.Tracing_CustomTag_Environment_:
+			tags = append(tags, envoy.EnvironmentCustomTag(customTag.GetTag(), t.Environment.GetName(), t.Environment.GetDefaultValue()))
+		}
+	}
+	return tags
+}
+
+func tracingEnabled(svc *configv1.Service, options *bootstrapOptions) bool {
+	return options.tracingService != nil && svc.GetTracing() != nil
+}
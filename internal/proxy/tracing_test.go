@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"testing"
+
+	configv1api "github.com/bpalermo/maestro/api/config/v1"
+	"github.com/bpalermo/maestro/internal/config/constants"
+	tracev3 "github.com/envoyproxy/go-control-plane/envoy/config/trace/v3"
+	tracingv3 "github.com/envoyproxy/go-control-plane/envoy/type/tracing/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGenerateBootstrap_Tracing(t *testing.T) {
+	svc := testService()
+	svc.Tracing = &configv1api.Tracing{
+		RandomSampling: proto.Float64(10),
+		ClientSampling: proto.Float64(50),
+		CustomTags: []*configv1api.Tracing_CustomTag{
+			{Tag: "env", Type: &configv1api.Tracing_CustomTag_Literal_{Literal: &configv1api.Tracing_CustomTag_Literal{Value: "production"}}},
+			{Tag: "tenant", Type: &configv1api.Tracing_CustomTag_Header_{Header: &configv1api.Tracing_CustomTag_Header{Name: "x-tenant", DefaultValue: "none"}}},
+			{Tag: "node", Type: &configv1api.Tracing_CustomTag_Environment_{Environment: &configv1api.Tracing_CustomTag_Environment{Name: "NODE_NAME"}}},
+		},
+	}
+
+	t.Run("without collector", func(t *testing.T) {
+		b := generateTestBootstrap(t, svc)
+		assert.Nil(t, inboundHttpConnectionManager(t, b).GetTracing())
+		for _, cluster := range b.GetStaticResources().GetClusters() {
+			assert.NotEqual(t, constants.ClusterNameTracing.ToString(), cluster.GetName())
+		}
+	})
+
+	b := generateTestBootstrap(t, svc, WithTracingService(ServiceAddress{Host: "otel-collector.observability", Port: 4317}))
+
+	var collector bool
+	for _, cluster := range b.GetStaticResources().GetClusters() {
+		if cluster.GetName() != constants.ClusterNameTracing.ToString() {
+			continue
+		}
+		collector = true
+		address := cluster.GetLoadAssignment().GetEndpoints()[0].GetLbEndpoints()[0].GetEndpoint().GetAddress().GetSocketAddress()
+		assert.Equal(t, "otel-collector.observability", address.GetAddress())
+		assert.Equal(t, uint32(4317), address.GetPortValue())
+		assert.Contains(t, cluster.GetTypedExtensionProtocolOptions(), "envoy.extensions.upstreams.http.v3.HttpProtocolOptions")
+	}
+	assert.True(t, collector, "OpenTelemetry collector cluster not found")
+
+	tracing := inboundHttpConnectionManager(t, b).GetTracing()
+	require.NotNil(t, tracing)
+	assert.Equal(t, 10.0, tracing.GetRandomSampling().GetValue())
+	assert.Equal(t, 50.0, tracing.GetClientSampling().GetValue())
+	// unset sampling keeps the Envoy default
+	assert.Nil(t, tracing.GetOverallSampling())
+
+	otel := &tracev3.OpenTelemetryConfig{}
+	require.NoError(t, tracing.GetProvider().GetTypedConfig().UnmarshalTo(otel))
+	assert.Equal(t, "orders", otel.GetServiceName())
+	assert.Equal(t, constants.ClusterNameTracing.ToString(), otel.GetGrpcService().GetEnvoyGrpc().GetClusterName())
+
+	expectedTags := []*tracingv3.CustomTag{
+		{Tag: "env", Type: &tracingv3.CustomTag_Literal_{Literal: &tracingv3.CustomTag_Literal{Value: "production"}}},
+		{Tag: "tenant", Type: &tracingv3.CustomTag_RequestHeader{RequestHeader: &tracingv3.CustomTag_Header{Name: "x-tenant", DefaultValue: "none"}}},
+		{Tag: "node", Type: &tracingv3.CustomTag_Environment_{Environment: &tracingv3.CustomTag_Environment{Name: "NODE_NAME"}}},
+	}
+	require.Len(t, tracing.GetCustomTags(), len(expectedTags))
+	for i, tag := range expectedTags {
+		assert.True(t, proto.Equal(tag, tracing.GetCustomTags()[i]), "custom tag %s", tag.GetTag())
+	}
+}
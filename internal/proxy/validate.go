@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+
+	bootstrapv3 "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	tcp_proxyv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// clusterReference is a cluster referenced by an Envoy proto of a bootstrap.
+type clusterReference struct {
+	// referrer describes what references the cluster
+	referrer string
+	cluster  string
+}
+
+// validateBootstrap validates a bootstrap and the Envoy protos packed in its typed configs, and
+// checks that the clusters referenced by routes, TCP proxies and gRPC services, such as SDS
+// config sources, are defined.
+func validateBootstrap(bootstrap *bootstrapv3.Bootstrap) error {
+	if err := validate(bootstrap); err != nil {
+		return err
+	}
+
+	var references []clusterReference
+	if err := walk(bootstrap.ProtoReflect(), &references); err != nil {
+		return err
+	}
+
+	clusters := map[string]bool{}
+	for _, cluster := range bootstrap.GetStaticResources().GetClusters() {
+		clusters[cluster.GetName()] = true
+	}
+
+	var errs []error
+	for _, reference := range references {
+		if !clusters[reference.cluster] {
+			errs = append(errs, fmt.Errorf("%s references unknown cluster %q", reference.referrer, reference.cluster))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validate runs the validation rules of an Envoy proto and the protos it embeds, excluding the
+// ones packed in typed configs.
+func validate(message proto.Message) error {
+	v, ok := message.(interface{ ValidateAll() error })
+	if !ok {
+		return nil
+	}
+	if err := v.ValidateAll(); err != nil {
+		return fmt.Errorf("invalid %s: %w", message.ProtoReflect().Descriptor().FullName(), err)
+	}
+	return nil
+}
+
+// walk validates the protos packed in the typed configs of a message, recursively, and collects
+// the clusters referenced.
+func walk(message protoreflect.Message, references *[]clusterReference) error {
+	switch m := message.Interface().(type) {
+	case *anypb.Any:
+		embedded, err := m.UnmarshalNew()
+		if err != nil {
+			return fmt.Errorf("unable to unpack %s: %w", m.GetTypeUrl(), err)
+		}
+		if err := validate(embedded); err != nil {
+			return err
+		}
+		return walk(embedded.ProtoReflect(), references)
+	case *routev3.RouteAction:
+		if cluster := m.GetCluster(); cluster != "" {
+			*references = append(*references, clusterReference{referrer: "route", cluster: cluster})
+		}
+		for _, weighted := range m.GetWeightedClusters().GetClusters() {
+			*references = append(*references, clusterReference{referrer: "route", cluster: weighted.GetName()})
+		}
+	case *tcp_proxyv3.TcpProxy:
+		if cluster := m.GetCluster(); cluster != "" {
+			*references = append(*references, clusterReference{referrer: "TCP proxy " + m.GetStatPrefix(), cluster: cluster})
+		}
+	case *corev3.GrpcService_EnvoyGrpc:
+		*references = append(*references, clusterReference{referrer: "gRPC service", cluster: m.GetClusterName()})
+	}
+
+	var err error
+	message.Range(func(fd protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		switch {
+		case fd.IsMap():
+			if fd.MapValue().Message() == nil {
+				return true
+			}
+			value.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+				err = walk(v.Message(), references)
+				return err == nil
+			})
+		case fd.Message() == nil:
+			return true
+		case fd.IsList():
+			list := value.List()
+			for i := 0; i < list.Len() && err == nil; i++ {
+				err = walk(list.Get(i).Message(), references)
+			}
+		default:
+			err = walk(value.Message(), references)
+		}
+		return err == nil
+	})
+	return err
+}
@@ -0,0 +1,267 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"buf.build/go/protoyaml"
+	configv1api "github.com/bpalermo/maestro/api/config/v1"
+	"github.com/bpalermo/maestro/internal/config/constants"
+	"github.com/bpalermo/maestro/internal/proxy/envoy"
+	configv1 "github.com/bpalermo/maestro/pkg/apis/config/v1"
+	bootstrapv3 "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	http_connection_managerv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// generateTestBootstrap generates the bootstrap of a service and parses it back.
+func generateTestBootstrap(t *testing.T, svc *configv1api.Service, opts ...BootstrapOption) *bootstrapv3.Bootstrap {
+	t.Helper()
+
+	proxyConfig := &configv1.ProxyConfig{Spec: &configv1api.ProxyConfigSpec{Service: svc}}
+	bootstrap, err := GenerateBootstrap(proxyConfig, "", opts...)
+	require.NoError(t, err)
+
+	b := &bootstrapv3.Bootstrap{}
+	require.NoError(t, protoyaml.Unmarshal([]byte(bootstrap), b))
+	return b
+}
+
+// inboundHttpConnectionManager returns the HTTP connection manager of the inbound listener of a bootstrap.
+func inboundHttpConnectionManager(t *testing.T, b *bootstrapv3.Bootstrap) *http_connection_managerv3.HttpConnectionManager {
+	t.Helper()
+
+	for _, listener := range b.GetStaticResources().GetListeners() {
+		if listener.GetName() != "inbound_http" {
+			continue
+		}
+		hcm := &http_connection_managerv3.HttpConnectionManager{}
+		require.NoError(t, listener.GetFilterChains()[0].GetFilters()[0].GetTypedConfig().UnmarshalTo(hcm))
+		return hcm
+	}
+	require.FailNow(t, "inbound listener not found")
+	return nil
+}
+
+// testService returns a service with a single port.
+func testService() *configv1api.Service {
+	return &configv1api.Service{
+		Name: "orders",
+		ServicePorts: []*configv1api.Service_ServicePort{{
+			Port:                 8080,
+			HealthCheckSpecifier: &configv1api.Service_ServicePort_HttpHealthCheck_{HttpHealthCheck: &configv1api.Service_ServicePort_HttpHealthCheck{Path: "/"}},
+		}},
+	}
+}
+
+func TestGenerateBootstrap(t *testing.T) {
+	servicePort := func(port uint32) *configv1api.Service_ServicePort {
+		return &configv1api.Service_ServicePort{
+			Port: port,
+			HealthCheckSpecifier: &configv1api.Service_ServicePort_HttpHealthCheck_{
+				HttpHealthCheck: &configv1api.Service_ServicePort_HttpHealthCheck{Path: "/"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name             string
+		service          *configv1api.Service
+		spiffeDomain     string
+		expectedClusters []string
+	}{
+		{
+			name:             "service ports",
+			service:          &configv1api.Service{Name: "orders", ServicePorts: []*configv1api.Service_ServicePort{servicePort(8080), servicePort(9090)}},
+			expectedClusters: []string{"local_service_8080", "local_service_9090"},
+		},
+		{
+			name: "catch all forward",
+			service: &configv1api.Service{
+				Name:         "orders",
+				ServicePorts: []*configv1api.Service_ServicePort{servicePort(8080), servicePort(9090)},
+				CatchAll:     &configv1api.CatchAll{Action: configv1api.CatchAll_ACTION_FORWARD, ForwardPort: 9090},
+			},
+			expectedClusters: []string{"local_service_8080", "local_service_9090"},
+		},
+		{
+			name:             "spiffe",
+			service:          &configv1api.Service{Name: "orders", ServicePorts: []*configv1api.Service_ServicePort{servicePort(8080)}, Authz: &configv1api.AuthZ{PolicyConfigMap: "orders-policy"}},
+			spiffeDomain:     "cluster.local",
+			expectedClusters: []string{"local_service_8080", constants.ClusterNameLocalSpire.ToString(), constants.ClusterNameLocalOPA.ToString()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyConfig := &configv1.ProxyConfig{Spec: &configv1api.ProxyConfigSpec{Service: tt.service}}
+
+			bootstrap, err := GenerateBootstrap(proxyConfig, tt.spiffeDomain)
+			require.NoError(t, err)
+			for _, cluster := range tt.expectedClusters {
+				assert.Contains(t, bootstrap, "name: "+cluster)
+			}
+		})
+	}
+}
+
+func TestGenerateBootstrap_RateLimitDomain(t *testing.T) {
+	proxyConfig := &configv1.ProxyConfig{Spec: &configv1api.ProxyConfigSpec{Service: &configv1api.Service{
+		Name: "orders",
+		ServicePorts: []*configv1api.Service_ServicePort{{
+			Port:                 8080,
+			HealthCheckSpecifier: &configv1api.Service_ServicePort_HttpHealthCheck_{HttpHealthCheck: &configv1api.Service_ServicePort_HttpHealthCheck{Path: "/"}},
+		}},
+		RateLimit: &configv1api.RateLimit{Descriptors: []*configv1api.RateLimit_Descriptor{{
+			Entries: []*configv1api.RateLimit_Entry{{ValueSpecifier: &configv1api.RateLimit_Entry_RemoteAddress{RemoteAddress: true}}},
+			Limit:   &configv1api.RateLimit_Limit{RequestsPerUnit: 10, Unit: configv1api.RateLimit_UNIT_SECOND},
+		}}},
+	}}}
+	proxyConfig.Namespace = "payments"
+
+	bootstrap, err := GenerateBootstrap(proxyConfig, "", WithRateLimitService(ServiceAddress{Host: "maestro", Port: 8081}))
+	require.NoError(t, err)
+	assert.Contains(t, bootstrap, "domain: payments/orders")
+	assert.Equal(t, "payments/orders", GenerateRateLimitConfig("payments/orders", proxyConfig.Namespace, proxyConfig.Spec.GetService()).GetDomain())
+}
+
+func TestGenerateBootstrap_JSON(t *testing.T) {
+	proxyConfig := &configv1.ProxyConfig{Spec: &configv1api.ProxyConfigSpec{Service: &configv1api.Service{
+		Name: "orders",
+		ServicePorts: []*configv1api.Service_ServicePort{{
+			Port:                 8080,
+			HealthCheckSpecifier: &configv1api.Service_ServicePort_HttpHealthCheck_{HttpHealthCheck: &configv1api.Service_ServicePort_HttpHealthCheck{Path: "/"}},
+		}},
+	}}}
+
+	bootstrap, err := GenerateBootstrap(proxyConfig, "", WithFormat(configv1api.Bootstrap_FORMAT_JSON))
+	require.NoError(t, err)
+
+	b := &bootstrapv3.Bootstrap{}
+	require.NoError(t, protojson.Unmarshal([]byte(bootstrap), b))
+	assert.Equal(t, uint32(constants.ProxyAdminPort), b.GetAdmin().GetAddress().GetSocketAddress().GetPortValue())
+	assert.Contains(t, bootstrap, "\n  \"admin\": {\n")
+}
+
+func TestGenerateSidecarBootstrap(t *testing.T) {
+	probes := []envoy.ProbeRoute{
+		{Path: "/maestro/probes/app/livenessProbe", OriginalPath: "/healthz", Port: 8080},
+		{Path: "/maestro/probes/app/readinessProbe", Port: 8080},
+		{Path: "/maestro/probes/sidecar/livenessProbe", OriginalPath: "/live", Port: 9090},
+	}
+	bootstrap, err := GenerateSidecarBootstrap(probes, false, "")
+	require.NoError(t, err)
+
+	b := &bootstrapv3.Bootstrap{}
+	require.NoError(t, protoyaml.Unmarshal([]byte(bootstrap), b))
+	assert.Nil(t, b.GetAdmin())
+
+	var clusters []string
+	for _, cluster := range b.GetStaticResources().GetClusters() {
+		clusters = append(clusters, cluster.GetName())
+	}
+	assert.Equal(t, []string{"app_probe_8080", "app_probe_9090"}, clusters)
+
+	listeners := b.GetStaticResources().GetListeners()
+	require.Len(t, listeners, 1)
+	assert.Equal(t, uint32(constants.ProxyProbePort), listeners[0].GetAddress().GetSocketAddress().GetPortValue())
+
+	hcm := &http_connection_managerv3.HttpConnectionManager{}
+	require.NoError(t, listeners[0].GetFilterChains()[0].GetFilters()[0].GetTypedConfig().UnmarshalTo(hcm))
+	routes := hcm.GetRouteConfig().GetVirtualHosts()[0].GetRoutes()
+	require.Len(t, routes, 4)
+	for i, expected := range []struct {
+		path    string
+		rewrite string
+		cluster string
+	}{
+		{"/maestro/probes/app/livenessProbe", "/healthz", "app_probe_8080"},
+		{"/maestro/probes/app/readinessProbe", "/", "app_probe_8080"},
+		{"/maestro/probes/sidecar/livenessProbe", "/live", "app_probe_9090"},
+	} {
+		assert.Equal(t, expected.path, routes[i].GetMatch().GetPath())
+		assert.Equal(t, expected.rewrite, routes[i].GetRoute().GetPrefixRewrite())
+		assert.Equal(t, expected.cluster, routes[i].GetRoute().GetCluster())
+	}
+	// any other request is rejected
+	assert.Equal(t, uint32(http.StatusForbidden), routes[3].GetDirectResponse().GetStatus())
+
+	t.Run("intercepted traffic", func(t *testing.T) {
+		bootstrap, err := GenerateSidecarBootstrap(probes, true, "")
+		require.NoError(t, err)
+
+		b := &bootstrapv3.Bootstrap{}
+		require.NoError(t, protoyaml.Unmarshal([]byte(bootstrap), b))
+		listeners := b.GetStaticResources().GetListeners()
+		require.Len(t, listeners, 2)
+		assert.Equal(t, uint32(constants.ProxyOutboundPort), listeners[1].GetAddress().GetSocketAddress().GetPortValue())
+		clusters := b.GetStaticResources().GetClusters()
+		assert.Equal(t, constants.ClusterNamePassthrough.ToString(), clusters[len(clusters)-1].GetName())
+	})
+
+	t.Run("nothing specific to the pod", func(t *testing.T) {
+		bootstrap, err := GenerateSidecarBootstrap(nil, false, "")
+		require.NoError(t, err)
+		assert.Empty(t, bootstrap)
+	})
+}
+
+func TestGenerateBootstrap_NoOutboundListener(t *testing.T) {
+	b := generateTestBootstrap(t, &configv1api.Service{Name: "app"})
+	for _, listener := range b.GetStaticResources().GetListeners() {
+		assert.NotEqual(t, uint32(constants.ProxyOutboundPort), listener.GetAddress().GetSocketAddress().GetPortValue())
+	}
+	for _, cluster := range b.GetStaticResources().GetClusters() {
+		assert.NotEqual(t, constants.ClusterNamePassthrough.ToString(), cluster.GetName())
+	}
+}
+
+func TestValidateBootstrap(t *testing.T) {
+	listener, err := envoy.GenerateProbeListener([]envoy.ProbeRoute{{Path: "/maestro/probes/app/livenessProbe", Port: 8080}})
+	require.NoError(t, err)
+
+	bootstrap := func(clusters ...*clusterv3.Cluster) *bootstrapv3.Bootstrap {
+		return &bootstrapv3.Bootstrap{
+			StaticResources: &bootstrapv3.Bootstrap_StaticResources{
+				Listeners: []*listenerv3.Listener{listener},
+				Clusters:  clusters,
+			},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		bootstrap *bootstrapv3.Bootstrap
+		wantErr   string
+	}{
+		{
+			name:      "valid",
+			bootstrap: bootstrap(envoy.LocalCluster("app_probe_8080", 8080)),
+		},
+		{
+			name:      "unknown cluster",
+			bootstrap: bootstrap(),
+			wantErr:   `references unknown cluster "app_probe_8080"`,
+		},
+		{
+			name:      "invalid proto",
+			bootstrap: bootstrap(envoy.LocalCluster("app_probe_8080", 8080), envoy.LocalCluster("", 8080)),
+			wantErr:   "invalid envoy.config.bootstrap.v3.Bootstrap",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateBootstrap(tt.bootstrap)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
@@ -2,6 +2,8 @@ package proxy
 
 import (
 	"fmt"
+	"net/http"
+	"slices"
 
 	configv1 "github.com/bpalermo/maestro/api/config/v1"
 	"github.com/bpalermo/maestro/internal/proxy/envoy"
@@ -10,48 +12,87 @@ import (
 	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 )
 
-func generateVHosts(serviceName string, servicePorts []*configv1.Service_ServicePort) []*routev3.VirtualHost {
-	hostname := util.HostnameFromServiceName(serviceName)
+func generateVHosts(svc *configv1.Service, rateLimits []*routev3.RateLimit) ([]*routev3.VirtualHost, error) {
+	hostname := util.HostnameFromServiceName(svc.GetName())
 
 	vhosts := make([]*routev3.VirtualHost, 0)
-	for _, svcPort := range servicePorts {
-		name := fmt.Sprintf("local_service_%d", svcPort.Port)
+	for _, svcPort := range svc.GetServicePorts() {
+		name := localServiceName(svcPort.Port)
 		sni := fmt.Sprintf("%s_%d", hostname, svcPort.Port)
-		vhosts = append(vhosts, envoy.VirtualHost(name, sni))
+		vhost := envoy.VirtualHost(name, sni)
+		vhost.RateLimits = rateLimits
+		applyHeaderRules(vhost, svc.GetHeaders(), svcPort.GetHeaders())
+		if svcPort.GetFault() != nil {
+			if err := envoy.SetVirtualHostFault(vhost, httpFault(svcPort.GetFault())); err != nil {
+				return nil, err
+			}
+		}
+		vhosts = append(vhosts, vhost)
 	}
 
 	// catch all
-	vhosts = append(vhosts, catchAllVHost())
+	vhosts = append(vhosts, catchAllVHost(svc.GetCatchAll()))
 
-	return vhosts
+	return vhosts, nil
 }
 
-func catchAllVHost() *routev3.VirtualHost {
+func catchAllVHost(catchAll *configv1.CatchAll) *routev3.VirtualHost {
+	route := &routev3.Route{
+		Match: &routev3.RouteMatch{
+			PathSpecifier: &routev3.RouteMatch_Prefix{
+				Prefix: "/",
+			},
+		},
+		RequestHeadersToAdd: []*corev3.HeaderValueOption{
+			envoy.HeaderValueOption("x-maestro-catch-all", "true", corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD),
+		},
+	}
+
+	switch catchAll.GetAction() {
+	case configv1.CatchAll_ACTION_FORWARD:
+		route.Action = &routev3.Route_Route{
+			Route: &routev3.RouteAction{
+				ClusterSpecifier: &routev3.RouteAction_Cluster{
+					Cluster: localServiceName(catchAll.GetForwardPort()),
+				},
+			},
+		}
+	case configv1.CatchAll_ACTION_MISDIRECTED_REQUEST:
+		route.Action = directResponse(http.StatusMisdirectedRequest)
+	default:
+		route.Action = directResponse(http.StatusNotFound)
+	}
+
 	return &routev3.VirtualHost{
 		Name:    "catch_all",
 		Domains: []string{"*"},
-		Routes: []*routev3.Route{
-			{
-				Match: &routev3.RouteMatch{
-					PathSpecifier: &routev3.RouteMatch_Prefix{
-						Prefix: "/",
-					},
-				},
-				RequestHeadersToAdd: []*corev3.HeaderValueOption{
-					{
-						AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
-						Header: &corev3.HeaderValue{
-							Key:   "x-maestro-catch-all",
-							Value: "true",
-						},
-					},
-				},
-				Action: &routev3.Route_DirectResponse{
-					DirectResponse: &routev3.DirectResponseAction{
-						Status: 404,
-					},
-				},
-			},
+		Routes:  []*routev3.Route{route},
+	}
+}
+
+func directResponse(status uint32) *routev3.Route_DirectResponse {
+	return &routev3.Route_DirectResponse{
+		DirectResponse: &routev3.DirectResponseAction{
+			Status: status,
 		},
 	}
 }
+
+// localServicePorts returns the application ports routed to, the service ports and the port the
+// catch all virtual host forwards to.
+func localServicePorts(svc *configv1.Service) []uint32 {
+	ports := make([]uint32, 0, len(svc.GetServicePorts())+1)
+	for _, svcPort := range svc.GetServicePorts() {
+		ports = append(ports, svcPort.GetPort())
+	}
+	if svc.GetCatchAll().GetAction() == configv1.CatchAll_ACTION_FORWARD {
+		ports = append(ports, svc.GetCatchAll().GetForwardPort())
+	}
+
+	slices.Sort(ports)
+	return slices.Compact(ports)
+}
+
+func localServiceName(port uint32) string {
+	return fmt.Sprintf("local_service_%d", port)
+}
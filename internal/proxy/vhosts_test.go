@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	configv1api "github.com/bpalermo/maestro/api/config/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateBootstrap_CatchAll(t *testing.T) {
+	tests := []struct {
+		name            string
+		catchAll        *configv1api.CatchAll
+		expectedStatus  uint32
+		expectedCluster string
+	}{
+		{
+			name:           "default",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "not found",
+			catchAll:       &configv1api.CatchAll{Action: configv1api.CatchAll_ACTION_NOT_FOUND},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "misdirected request",
+			catchAll:       &configv1api.CatchAll{Action: configv1api.CatchAll_ACTION_MISDIRECTED_REQUEST},
+			expectedStatus: http.StatusMisdirectedRequest,
+		},
+		{
+			name:            "forward",
+			catchAll:        &configv1api.CatchAll{Action: configv1api.CatchAll_ACTION_FORWARD, ForwardPort: 9090},
+			expectedCluster: "local_service_9090",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := testService()
+			svc.CatchAll = tt.catchAll
+			b := generateTestBootstrap(t, svc)
+
+			vhosts := inboundHttpConnectionManager(t, b).GetRouteConfig().GetVirtualHosts()
+			require.NotEmpty(t, vhosts)
+			catchAll := vhosts[len(vhosts)-1]
+			assert.Equal(t, "catch_all", catchAll.GetName())
+			assert.Equal(t, []string{"*"}, catchAll.GetDomains())
+			require.Len(t, catchAll.GetRoutes(), 1)
+
+			route := catchAll.GetRoutes()[0]
+			assert.Equal(t, tt.expectedStatus, route.GetDirectResponse().GetStatus())
+			assert.Equal(t, tt.expectedCluster, route.GetRoute().GetCluster())
+
+			var clusters []string
+			for _, cluster := range b.GetStaticResources().GetClusters() {
+				clusters = append(clusters, cluster.GetName())
+			}
+			assert.Contains(t, clusters, "local_service_8080")
+			if tt.expectedCluster != "" {
+				assert.Contains(t, clusters, tt.expectedCluster)
+			}
+		})
+	}
+}
@@ -1,26 +1,33 @@
 package util
 
 import (
+	"bytes"
+	"encoding/json"
+
 	"buf.build/go/protoyaml"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/types/known/anypb"
 )
 
-func MustMarshalProtoToYaml(message proto.Message) []byte {
+func MarshalProtoToYaml(message proto.Message) ([]byte, error) {
 	options := protoyaml.MarshalOptions{
 		Indent: 2,
 	}
-	b, err := options.Marshal(message)
-	if err != nil {
-		panic(err)
-	}
-	return b
+	return options.Marshal(message)
 }
 
-func MustAny(message proto.Message) *anypb.Any {
-	pb, err := anypb.New(message)
+// MarshalProtoToJSON marshals a message to indented JSON. The whitespace randomly added by
+// protojson is dropped, so the output is stable across builds.
+func MarshalProtoToJSON(message proto.Message) ([]byte, error) {
+	out, err := protojson.Marshal(message)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, out, "", "  "); err != nil {
+		return nil, err
 	}
-	return pb
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
 }
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricsNamespace = "maestro"
+	metricsSubsystem = "access_log"
+)
+
+type accessLogMetrics struct {
+	httpRequests   *prometheus.CounterVec
+	tcpConnections *prometheus.CounterVec
+	bytesReceived  *prometheus.CounterVec
+	bytesSent      *prometheus.CounterVec
+}
+
+func newAccessLogMetrics(registerer prometheus.Registerer) (*accessLogMetrics, error) {
+	m := &accessLogMetrics{
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "http_requests_total",
+			Help:      "Total number of HTTP requests reported by proxies.",
+		}, []string{"service", "method", "response_code"}),
+		tcpConnections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "tcp_connections_total",
+			Help:      "Total number of TCP connections reported by proxies.",
+		}, []string{"service"}),
+		bytesReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "received_bytes_total",
+			Help:      "Total number of bytes received from downstream reported by proxies.",
+		}, []string{"service"}),
+		bytesSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "sent_bytes_total",
+			Help:      "Total number of bytes sent to downstream reported by proxies.",
+		}, []string{"service"}),
+	}
+
+	for _, collector := range []prometheus.Collector{m.httpRequests, m.tcpConnections, m.bytesReceived, m.bytesSent} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	configv1 "github.com/bpalermo/maestro/pkg/apis/config/v1"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	accesslogdatav3 "github.com/envoyproxy/go-control-plane/envoy/data/accesslog/v3"
+	accesslogv3 "github.com/envoyproxy/go-control-plane/envoy/service/accesslog/v3"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	loggerName = "access-log-server"
+
+	defaultServerNetwork = "tcp"
+	defaultServerAddress = ":8082"
+
+	unknownService = "unknown"
+)
+
+// AccessLogServer is an Envoy access log service (ALS) receiving the access logs streamed by
+// proxies. Entries are written as structured logs and counted per service, the service being
+// the log name set by the proxy, the service name qualified by its namespace for maestro proxies.
+// The log name is sent by unauthenticated clients, so it is only used when it names the service of
+// a ProxyConfig, and counted as unknown otherwise.
+type AccessLogServer struct {
+	accesslogv3.UnimplementedAccessLogServiceServer
+
+	log logr.Logger
+
+	// proxyConfigs reads the ProxyConfig resources the log names are checked against. Every log
+	// name is accepted when nil.
+	proxyConfigs client.Reader
+
+	network string
+	address string
+
+	registerer prometheus.Registerer
+	metrics    *accessLogMetrics
+
+	grpcServer *grpc.Server
+
+	shutdownTimeout time.Duration
+}
+
+type AccessLogServerOption func(*AccessLogServer)
+
+func NewAccessLogServer(log logr.Logger, opts ...AccessLogServerOption) (*AccessLogServer, error) {
+	srv := &AccessLogServer{
+		log:        log.WithName(loggerName),
+		network:    defaultServerNetwork,
+		address:    defaultServerAddress,
+		registerer: metrics.Registry,
+	}
+
+	for _, option := range opts {
+		option(srv)
+	}
+
+	m, err := newAccessLogMetrics(srv.registerer)
+	if err != nil {
+		return nil, err
+	}
+	srv.metrics = m
+
+	srv.grpcServer = grpc.NewServer()
+	accesslogv3.RegisterAccessLogServiceServer(srv.grpcServer, srv)
+
+	return srv, nil
+}
+
+// WithAddress sets the address the server listens on.
+func WithAddress(address string) AccessLogServerOption {
+	return func(s *AccessLogServer) {
+		s.address = address
+	}
+}
+
+// WithProxyConfigs sets the reader of the ProxyConfig resources whose services are accepted as log names.
+func WithProxyConfigs(reader client.Reader) AccessLogServerOption {
+	return func(s *AccessLogServer) {
+		s.proxyConfigs = reader
+	}
+}
+
+// WithRegisterer sets the registerer of the access log metrics. Defaults to the controller-runtime registry.
+func WithRegisterer(registerer prometheus.Registerer) AccessLogServerOption {
+	return func(s *AccessLogServer) {
+		s.registerer = registerer
+	}
+}
+
+func WithShutdownTimeout(timeout time.Duration) AccessLogServerOption {
+	return func(s *AccessLogServer) {
+		s.shutdownTimeout = timeout
+	}
+}
+
+func (s *AccessLogServer) StreamAccessLogs(stream accesslogv3.AccessLogService_StreamAccessLogsServer) error {
+	// Only the first message of a stream carries the identifier.
+	service := unknownService
+	node := ""
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&accesslogv3.StreamAccessLogsResponse{})
+		}
+		if err != nil {
+			return err
+		}
+
+		if identifier := msg.GetIdentifier(); identifier != nil {
+			service = s.serviceName(stream.Context(), identifier.GetLogName())
+			node = identifier.GetNode().GetId()
+		}
+
+		for _, entry := range msg.GetHttpLogs().GetLogEntry() {
+			s.handleHTTPEntry(service, node, entry)
+		}
+		for _, entry := range msg.GetTcpLogs().GetLogEntry() {
+			s.handleTCPEntry(service, node, entry)
+		}
+	}
+}
+
+// serviceName returns the service the entries of a log name are counted for: the log name when it
+// is the namespace qualified name of the service of a ProxyConfig, unknown otherwise, to bound the
+// number of label values clients can create.
+func (s *AccessLogServer) serviceName(ctx context.Context, logName string) string {
+	if logName == "" {
+		return unknownService
+	}
+	if s.proxyConfigs == nil {
+		return logName
+	}
+
+	namespace, name, ok := strings.Cut(logName, "/")
+	if !ok || namespace == "" || name == "" {
+		return unknownService
+	}
+
+	proxyConfigs := &configv1.ProxyConfigList{}
+	if err := s.proxyConfigs.List(ctx, proxyConfigs, client.InNamespace(namespace)); err != nil {
+		s.log.Error(err, "unable to list the ProxyConfigs of the log name namespace", "logName", logName)
+		return unknownService
+	}
+	for _, proxyConfig := range proxyConfigs.Items {
+		if proxyConfig.Spec.GetService().GetName() == name {
+			return logName
+		}
+	}
+
+	s.log.V(1).Info("log name matches no ProxyConfig service", "logName", logName)
+	return unknownService
+}
+
+func (s *AccessLogServer) handleHTTPEntry(service string, node string, entry *accesslogdatav3.HTTPAccessLogEntry) {
+	common := entry.GetCommonProperties()
+	request := entry.GetRequest()
+	response := entry.GetResponse()
+
+	method := request.GetRequestMethod().String()
+	responseCode := strconv.FormatUint(uint64(response.GetResponseCode().GetValue()), 10)
+
+	s.metrics.httpRequests.WithLabelValues(service, method, responseCode).Inc()
+	s.metrics.bytesReceived.WithLabelValues(service).Add(float64(request.GetRequestHeadersBytes() + request.GetRequestBodyBytes()))
+	s.metrics.bytesSent.WithLabelValues(service).Add(float64(response.GetResponseHeadersBytes() + response.GetResponseBodyBytes()))
+
+	s.log.Info("http access log",
+		"service", service,
+		"node", node,
+		"method", method,
+		"authority", request.GetAuthority(),
+		"path", request.GetPath(),
+		"responseCode", response.GetResponseCode().GetValue(),
+		"responseCodeDetails", response.GetResponseCodeDetails(),
+		"duration", common.GetTimeToLastDownstreamTxByte().AsDuration(),
+		"requestId", request.GetRequestId(),
+		"downstream", addressString(common.GetDownstreamRemoteAddress()),
+		"downstreamPeer", peerURISan(common.GetTlsProperties()),
+		"upstream", addressString(common.GetUpstreamRemoteAddress()),
+		"upstreamCluster", common.GetUpstreamCluster(),
+	)
+}
+
+func (s *AccessLogServer) handleTCPEntry(service string, node string, entry *accesslogdatav3.TCPAccessLogEntry) {
+	common := entry.GetCommonProperties()
+	connection := entry.GetConnectionProperties()
+
+	s.metrics.tcpConnections.WithLabelValues(service).Inc()
+	s.metrics.bytesReceived.WithLabelValues(service).Add(float64(connection.GetReceivedBytes()))
+	s.metrics.bytesSent.WithLabelValues(service).Add(float64(connection.GetSentBytes()))
+
+	s.log.Info("tcp access log",
+		"service", service,
+		"node", node,
+		"receivedBytes", connection.GetReceivedBytes(),
+		"sentBytes", connection.GetSentBytes(),
+		"duration", common.GetTimeToLastDownstreamTxByte().AsDuration(),
+		"downstream", addressString(common.GetDownstreamRemoteAddress()),
+		"downstreamPeer", peerURISan(common.GetTlsProperties()),
+		"upstream", addressString(common.GetUpstreamRemoteAddress()),
+		"upstreamCluster", common.GetUpstreamCluster(),
+	)
+}
+
+func addressString(address *corev3.Address) string {
+	socketAddress := address.GetSocketAddress()
+	if socketAddress == nil {
+		return ""
+	}
+	return net.JoinHostPort(socketAddress.GetAddress(), strconv.FormatUint(uint64(socketAddress.GetPortValue()), 10))
+}
+
+// peerURISan returns the first URI SAN of the peer certificate, which is the SPIFFE ID for mTLS peers.
+func peerURISan(tlsProperties *accesslogdatav3.TLSProperties) string {
+	for _, san := range tlsProperties.GetPeerCertificateProperties().GetSubjectAltName() {
+		if uri := san.GetUri(); uri != "" {
+			return uri
+		}
+	}
+	return ""
+}
+
+func (s *AccessLogServer) Start(ctx context.Context) error {
+	// Create listener
+	listener, err := net.Listen(s.network, s.address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s://%s: %w", s.network, s.address, err)
+	}
+
+	s.log.Info("access log server listening", "network", s.network, "address", s.address)
+
+	// Monitor context cancellation
+	go func() {
+		<-ctx.Done()
+		s.log.Info("context cancelled, initiating graceful shutdown")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+		defer cancel()
+
+		if err := s.Shutdown(shutdownCtx); err != nil {
+			s.log.Error(err, "failed to shutdown access log server")
+		}
+	}()
+
+	return s.grpcServer.Serve(listener)
+}
+
+// Shutdown gracefully stops the access log server with timeout
+func (s *AccessLogServer) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.grpcServer.GracefulStop()
+	}()
+
+	select {
+	case <-done:
+		s.log.Info("access log server graceful shutdown complete")
+		return nil
+	case <-ctx.Done():
+		s.log.Info("shutdown timeout exceeded, forcing stop")
+		s.grpcServer.Stop()
+		return fmt.Errorf("shutdown timeout exceeded: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	proxyconfigv1 "github.com/bpalermo/maestro/api/config/v1"
+	configv1 "github.com/bpalermo/maestro/pkg/apis/config/v1"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	accesslogdatav3 "github.com/envoyproxy/go-control-plane/envoy/data/accesslog/v3"
+	accesslogv3 "github.com/envoyproxy/go-control-plane/envoy/service/accesslog/v3"
+	"github.com/go-logr/logr/testr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakeStream struct {
+	grpc.ServerStream
+
+	messages []*accesslogv3.StreamAccessLogsMessage
+	closed   bool
+}
+
+func (f *fakeStream) Context() context.Context {
+	return context.Background()
+}
+
+func (f *fakeStream) Recv() (*accesslogv3.StreamAccessLogsMessage, error) {
+	if len(f.messages) == 0 {
+		return nil, io.EOF
+	}
+	msg := f.messages[0]
+	f.messages = f.messages[1:]
+	return msg, nil
+}
+
+func (f *fakeStream) SendAndClose(*accesslogv3.StreamAccessLogsResponse) error {
+	f.closed = true
+	return nil
+}
+
+func httpEntry(method corev3.RequestMethod, responseCode uint32) *accesslogdatav3.HTTPAccessLogEntry {
+	return &accesslogdatav3.HTTPAccessLogEntry{
+		CommonProperties: &accesslogdatav3.AccessLogCommon{},
+		Request: &accesslogdatav3.HTTPRequestProperties{
+			RequestMethod:       method,
+			Path:                "/",
+			RequestHeadersBytes: 10,
+		},
+		Response: &accesslogdatav3.HTTPResponseProperties{
+			ResponseCode:         wrapperspb.UInt32(responseCode),
+			ResponseHeadersBytes: 20,
+			ResponseBodyBytes:    5,
+		},
+	}
+}
+
+func TestAccessLogServer_StreamAccessLogs(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	srv, err := NewAccessLogServer(testr.New(t), WithRegisterer(registry))
+	require.NoError(t, err)
+
+	stream := &fakeStream{
+		messages: []*accesslogv3.StreamAccessLogsMessage{
+			{
+				Identifier: &accesslogv3.StreamAccessLogsMessage_Identifier{
+					Node:    &corev3.Node{Id: "sidecar~10.0.0.1"},
+					LogName: "test",
+				},
+				LogEntries: &accesslogv3.StreamAccessLogsMessage_HttpLogs{
+					HttpLogs: &accesslogv3.StreamAccessLogsMessage_HTTPAccessLogEntries{
+						LogEntry: []*accesslogdatav3.HTTPAccessLogEntry{
+							httpEntry(corev3.RequestMethod_GET, 200),
+							httpEntry(corev3.RequestMethod_GET, 200),
+						},
+					},
+				},
+			},
+			{
+				LogEntries: &accesslogv3.StreamAccessLogsMessage_HttpLogs{
+					HttpLogs: &accesslogv3.StreamAccessLogsMessage_HTTPAccessLogEntries{
+						LogEntry: []*accesslogdatav3.HTTPAccessLogEntry{
+							httpEntry(corev3.RequestMethod_POST, 503),
+						},
+					},
+				},
+			},
+			{
+				LogEntries: &accesslogv3.StreamAccessLogsMessage_TcpLogs{
+					TcpLogs: &accesslogv3.StreamAccessLogsMessage_TCPAccessLogEntries{
+						LogEntry: []*accesslogdatav3.TCPAccessLogEntry{
+							{
+								ConnectionProperties: &accesslogdatav3.ConnectionProperties{
+									ReceivedBytes: 100,
+									SentBytes:     200,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	require.NoError(t, srv.StreamAccessLogs(stream))
+	assert.True(t, stream.closed)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(srv.metrics.httpRequests.WithLabelValues("test", "GET", "200")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(srv.metrics.httpRequests.WithLabelValues("test", "POST", "503")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(srv.metrics.tcpConnections.WithLabelValues("test")))
+	assert.Equal(t, float64(130), testutil.ToFloat64(srv.metrics.bytesReceived.WithLabelValues("test")))
+	assert.Equal(t, float64(275), testutil.ToFloat64(srv.metrics.bytesSent.WithLabelValues("test")))
+}
+
+func TestAccessLogServer_StreamAccessLogs_ProxyConfigServices(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, configv1.AddToScheme(scheme))
+	proxyConfigs := crfake.NewClientBuilder().WithScheme(scheme).WithObjects(&configv1.ProxyConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders", Namespace: "shop"},
+		Spec:       &proxyconfigv1.ProxyConfigSpec{Service: &proxyconfigv1.Service{Name: "orders"}},
+	}).Build()
+
+	registry := prometheus.NewRegistry()
+	srv, err := NewAccessLogServer(testr.New(t), WithRegisterer(registry), WithProxyConfigs(proxyConfigs))
+	require.NoError(t, err)
+
+	stream := func(logName string) *fakeStream {
+		return &fakeStream{messages: []*accesslogv3.StreamAccessLogsMessage{{
+			Identifier: &accesslogv3.StreamAccessLogsMessage_Identifier{LogName: logName},
+			LogEntries: &accesslogv3.StreamAccessLogsMessage_HttpLogs{
+				HttpLogs: &accesslogv3.StreamAccessLogsMessage_HTTPAccessLogEntries{
+					LogEntry: []*accesslogdatav3.HTTPAccessLogEntry{httpEntry(corev3.RequestMethod_GET, 200)},
+				},
+			},
+		}}}
+	}
+
+	for _, logName := range []string{"shop/orders", "shop/payments", "billing/orders", "orders"} {
+		require.NoError(t, srv.StreamAccessLogs(stream(logName)))
+	}
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(srv.metrics.httpRequests.WithLabelValues("shop/orders", "GET", "200")))
+	assert.Equal(t, float64(3), testutil.ToFloat64(srv.metrics.httpRequests.WithLabelValues(unknownService, "GET", "200")))
+	assert.Equal(t, 2, testutil.CollectAndCount(srv.metrics.httpRequests))
+}
+
+func TestNewAccessLogServer_DuplicateRegistration(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	_, err := NewAccessLogServer(testr.New(t), WithRegisterer(registry))
+	require.NoError(t, err)
+
+	_, err = NewAccessLogServer(testr.New(t), WithRegisterer(registry))
+	assert.Error(t, err)
+}
@@ -27,8 +27,46 @@ type ProxyConfig struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec   *configv1.ProxyConfigSpec   `json:"spec"`
-	Status *configv1.ProxyConfigStatus `json:"status"`
+	Spec   *configv1.ProxyConfigSpec `json:"spec"`
+	Status *ProxyConfigStatus        `json:"status,omitempty"`
+}
+
+const (
+	// ConditionReady is the condition type set when the bootstrap of a ProxyConfig is generated and
+	// stored in its ConfigMap.
+	ConditionReady = "Ready"
+	// ConditionDegraded is the condition type set when the last sync of a ProxyConfig failed.
+	ConditionDegraded = "Degraded"
+
+	// ReasonSynced is the condition reason of a ProxyConfig whose ConfigMap is up to date.
+	ReasonSynced = "Synced"
+	// ReasonGenerationFailed is the condition reason of a ProxyConfig whose bootstrap could not be
+	// generated.
+	ReasonGenerationFailed = "GenerationFailed"
+	// ReasonConfigMapConflict is the condition reason of a ProxyConfig whose ConfigMap exists and
+	// is not controlled by it.
+	ReasonConfigMapConflict = "ConfigMapConflict"
+	// ReasonConfigMapUpdateFailed is the condition reason of a ProxyConfig whose ConfigMap could
+	// not be created or updated.
+	ReasonConfigMapUpdateFailed = "ConfigMapUpdateFailed"
+)
+
+// ProxyConfigStatus is the observed state of a ProxyConfig resource
+type ProxyConfigStatus struct {
+	// ObservedGeneration is the generation of the ProxyConfig last synced.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// ConfigMapRef references the ConfigMap holding the generated bootstrap.
+	ConfigMapRef *ConfigMapReference `json:"configMapRef,omitempty"`
+	// BootstrapHash is the hash of the ConfigMap data, stamped on the pods started with it.
+	BootstrapHash string `json:"bootstrapHash,omitempty"`
+	// Conditions are the Ready and Degraded conditions of the ProxyConfig.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ConfigMapReference references a ConfigMap of the namespace of the ProxyConfig
+type ConfigMapReference struct {
+	Name            string `json:"name"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
 }
 
 // ProxyConfigList is a list of ProxyConfig resources
@@ -48,7 +86,11 @@ func (in *ProxyConfig) DeepCopyInto(out *ProxyConfig) {
 		in, out := &in.Spec, &out.Spec
 		*out = (*in).DeepCopy()
 	}
-	out.Status = in.Status
+	if in.Status != nil {
+		in, out := &in.Status, &out.Status
+		*out = new(ProxyConfigStatus)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -70,6 +112,34 @@ func (in *ProxyConfig) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProxyConfigStatus) DeepCopyInto(out *ProxyConfigStatus) {
+	*out = *in
+	if in.ConfigMapRef != nil {
+		in, out := &in.ConfigMapRef, &out.ConfigMapRef
+		*out = new(ConfigMapReference)
+		**out = **in
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProxyConfigStatus.
+func (in *ProxyConfigStatus) DeepCopy() *ProxyConfigStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ProxyConfigStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ProxyConfigList) DeepCopyInto(out *ProxyConfigList) {
 	*out = *in
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CacheOptions returns the options of the cache of the controller. Objects are only cached in
+// the watched namespaces, all namespaces if none is watched, and the ConfigMaps only if they are
+// labelled as managed by the controller when enabled.
+func CacheOptions(ctx context.Context, kubeClient kubernetes.Interface, args *MaestroControllerArgs) (cache.Options, error) {
+	options := cache.Options{}
+
+	namespaces, err := watchedNamespaces(ctx, kubeClient, args.Watch)
+	if err != nil {
+		return options, err
+	}
+	if len(namespaces) > 0 {
+		options.DefaultNamespaces = map[string]cache.Config{}
+		for _, namespace := range namespaces {
+			options.DefaultNamespaces[namespace] = cache.Config{}
+		}
+	}
+
+	if args.Watch.ManagedConfigMapsOnly {
+		options.ByObject = map[client.Object]cache.ByObject{
+			&corev1.ConfigMap{}: {Label: labels.SelectorFromSet(managedConfigMapLabels)},
+		}
+	}
+
+	return options, nil
+}
+
+// watchedNamespaces returns the listed namespaces and the ones matching the namespace selector,
+// sorted. The selector is only evaluated once, namespaces labelled afterward are not watched.
+func watchedNamespaces(ctx context.Context, kubeClient kubernetes.Interface, config *WatchConfig) ([]string, error) {
+	namespaces := slices.Clone(config.Namespaces)
+
+	if config.NamespaceSelector != "" {
+		selector, err := labels.Parse(config.NamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace selector %q: %w", config.NamespaceSelector, err)
+		}
+
+		list, err := kubeClient.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list namespaces: %w", err)
+		}
+		// an empty list would watch all namespaces
+		if len(list.Items) == 0 {
+			return nil, fmt.Errorf("no namespace matches the namespace selector %q", config.NamespaceSelector)
+		}
+		for _, namespace := range list.Items {
+			namespaces = append(namespaces, namespace.Name)
+		}
+	}
+
+	slices.Sort(namespaces)
+	return slices.Compact(namespaces), nil
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCacheOptions(t *testing.T) {
+	namespace := func(name string, labels map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	kubeClient := fake.NewClientset(
+		namespace("orders", map[string]string{"team": "checkout"}),
+		namespace("payments", map[string]string{"team": "checkout"}),
+		namespace("search", map[string]string{"team": "discovery"}),
+	)
+
+	tests := []struct {
+		name               string
+		watch              *WatchConfig
+		expectedNamespaces []string
+		wantErr            bool
+	}{
+		{
+			name:  "all namespaces",
+			watch: &WatchConfig{},
+		},
+		{
+			name:               "listed namespaces",
+			watch:              &WatchConfig{Namespaces: []string{"search", "orders"}},
+			expectedNamespaces: []string{"orders", "search"},
+		},
+		{
+			name:               "namespace selector",
+			watch:              &WatchConfig{Namespaces: []string{"orders"}, NamespaceSelector: "team=checkout"},
+			expectedNamespaces: []string{"orders", "payments"},
+		},
+		{
+			name:    "namespace selector without match",
+			watch:   &WatchConfig{NamespaceSelector: "team=billing"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid namespace selector",
+			watch:   &WatchConfig{NamespaceSelector: "team in"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := NewControllerArgs()
+			args.Watch = tt.watch
+
+			options, err := CacheOptions(context.Background(), kubeClient, args)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			var namespaces []string
+			for namespace := range options.DefaultNamespaces {
+				namespaces = append(namespaces, namespace)
+			}
+			assert.ElementsMatch(t, tt.expectedNamespaces, namespaces)
+			assert.Empty(t, options.ByObject)
+		})
+	}
+
+	t.Run("managed config maps only", func(t *testing.T) {
+		args := NewControllerArgs()
+		args.Watch.ManagedConfigMapsOnly = true
+
+		options, err := CacheOptions(context.Background(), kubeClient, args)
+		require.NoError(t, err)
+		require.Len(t, options.ByObject, 1)
+		for obj, byObject := range options.ByObject {
+			assert.IsType(t, &corev1.ConfigMap{}, obj)
+			assert.Equal(t, "controller=maestro", byObject.Label.String())
+		}
+	})
+}
@@ -2,32 +2,31 @@ package controller
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
+	"maps"
 	"reflect"
-	"time"
+	"slices"
 
+	configv1api "github.com/bpalermo/maestro/api/config/v1"
+	"github.com/bpalermo/maestro/internal/config"
+	"github.com/bpalermo/maestro/internal/config/constants"
 	"github.com/bpalermo/maestro/internal/proxy"
 	configv1 "github.com/bpalermo/maestro/pkg/apis/config/v1"
-	"golang.org/x/time/rate"
+	ratelimitserver "github.com/bpalermo/maestro/pkg/ratelimit/server"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
-	utilRuntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/dynamic/dynamicinformer"
-	"k8s.io/client-go/informers"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/kubernetes/scheme"
-	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
-	corelisters "k8s.io/client-go/listers/core/v1"
-	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/record"
-	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 const controllerAgentName = "maestro"
@@ -38,17 +37,31 @@ const (
 	// ErrResourceExists is used as part of the Event 'reason' when a ProxyConfig fails
 	// to sync due to a ConfigMap of the same name already existing.
 	ErrResourceExists = "ErrResourceExists"
+	// ErrGenerationFailed is used as part of the Event 'reason' when the bootstrap
+	// of a ProxyConfig is invalid.
+	ErrGenerationFailed = "ErrGenerationFailed"
+	// SettingsIgnored is used as part of the Event 'reason' when settings of a ProxyConfig
+	// are not rendered because the service they depend on is not configured.
+	SettingsIgnored = "SettingsIgnored"
 
 	// MessageResourceExists is the message used for Events when a resource
 	// fails to sync due to a ConfigMap already existing
 	MessageResourceExists = "Resource %q already exists and is not managed by ProxyConfig"
+	// MessageGenerationFailed is the message used for Events when the bootstrap
+	// of a ProxyConfig is invalid
+	MessageGenerationFailed = "Unable to generate the proxy bootstrap: %v"
 	// MessageResourceSynced is the message used for an Event fired when a ProxyConfig
 	// is synced successfully
 	MessageResourceSynced = "ProxyConfig synced successfully"
 	// FieldManager distinguishes this controller from other things writing to API objects
 	FieldManager = controllerAgentName
+)
 
-	defaultConfigMapPrefix = "proxy-config-"
+var (
+	// managedConfigMapLabels are the labels of the ConfigMaps created by the controller
+	managedConfigMapLabels = map[string]string{
+		"controller": controllerAgentName,
+	}
 )
 
 type MaestroControllerArgs struct {
@@ -56,47 +69,98 @@ type MaestroControllerArgs struct {
 	KubeConfig      string
 	ConfigMapPrefix string
 	Spire           *SpireConfig
+	RateLimit       *RateLimitConfig
+	AccessLog       *AccessLogConfig
+	Tracing         *TracingConfig
+	Rollout         *RolloutConfig
+	LeaderElection  *LeaderElectionConfig
+	Watch           *WatchConfig
+	// MetricsAddr is the address the metrics are served on. Metrics are disabled if set to 0.
+	MetricsAddr string
+	// HealthProbeAddr is the address the liveness and readiness probes are served on.
+	HealthProbeAddr string
 }
 
 type SpireConfig struct {
 	TrustDomain string
 }
 
+// RateLimitConfig configures the rate limit service hosted by the controller.
+type RateLimitConfig struct {
+	// ListenAddr is the address the rate limit service listens on.
+	ListenAddr string
+	// ServiceHost is the host proxies use to reach the rate limit service. The service is disabled when empty.
+	ServiceHost string
+	// ServicePort is the port proxies use to reach the rate limit service.
+	ServicePort uint32
+}
+
+// AccessLogConfig configures the access log service proxies stream gRPC access logs to.
+type AccessLogConfig struct {
+	// ServiceHost is the host proxies use to reach the access log service. gRPC access logs are disabled when empty.
+	ServiceHost string
+	// ServicePort is the port proxies use to reach the access log service.
+	ServicePort uint32
+}
+
+// TracingConfig configures the OpenTelemetry collector proxies export spans to.
+type TracingConfig struct {
+	// ServiceHost is the host of the OpenTelemetry collector. Tracing is disabled when empty.
+	ServiceHost string
+	// ServicePort is the OTLP gRPC port of the OpenTelemetry collector.
+	ServicePort uint32
+}
+
+// LeaderElectionConfig configures the election of the controller replica reconciling the
+// ProxyConfig resources.
+type LeaderElectionConfig struct {
+	// Enabled elects a leader among the controller replicas.
+	Enabled bool
+	// Namespace is the namespace of the leader election Lease. The namespace of the controller
+	// is used if empty.
+	Namespace string
+	// ID is the name of the leader election Lease.
+	ID string
+}
+
+// WatchConfig restricts the objects watched and cached by the controller.
+type WatchConfig struct {
+	// Namespaces are the namespaces watched. All namespaces are watched if empty and no
+	// namespace selector is set.
+	Namespaces []string
+	// NamespaceSelector is the label selector of additional namespaces watched, evaluated at
+	// startup.
+	NamespaceSelector string
+	// ManagedConfigMapsOnly only caches the ConfigMaps labelled as managed by the controller.
+	ManagedConfigMapsOnly bool
+}
+
 func NewControllerArgs() *MaestroControllerArgs {
 	return &MaestroControllerArgs{
-		Spire: &SpireConfig{},
+		Spire:          &SpireConfig{},
+		RateLimit:      &RateLimitConfig{},
+		AccessLog:      &AccessLogConfig{},
+		Tracing:        &TracingConfig{},
+		Rollout:        &RolloutConfig{},
+		LeaderElection: &LeaderElectionConfig{},
+		Watch:          &WatchConfig{},
 	}
 }
 
 // MaestroControllerOption is a functional option type that allows us to configure the Controller.
 type MaestroControllerOption func(*MaestroController)
 
+// MaestroController reconciles the ProxyConfig resources into the ConfigMaps holding the
+// bootstrap of their proxies.
 type MaestroController struct {
-	// ctx is the context for the controller.
-	ctx context.Context
+	client.Client
+
+	// apiReader reads the objects that are not cached, from the API server.
+	apiReader client.Reader
 
 	// kubeClientSet is a standard kubernetes client set
 	kubeClientSet kubernetes.Interface
-	// dynamicClientSet is a client set for our own API group
-	dynamicClientSet *dynamic.DynamicClient
-
-	// kubeInformerFactory is a shared informer factory for the kubernetes API
-	kubeInformerFactory informers.SharedInformerFactory
-
-	// dynamicInformerFactory is a shared informer factory for our own API group
-	dynamicInformerFactory dynamicinformer.DynamicSharedInformerFactory
-
-	configMapsLister   corelisters.ConfigMapLister
-	configMapsSynced   cache.InformerSynced
-	proxyConfigLister  cache.GenericLister
-	proxyConfigsSynced cache.InformerSynced
-
-	// workqueue is a rate-limited work queue. This is used to queue work to be
-	// processed instead of performing it as soon as a change happens. This
-	// means we can ensure we only process a fixed number of resources at a
-	// time, and makes it easy to ensure we are never processing the same item
-	// simultaneously in two different workers.
-	workqueue workqueue.TypedRateLimitingInterface[cache.ObjectName]
+
 	// recorder is an event recorder for recording Event resources to the
 	// Kubernetes API.
 	recorder record.EventRecorder
@@ -106,66 +170,40 @@ type MaestroController struct {
 
 	// spiffeTrustDomain SPIFFE trust domain
 	spiffeTrustDomain string
-}
 
-// NewMaestroController returns a new sample controller
-func NewMaestroController(
-	ctx context.Context,
-	args *MaestroControllerArgs,
-	options ...MaestroControllerOption) *MaestroController {
-	logger := klog.FromContext(ctx)
-	logger.V(4).Info("Creating event broadcaster")
+	// rateLimitServer is the rate limit service fed with the ProxyConfig rate limits, if enabled.
+	rateLimitServer *ratelimitserver.RateLimitServer
 
-	cfg, err := clientcmd.BuildConfigFromFlags(args.MasterURL, args.KubeConfig)
-	if err != nil {
-		logger.Error(err, "Error building kubeconfig")
-		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
-	}
+	// bootstrapOptions are the options used to generate proxy bootstraps.
+	bootstrapOptions []proxy.BootstrapOption
 
-	kubeClient, err := kubernetes.NewForConfig(cfg)
-	if err != nil {
-		logger.Error(err, "Error building kubernetes clientset")
-		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
-	}
-
-	maestroClient, err := dynamic.NewForConfig(cfg)
-	if err != nil {
-		logger.Error(err, "Error building kubernetes clientset")
-		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
-	}
+	// bootstrapFormat is the format of the bootstraps whose ProxyConfig does not set one.
+	bootstrapFormat configv1api.Bootstrap_Format
 
-	kubeInformerFactory := informers.NewSharedInformerFactory(kubeClient, time.Second*30)
-	dynamicInformerFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(maestroClient, time.Second*30, corev1.NamespaceAll, nil)
+	// rollouts restarts the workloads when their bootstrap changes, if enabled.
+	rollouts *rollouts
+}
 
-	configMapInformer := kubeInformerFactory.Core().V1().ConfigMaps()
-	proxyConfigsInformer := dynamicInformerFactory.ForResource(configv1.ProxyConfigSchemaGVR)
+var _ reconcile.Reconciler = &MaestroController{}
 
-	// Create an event broadcaster
-	// Add maestro types to the default Kubernetes Scheme so Events can be
-	// logged for maestro types.
-	eventBroadcaster := record.NewBroadcaster(record.WithContext(ctx))
-	eventBroadcaster.StartStructuredLogging(0)
-	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
-	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
-	ratelimiter := workqueue.NewTypedMaxOfRateLimiter(
-		workqueue.NewTypedItemExponentialFailureRateLimiter[cache.ObjectName](5*time.Millisecond, 1000*time.Second),
-		&workqueue.TypedBucketRateLimiter[cache.ObjectName]{Limiter: rate.NewLimiter(rate.Limit(50), 300)},
-	)
+// NewMaestroController returns a new ProxyConfig controller using the clients of the manager
+func NewMaestroController(
+	mgr manager.Manager,
+	args *MaestroControllerArgs,
+	options ...MaestroControllerOption) (*MaestroController, error) {
+	kubeClient, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, fmt.Errorf("unable to build kubernetes clientset: %w", err)
+	}
 
 	controller := &MaestroController{
-		ctx:                    ctx,
-		kubeInformerFactory:    kubeInformerFactory,
-		dynamicInformerFactory: dynamicInformerFactory,
-		kubeClientSet:          kubeClient,
-		dynamicClientSet:       maestroClient,
-		configMapsLister:       configMapInformer.Lister(),
-		configMapsSynced:       configMapInformer.Informer().HasSynced,
-		proxyConfigLister:      proxyConfigsInformer.Lister(),
-		proxyConfigsSynced:     proxyConfigsInformer.Informer().HasSynced,
-		workqueue:              workqueue.NewTypedRateLimitingQueue(ratelimiter),
-		recorder:               recorder,
-		spiffeTrustDomain:      args.Spire.TrustDomain,
-		configMapPrefix:        defaultConfigMapPrefix,
+		Client:            mgr.GetClient(),
+		apiReader:         mgr.GetAPIReader(),
+		kubeClientSet:     kubeClient,
+		recorder:          mgr.GetEventRecorderFor(controllerAgentName),
+		spiffeTrustDomain: args.Spire.TrustDomain,
+		configMapPrefix:   constants.ProxyConfigMapPrefix,
+		bootstrapFormat:   configv1api.Bootstrap_FORMAT_YAML,
 	}
 
 	// Apply all the functional options to configure the controller.
@@ -173,36 +211,27 @@ func NewMaestroController(
 		opt(controller)
 	}
 
-	logger.Info("Setting up event handlers")
-	// Set up an event handler for when ProxyConfig resources change
-	_, _ = proxyConfigsInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: controller.enqueueProxyConfig,
-		UpdateFunc: func(_, n interface{}) {
-			controller.enqueueProxyConfig(n)
-		},
-	})
-	// Set up an event handler for when ConfigMap resources change. This
-	// handler will look up the owner of the given ConfigMap, and if it is
-	// owned by a ProxyConfig resource, then the handler will enqueue that ProxyConfig resource for
-	// processing. This way, we don't need to implement custom logic for
-	// handling ConfigMap resources. More info on this pattern:
-	// https://github.com/kubernetes/community/blob/8cafef897a22026d42f5e5bb3f104febe7e29830/contributors/devel/controllers.md
-	_, _ = configMapInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: controller.handleObject,
-		UpdateFunc: func(o, n interface{}) {
-			newDepl := n.(*corev1.ConfigMap)
-			oldDepl := o.(*corev1.ConfigMap)
-			if newDepl.ResourceVersion == oldDepl.ResourceVersion {
-				// Periodic resync will send update events for all known ConfigMap.
-				// Two different versions of the same ConfigMap will always have different RVs.
-				return
-			}
-			controller.handleObject(n)
-		},
-		DeleteFunc: controller.handleObject,
-	})
+	return controller, nil
+}
 
-	return controller
+// SetupWithManager registers the controller with the manager. The ProxyConfig resources are
+// reconciled by the elected replica only, and requeued when the ConfigMaps they own change. Their
+// rate limits are fed to the rate limit service of every replica.
+func (c *MaestroController) SetupWithManager(mgr manager.Manager) error {
+	err := builder.ControllerManagedBy(mgr).
+		Named("proxyconfig").
+		For(&configv1.ProxyConfig{}).
+		Owns(&corev1.ConfigMap{}).
+		Complete(c)
+	if err != nil || c.rateLimitServer == nil {
+		return err
+	}
+
+	return builder.ControllerManagedBy(mgr).
+		Named("proxyconfig-ratelimit").
+		For(&configv1.ProxyConfig{}).
+		WithOptions(crcontroller.Options{NeedLeaderElection: ptr.To(false)}).
+		Complete(reconcile.Func(c.reconcileRateLimit))
 }
 
 // WithConfigMapPrefix is a functional option to set the config map prefix.
@@ -212,287 +241,182 @@ func WithConfigMapPrefix(prefix string) MaestroControllerOption {
 	}
 }
 
-func (c *MaestroController) Start(logger klog.Logger, errChan chan error) {
-	// notice that there is no need to run Start methods in a separate goroutine. (i.e., go kubeInformerFactory.Start(ctx.done())
-	// Start method is non-blocking and runs all registered informers in a dedicated goroutine.
-	c.kubeInformerFactory.Start(c.ctx.Done())
-	c.dynamicInformerFactory.Start(c.ctx.Done())
-
-	if err := c.Run(c.ctx, 2); err != nil {
-		errChan <- err
+// WithBootstrapFormat is a functional option to set the format of the bootstraps whose
+// ProxyConfig does not set one.
+func WithBootstrapFormat(format configv1api.Bootstrap_Format) MaestroControllerOption {
+	return func(c *MaestroController) {
+		c.bootstrapFormat = format
 	}
 }
 
-// Run will set up the event handlers for types we are interested in, as well
-// as syncing informer caches and starting workers. It will block until stopCh
-// is closed, at which point it will shut down the workqueue and wait for
-// workers to finish processing their current work items.
-func (c *MaestroController) Run(ctx context.Context, workers int) error {
-	defer utilRuntime.HandleCrash()
-	defer c.workqueue.ShutDown()
-	logger := klog.FromContext(ctx)
-
-	// Start the informer factories to begin populating the informer caches
-	logger.Info("Starting Maestro controller")
-
-	// Wait for the caches to be synced before starting workers
-	logger.Info("Waiting for informer caches to sync")
-
-	if ok := cache.WaitForCacheSync(ctx.Done(), c.configMapsSynced, c.proxyConfigsSynced); !ok {
-		return fmt.Errorf("failed to wait for caches to sync")
+// WithRateLimitServer is a functional option to feed the rate limit configurations of the
+// ProxyConfig resources to a rate limit server, reachable by the proxies at the given address.
+func WithRateLimitServer(srv *ratelimitserver.RateLimitServer, address proxy.ServiceAddress) MaestroControllerOption {
+	return func(c *MaestroController) {
+		c.rateLimitServer = srv
+		c.bootstrapOptions = append(c.bootstrapOptions, proxy.WithRateLimitService(address))
 	}
+}
 
-	logger.Info("Starting workers", "count", workers)
-	// Launch two workers to process ProxyConfig resources
-	for i := 0; i < workers; i++ {
-		go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+// WithAccessLogService is a functional option to set the address proxies stream gRPC access logs to.
+func WithAccessLogService(address proxy.ServiceAddress) MaestroControllerOption {
+	return func(c *MaestroController) {
+		c.bootstrapOptions = append(c.bootstrapOptions, proxy.WithAccessLogService(address))
 	}
+}
 
-	logger.Info("Started workers")
-	<-ctx.Done()
-	logger.Info("Shutting down workers")
-
-	return nil
+// WithTracingService is a functional option to set the address of the OpenTelemetry collector proxies export spans to.
+func WithTracingService(address proxy.ServiceAddress) MaestroControllerOption {
+	return func(c *MaestroController) {
+		c.bootstrapOptions = append(c.bootstrapOptions, proxy.WithTracingService(address))
+	}
 }
 
-// runWorker is a long-running function that will continually call the
-// processNextWorkItem function to read and process a message on the
-// workqueue.
-func (c *MaestroController) runWorker(ctx context.Context) {
-	for c.processNextWorkItem(ctx) {
+// WithRollout is a functional option to restart the workloads of a ProxyConfig when its
+// bootstrap changes.
+func WithRollout(config RolloutConfig) MaestroControllerOption {
+	return func(c *MaestroController) {
+		c.rollouts = newRollouts(c.Client, c.apiReader, config)
 	}
 }
 
-// processNextWorkItem will read a single work item off the workqueue and
-// attempt to process it by calling the syncHandler.
-func (c *MaestroController) processNextWorkItem(ctx context.Context) bool {
-	objRef, shutdown := c.workqueue.Get()
-	logger := klog.FromContext(ctx)
-
-	if shutdown {
-		return false
-	}
-
-	// We call Done at the end of this func, so the workqueue knows we have
-	// finished processing this item. We also must remember to call Forget
-	// if we do not want this work item being re-queued. For example, we do
-	// not call Forget if a transient error occurs, instead the item is
-	// put back in the workqueue and attempted again after a back-off
-	// period.
-	defer c.workqueue.Done(objRef)
-
-	// Run the syncHandler, passing it the structured reference to the object to be synced.
-	err := c.syncHandler(ctx, objRef)
-	if err == nil {
-		// If no error occurs, then we Forget this item, so it does not
-		// get queued again until another change happens.
-		c.workqueue.Forget(objRef)
-		logger.Info("Successfully synced", "objectName", objRef)
-		return true
-	}
-	// There was a failure, so be sure to report it. This method allows for
-	// pluggable error handling which can be used for things like
-	// cluster-monitoring.
-	utilRuntime.HandleErrorWithContext(ctx, err, "Error syncing; re-queuing for later retry", "objectReference", objRef)
-	// Since we failed, we should requeue the item to work on later.  This
-	// method will add a backoff to avoid hotlooping on particular items
-	// (they're probably still not going to work right away) and overall
-	// controller protection (everything I've done is broken, this controller
-	// needs to calm down, or it can starve other useful work) cases.
-	c.workqueue.AddRateLimited(objRef)
-	return true
+// KubeClientSet returns the kubernetes client set of the controller.
+func (c *MaestroController) KubeClientSet() kubernetes.Interface {
+	return c.kubeClientSet
 }
 
-// syncHandler compares the actual state with the desired and attempts to
+// Reconcile compares the actual state with the desired and attempts to
 // converge the two. It then updates the Status block of the ProxyConfig resource
 // with the current status of the resource.
-func (c *MaestroController) syncHandler(ctx context.Context, objectRef cache.ObjectName) error {
+func (c *MaestroController) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
 	// Get the ProxyConfig resource with this namespace/name
-	obj, err := c.proxyConfigLister.ByNamespace(objectRef.Namespace).Get(objectRef.Name)
-	if err != nil {
+	proxyConfig := &configv1.ProxyConfig{}
+	if err := c.Get(ctx, req.NamespacedName, proxyConfig); err != nil {
 		// The ProxyConfig resource may no longer exist, in which case we stop
-		// processing.
+		// processing. Its ConfigMap is garbage collected.
 		if errors.IsNotFound(err) {
-			utilRuntime.HandleErrorWithContext(ctx, err, "ProxyConfig referenced by item in work queue no longer exists", "objectReference", objectRef)
-			return nil
+			if c.rollouts != nil {
+				c.rollouts.forget(req.Namespace, req.Name)
+			}
+			return reconcile.Result{}, nil
 		}
 
-		return err
+		return reconcile.Result{}, err
 	}
 
-	u := obj.(*unstructured.Unstructured)
-
-	proxyConfigName := u.GetName()
-	if proxyConfigName == "" {
-		// We choose to absorb the error here as the worker would requeue the
-		// resource otherwise. Instead, the next time the resource is updated,
-		// the resource will be queued again.
-		utilRuntime.HandleErrorWithContext(ctx, nil, "ConfigMap name missing from object reference", "objectReference", objectRef)
-		return nil
+	if !proxyConfig.DeletionTimestamp.IsZero() {
+		return reconcile.Result{}, nil
 	}
 
 	// Get the config map with the expected name
-	proxyConfigConfigMapName := c.configMapName(proxyConfigName)
-	configMap, err := c.configMapsLister.ConfigMaps(u.GetNamespace()).Get(proxyConfigConfigMapName)
+	configMap := &corev1.ConfigMap{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: proxyConfig.Namespace, Name: c.configMapName(proxyConfig.Name)}, configMap)
 	// If the resource doesn't exist, we'll create it
 	if errors.IsNotFound(err) {
-		var proxyConfigMap *corev1.ConfigMap
-		proxyConfigMap, err = c.newProxyConfigConfigMap(u)
+		configMap, err = c.newProxyConfigConfigMap(proxyConfig)
+		if err != nil {
+			return reconcile.Result{}, c.generationFailed(ctx, proxyConfig, nil, err)
+		}
+		if err = c.Create(ctx, configMap, client.FieldOwner(FieldManager)); errors.IsAlreadyExists(err) {
+			// ConfigMaps without the managed labels are not cached
+			return reconcile.Result{}, c.configMapConflict(ctx, proxyConfig, configMap.Name)
+		}
 		if err != nil {
-			return err
+			return reconcile.Result{}, c.proxyConfigFailed(ctx, proxyConfig, nil, configv1.ReasonConfigMapUpdateFailed, err)
 		}
-		configMap, err = c.kubeClientSet.CoreV1().ConfigMaps(u.GetNamespace()).Create(ctx, proxyConfigMap, metav1.CreateOptions{FieldManager: FieldManager})
 	}
 
-	// If an error occurs during Get/Create, we'll requeue the item so we can
+	// If an error occurs during Get, we'll requeue the item so we can
 	// attempt to process again later. This could have been caused by a
 	// temporary network failure, or, any other transient reason.
 	if err != nil {
-		return err
+		return reconcile.Result{}, err
 	}
 
 	// If the ConfigMap is not controlled by this ProxyConfig resource, we should log
 	// a warning to the event recorder and return an error msg.
-	if !metav1.IsControlledBy(configMap, u) {
-		msg := fmt.Sprintf(MessageResourceExists, configMap.Name)
-		c.recorder.Event(obj, corev1.EventTypeWarning, ErrResourceExists, msg)
-		return fmt.Errorf("%s", msg)
+	if !metav1.IsControlledBy(configMap, proxyConfig) {
+		return reconcile.Result{}, c.configMapConflict(ctx, proxyConfig, configMap.Name)
 	}
 
-	data, err := c.generateProxyConfigConfigMapData(u)
+	data, err := c.generateProxyConfigConfigMapData(proxyConfig)
 	if err != nil {
-		return err
+		return reconcile.Result{}, c.generationFailed(ctx, proxyConfig, configMap, err)
 	}
 
 	if !reflect.DeepEqual(configMap.Data, data) {
-		configMap, err = c.updateProxyConfigMapData(ctx, u, configMap)
+		// If an error occurs during updating, we'll requeue the item so we can
+		// attempt to process again later. This could have been caused by a
+		// temporary network failure, or, any other transient reason.
+		updated := configMap.DeepCopy()
+		updated.Data = data
+		if err := c.Update(ctx, updated, client.FieldOwner(FieldManager)); err != nil {
+			return reconcile.Result{}, c.proxyConfigFailed(ctx, proxyConfig, configMap, configv1.ReasonConfigMapUpdateFailed, err)
+		}
+		configMap = updated
 	}
 
-	// If an error occurs during updating, we'll requeue the item so we can
-	// attempt to process again later. This could have been caused by a
-	// temporary network failure, or, any other transient reason.
-	if err != nil {
-		return err
+	// proxies only read their bootstrap at startup
+	var result reconcile.Result
+	if c.rollouts != nil {
+		requeueAfter, err := c.rollouts.rollout(ctx, proxyConfig.Name, configMap)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		result.RequeueAfter = requeueAfter
 	}
 
 	// Finally, we update the status block of the ProxyConfig resource to reflect the
 	// current state of the world
-	err = c.updateProxyConfigStatus(ctx, u, configMap)
+	updated, err := c.updateProxyConfigStatus(ctx, proxyConfig, configMap, configv1.ReasonSynced, nil)
 	if err != nil {
-		return err
+		return reconcile.Result{}, err
 	}
-
-	c.recorder.Event(obj, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
-	return nil
-}
-
-func (c *MaestroController) updateProxyConfigMapData(ctx context.Context, proxyConfigU *unstructured.Unstructured, configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
-	// NEVER modify objects from the store. It's a read-only, local cache.
-	// You can use DeepCopy() to make a deep copy of the original object and modify this copy
-	// Or create a copy manually for better performance
-	configMapCopy := configMap.DeepCopy()
-	data, err := c.generateProxyConfigConfigMapData(proxyConfigU)
-	if err != nil {
-		return nil, err
+	// periodic and rollout requeues leave the status unchanged, and must not repeat the events
+	if !updated {
+		return result, nil
 	}
 
-	configMapCopy.Data = data
-	return c.kubeClientSet.CoreV1().ConfigMaps(configMap.Namespace).Update(ctx, configMapCopy, metav1.UpdateOptions{FieldManager: FieldManager})
-}
-
-func (c *MaestroController) updateProxyConfigStatus(ctx context.Context, proxyConfigU *unstructured.Unstructured, configMap *corev1.ConfigMap) error {
-	// NEVER modify objects from the store. It's a read-only, local cache.
-	// You can use DeepCopy() to make a deep copy of the original object and modify this copy
-	// Or create a copy manually for better performance
-	proxyConfigCopy := proxyConfigU.DeepCopy()
-	err := unstructured.SetNestedStringMap(proxyConfigCopy.Object, map[string]string{"ResourceVersion": configMap.ResourceVersion}, "status")
-	if err != nil {
-		return err
+	for _, msg := range proxy.IgnoredSettings(proxyConfig, c.bootstrapOptions...) {
+		klog.FromContext(ctx).Info("Ignoring ProxyConfig setting", "proxyConfig", klog.KObj(proxyConfig), "reason", msg)
+		c.recorder.Event(proxyConfig, corev1.EventTypeWarning, SettingsIgnored, msg)
 	}
-
-	// If the CustomResourceSubresources feature gate is not enabled,
-	// we must use Update instead of UpdateStatus to update the Status block of the ProxyConfig resource.
-	// UpdateStatus will not allow changes to the Spec of the resource,
-	// which is ideal for ensuring nothing other than resource status has been updated.
-	_, err = c.dynamicClientSet.Resource(configv1.ProxyConfigSchemaGVR).Namespace(proxyConfigU.GetNamespace()).UpdateStatus(ctx, proxyConfigU, metav1.UpdateOptions{FieldManager: FieldManager})
-	return err
+	c.recorder.Event(proxyConfig, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
+	return result, nil
 }
 
-// enqueueProxyConfig takes a ProxyConfig resource and converts it into a namespace/name
-// string which is then put onto the work queue. This method should *not* be
-// passed to resources of any type other than ProxyConfig.
-func (c *MaestroController) enqueueProxyConfig(obj interface{}) {
-	objectRef, err := cache.ObjectToName(obj)
-	if err != nil {
-		utilRuntime.HandleError(err)
-		return
-	}
-	c.workqueue.Add(objectRef)
+// configMapConflict records that the ConfigMap of a ProxyConfig resource exists and is not
+// controlled by it.
+func (c *MaestroController) configMapConflict(ctx context.Context, proxyConfig *configv1.ProxyConfig, configMapName string) error {
+	msg := fmt.Sprintf(MessageResourceExists, configMapName)
+	c.recorder.Event(proxyConfig, corev1.EventTypeWarning, ErrResourceExists, msg)
+	return c.proxyConfigFailed(ctx, proxyConfig, nil, configv1.ReasonConfigMapConflict, fmt.Errorf("%s", msg))
 }
 
-// handleObject will take any resource implementing metav1.Object and attempt
-// to find the ProxyConfig resource that 'owns' it. It does this by looking at the
-// objects metadata.ownerReferences field for an appropriate OwnerReference.
-// It then enqueues that ProxyConfig resource to be processed. If the object does not
-// have an appropriate OwnerReference, it will simply be skipped.
-func (c *MaestroController) handleObject(obj interface{}) {
-	var object metav1.Object
-	var ok bool
-	logger := klog.FromContext(context.Background())
-	if object, ok = obj.(metav1.Object); !ok {
-		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
-		if !ok {
-			// If the object value is not too big and does not contain sensitive information, then
-			// it may be useful to include it.
-			utilRuntime.HandleErrorWithContext(context.Background(), nil, "Error decoding object, invalid type", "type", fmt.Sprintf("%T", obj))
-			return
-		}
-		object, ok = tombstone.Obj.(metav1.Object)
-		if !ok {
-			// If the object value is not too big and does not contain sensitive information, then
-			// it may be useful to include it.
-			utilRuntime.HandleErrorWithContext(context.Background(), nil, "Error decoding object tombstone, invalid type", "type", fmt.Sprintf("%T", tombstone.Obj))
-			return
-		}
-		logger.V(4).Info("Recovered deleted object", "resourceName", object.GetName())
-	}
-	logger.V(4).Info("Processing object", "object", klog.KObj(object))
-	if ownerRef := metav1.GetControllerOf(object); ownerRef != nil {
-		// If this object is not owned by a ProxyConfig, we should not do anything more
-		// with it.
-		if ownerRef.Kind != "ProxyConfig" {
-			return
-		}
-
-		proxyConfig, err := c.proxyConfigLister.ByNamespace(object.GetNamespace()).Get(ownerRef.Name)
-		if err != nil {
-			logger.V(4).Info("Ignore orphaned object", "object", klog.KObj(object), "ProxyConfig", ownerRef.Name)
-			return
-		}
-
-		c.enqueueProxyConfig(proxyConfig)
-		return
-	}
+// generationFailed records that the bootstrap of a ProxyConfig resource could not be generated.
+// Its ConfigMap is left unchanged, and it is not requeued until it changes.
+func (c *MaestroController) generationFailed(ctx context.Context, proxyConfig *configv1.ProxyConfig, configMap *corev1.ConfigMap, err error) error {
+	c.recorder.Event(proxyConfig, corev1.EventTypeWarning, ErrGenerationFailed, fmt.Sprintf(MessageGenerationFailed, err))
+	return reconcile.TerminalError(c.proxyConfigFailed(ctx, proxyConfig, configMap, configv1.ReasonGenerationFailed, err))
 }
 
 // newProxyConfigConfigMap creates a new ConfigMap for a ProxyConfig resource. It also sets
-// the appropriate OwnerReferences on the resource so handleObject can discover
-// the ProxyConfig resource that 'owns' it.
-func (c *MaestroController) newProxyConfigConfigMap(proxyConfigU *unstructured.Unstructured) (*corev1.ConfigMap, error) {
-	data, err := c.generateProxyConfigConfigMapData(proxyConfigU)
+// the appropriate OwnerReferences on the resource so the ProxyConfig resource that 'owns' it
+// is requeued when it changes.
+func (c *MaestroController) newProxyConfigConfigMap(proxyConfig *configv1.ProxyConfig) (*corev1.ConfigMap, error) {
+	data, err := c.generateProxyConfigConfigMapData(proxyConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	labels := map[string]string{
-		"controller": controllerAgentName,
-	}
+	labels := map[string]string{}
+	maps.Copy(labels, managedConfigMapLabels)
 	return &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      c.configMapName(proxyConfigU.GetName()),
-			Namespace: proxyConfigU.GetNamespace(),
+			Name:      c.configMapName(proxyConfig.Name),
+			Namespace: proxyConfig.Namespace,
 			OwnerReferences: []metav1.OwnerReference{
-				*metav1.NewControllerRef(proxyConfigU, configv1.SchemeGroupVersion.WithKind("ProxyConfig")),
+				*metav1.NewControllerRef(proxyConfig, configv1.SchemeGroupVersion.WithKind("ProxyConfig")),
 			},
 			Labels: labels,
 		},
@@ -500,18 +424,65 @@ func (c *MaestroController) newProxyConfigConfigMap(proxyConfigU *unstructured.U
 	}, nil
 }
 
-func (c *MaestroController) generateProxyConfigConfigMapData(proxyConfigU *unstructured.Unstructured) (map[string]string, error) {
-	var proxyConfig *configv1.ProxyConfig
-	err := runtime.DefaultUnstructuredConverter.FromUnstructured(proxyConfigU.Object, &proxyConfig)
+// generateProxyConfigConfigMapData returns the files of the ConfigMap of a ProxyConfig: its
+// bootstrap in the requested format, the checksum of the bootstrap, the bootstrap of its outbound
+// listener, and the additional files of the ProxyConfig.
+func (c *MaestroController) generateProxyConfigConfigMapData(proxyConfig *configv1.ProxyConfig) (map[string]string, error) {
+	format, key := c.bootstrapFormat, constants.ProxyBootstrapKey
+	if f := proxyConfig.Spec.GetBootstrap().GetFormat(); f != configv1api.Bootstrap_FORMAT_UNSPECIFIED {
+		format = f
+	}
+	if format == configv1api.Bootstrap_FORMAT_JSON {
+		key = constants.ProxyBootstrapJSONKey
+	}
+
+	options := append(slices.Clone(c.bootstrapOptions), proxy.WithFormat(format))
+	bootstrap, err := proxy.GenerateBootstrap(proxyConfig, c.spiffeTrustDomain, options...)
 	if err != nil {
 		return nil, err
 	}
 
-	return map[string]string{
-		"envoy.yaml": proxy.GenerateBootstrap(proxyConfig, c.spiffeTrustDomain),
-	}, nil
+	data := maps.Clone(proxyConfig.Spec.GetBootstrap().GetFiles())
+	if data == nil {
+		data = map[string]string{}
+	}
+	data[key] = bootstrap
+	// read by the injector, rendered for the pods intercepting their traffic
+	if data[constants.ProxyOutboundBootstrapKey], err = proxy.GenerateOutboundBootstrap(proxyConfig, c.spiffeTrustDomain, options...); err != nil {
+		return nil, err
+	}
+	// in the sha256sum format, to check the bootstrap mounted in a pod with sha256sum -c
+	data[constants.ProxyBootstrapChecksumKey] = fmt.Sprintf("%x  %s\n", sha256.Sum256([]byte(bootstrap)), key)
+	// read by the injector to mount the policies in the OPA sidecar
+	if policy := proxyConfig.Spec.GetService().GetAuthz().GetPolicyConfigMap(); policy != "" {
+		data[constants.ProxyAuthzPolicyKey] = policy
+	}
+	return data, nil
+}
+
+// reconcileRateLimit pushes the rate limits of a ProxyConfig resource to the rate limit server.
+func (c *MaestroController) reconcileRateLimit(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	name := req.NamespacedName.String()
+
+	proxyConfig := &configv1.ProxyConfig{}
+	if err := c.Get(ctx, req.NamespacedName, proxyConfig); err != nil {
+		if errors.IsNotFound(err) {
+			c.rateLimitServer.DeleteConfig(name)
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	rateLimitConfig := proxy.GenerateRateLimitConfig(name, proxyConfig.Namespace, proxyConfig.Spec.GetService())
+	if rateLimitConfig == nil {
+		c.rateLimitServer.DeleteConfig(name)
+		return reconcile.Result{}, nil
+	}
+
+	c.rateLimitServer.SetConfig(rateLimitConfig)
+	return reconcile.Result{}, nil
 }
 
 func (c *MaestroController) configMapName(proxyConfigName string) string {
-	return fmt.Sprintf("%s%s", c.configMapPrefix, proxyConfigName)
+	return config.ProxyConfigMapName(c.configMapPrefix, proxyConfigName)
 }
@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+
+	configv1api "github.com/bpalermo/maestro/api/config/v1"
+	"github.com/bpalermo/maestro/internal/config"
+	"github.com/bpalermo/maestro/internal/config/constants"
+	configv1 "github.com/bpalermo/maestro/pkg/apis/config/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestMaestroController_Reconcile(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, configv1.AddToScheme(scheme))
+
+	proxyConfig := &configv1.ProxyConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders", Namespace: "default", UID: "uid", Generation: 1},
+		Spec: &configv1api.ProxyConfigSpec{
+			Service: &configv1api.Service{
+				Name: "orders",
+				ServicePorts: []*configv1api.Service_ServicePort{{
+					Port: 8080,
+					HealthCheckSpecifier: &configv1api.Service_ServicePort_HttpHealthCheck_{
+						HttpHealthCheck: &configv1api.Service_ServicePort_HttpHealthCheck{Path: "/"},
+					},
+				}},
+			},
+		},
+	}
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "orders"}}
+	configMapKey := types.NamespacedName{Namespace: "default", Name: constants.ProxyConfigMapPrefix + "orders"}
+
+	tests := []struct {
+		name           string
+		objects        []client.Object
+		wantErr        bool
+		expectedReady  metav1.ConditionStatus
+		expectedReason string
+	}{
+		{
+			name:           "creates config map",
+			objects:        []client.Object{proxyConfig.DeepCopy()},
+			expectedReady:  metav1.ConditionTrue,
+			expectedReason: configv1.ReasonSynced,
+		},
+		{
+			name: "config map conflict",
+			objects: []client.Object{
+				proxyConfig.DeepCopy(),
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: configMapKey.Name, Namespace: configMapKey.Namespace}},
+			},
+			wantErr:        true,
+			expectedReady:  metav1.ConditionFalse,
+			expectedReason: configv1.ReasonConfigMapConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &MaestroController{
+				Client: fake.NewClientBuilder().
+					WithScheme(scheme).
+					WithObjects(tt.objects...).
+					WithStatusSubresource(&configv1.ProxyConfig{}).
+					Build(),
+				recorder:        record.NewFakeRecorder(10),
+				configMapPrefix: constants.ProxyConfigMapPrefix,
+			}
+
+			_, err := c.Reconcile(context.Background(), request)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			updated := &configv1.ProxyConfig{}
+			require.NoError(t, c.Get(context.Background(), request.NamespacedName, updated))
+			require.NotNil(t, updated.Status)
+			ready := meta.FindStatusCondition(updated.Status.Conditions, configv1.ConditionReady)
+			require.NotNil(t, ready)
+			assert.Equal(t, tt.expectedReady, ready.Status)
+			assert.Equal(t, tt.expectedReason, ready.Reason)
+
+			if tt.wantErr {
+				return
+			}
+			configMap := &corev1.ConfigMap{}
+			require.NoError(t, c.Get(context.Background(), configMapKey, configMap))
+			assert.True(t, metav1.IsControlledBy(configMap, updated))
+			assert.Contains(t, configMap.Data, constants.ProxyBootstrapKey)
+			assert.Equal(t, configMap.Name, updated.Status.ConfigMapRef.Name)
+		})
+	}
+}
+
+func TestMaestroController_Reconcile_IgnoredSettings(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, configv1.AddToScheme(scheme))
+
+	proxyConfig := &configv1.ProxyConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders", Namespace: "default", UID: "uid"},
+		Spec: &configv1api.ProxyConfigSpec{
+			Service: &configv1api.Service{
+				Name: "orders",
+				ServicePorts: []*configv1api.Service_ServicePort{{
+					Port: 8080,
+					HealthCheckSpecifier: &configv1api.Service_ServicePort_HttpHealthCheck_{
+						HttpHealthCheck: &configv1api.Service_ServicePort_HttpHealthCheck{Path: "/"},
+					},
+				}},
+				AccessLogs: []*configv1api.AccessLog{
+					{Sink: &configv1api.AccessLog_Grpc_{Grpc: &configv1api.AccessLog_Grpc{}}},
+				},
+			},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	c := &MaestroController{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(proxyConfig).
+			WithStatusSubresource(&configv1.ProxyConfig{}).
+			Build(),
+		recorder:        recorder,
+		configMapPrefix: constants.ProxyConfigMapPrefix,
+	}
+
+	_, err := c.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "orders"}})
+	require.NoError(t, err)
+
+	require.Len(t, recorder.Events, 2)
+	assert.Equal(t, "Warning SettingsIgnored gRPC access log 0 is ignored: no access log service is configured", <-recorder.Events)
+	assert.Equal(t, "Normal Synced "+MessageResourceSynced, <-recorder.Events)
+
+	// an unchanged ProxyConfig is synced again without events
+	_, err = c.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "orders"}})
+	require.NoError(t, err)
+	assert.Empty(t, recorder.Events)
+}
+
+func TestMaestroController_GenerateProxyConfigConfigMapData(t *testing.T) {
+	spec := func(bootstrap *configv1api.Bootstrap) *configv1api.ProxyConfigSpec {
+		return &configv1api.ProxyConfigSpec{
+			Service: &configv1api.Service{
+				Name: "orders",
+				ServicePorts: []*configv1api.Service_ServicePort{{
+					Port: 8080,
+					HealthCheckSpecifier: &configv1api.Service_ServicePort_HttpHealthCheck_{
+						HttpHealthCheck: &configv1api.Service_ServicePort_HttpHealthCheck{Path: "/"},
+					},
+				}},
+			},
+			Bootstrap: bootstrap,
+		}
+	}
+
+	tests := []struct {
+		name          string
+		format        configv1api.Bootstrap_Format
+		bootstrap     *configv1api.Bootstrap
+		expectedKeys  []string
+		expectedFiles map[string]string
+	}{
+		{
+			name:         "yaml",
+			format:       configv1api.Bootstrap_FORMAT_YAML,
+			expectedKeys: []string{constants.ProxyBootstrapKey, constants.ProxyBootstrapChecksumKey, constants.ProxyOutboundBootstrapKey},
+		},
+		{
+			name:         "json",
+			format:       configv1api.Bootstrap_FORMAT_JSON,
+			expectedKeys: []string{constants.ProxyBootstrapJSONKey, constants.ProxyBootstrapChecksumKey, constants.ProxyOutboundBootstrapKey},
+		},
+		{
+			name:         "proxy config format",
+			format:       configv1api.Bootstrap_FORMAT_JSON,
+			bootstrap:    &configv1api.Bootstrap{Format: configv1api.Bootstrap_FORMAT_YAML},
+			expectedKeys: []string{constants.ProxyBootstrapKey, constants.ProxyBootstrapChecksumKey, constants.ProxyOutboundBootstrapKey},
+		},
+		{
+			name:          "files",
+			format:        configv1api.Bootstrap_FORMAT_YAML,
+			bootstrap:     &configv1api.Bootstrap{Files: map[string]string{"filter.lua": "function envoy_on_request(handle) end"}},
+			expectedKeys:  []string{constants.ProxyBootstrapKey, constants.ProxyBootstrapChecksumKey, constants.ProxyOutboundBootstrapKey, "filter.lua"},
+			expectedFiles: map[string]string{"filter.lua": "function envoy_on_request(handle) end"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &MaestroController{bootstrapFormat: tt.format}
+			proxyConfig := &configv1.ProxyConfig{Spec: spec(tt.bootstrap)}
+
+			data, err := c.generateProxyConfigConfigMapData(proxyConfig)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.expectedKeys, slices.Collect(maps.Keys(data)))
+			for key, value := range tt.expectedFiles {
+				assert.Equal(t, value, data[key])
+			}
+
+			key := config.ProxyBootstrapKey(data)
+			assert.Equal(t, fmt.Sprintf("%x  %s\n", sha256.Sum256([]byte(data[key])), key), data[constants.ProxyBootstrapChecksumKey])
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bpalermo/maestro/internal/config"
+	"github.com/bpalermo/maestro/internal/config/annotation"
+	"github.com/bpalermo/maestro/internal/config/constants"
+	"github.com/bpalermo/maestro/pkg/injection"
+	"golang.org/x/time/rate"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RolloutConfig configures the restart of the workloads whose proxies run a stale bootstrap.
+type RolloutConfig struct {
+	// Enabled restarts the workloads when the bootstrap of their ProxyConfig changes.
+	Enabled bool
+	// Interval is the minimum interval between two workload restarts in a namespace, once the
+	// burst is spent.
+	Interval time.Duration
+	// Burst is the number of workloads of a namespace restarted at once.
+	Burst int
+}
+
+// Validate checks that the rate limit of the rollouts allows workload restarts.
+func (c *RolloutConfig) Validate() error {
+	if c.Burst < 1 {
+		return fmt.Errorf("rollout burst must be at least 1, got %d", c.Burst)
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("rollout interval must be positive, got %s", c.Interval)
+	}
+	return nil
+}
+
+// workloadRef references a workload owning pods.
+type workloadRef struct {
+	kind string
+	name string
+}
+
+// rollouts restarts the workloads of proxies started with a stale bootstrap, as the proxy only
+// reads its bootstrap at startup. Workloads are restarted by setting the hash of the current
+// bootstrap on their pod template, rate limited by namespace. Pods and workloads are read from
+// the API server rather than cached, as the controller would otherwise watch every pod and workload
+// of the watched namespaces to restart a few of them when a bootstrap changes.
+type rollouts struct {
+	client client.Client
+	reader client.Reader
+	config RolloutConfig
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+	// rolledOut is the bootstrap hash of the ProxyConfigs whose workloads are all restarted
+	rolledOut map[string]string
+}
+
+func newRollouts(client client.Client, reader client.Reader, config RolloutConfig) *rollouts {
+	return &rollouts{
+		client:    client,
+		reader:    reader,
+		config:    config,
+		limiters:  map[string]*rate.Limiter{},
+		rolledOut: map[string]string{},
+	}
+}
+
+// rollout restarts the workloads of the pods of a ProxyConfig started with a bootstrap other than
+// the one of its ConfigMap. It returns the delay after which it must be retried when the rate limit
+// of the namespace is reached.
+func (r *rollouts) rollout(ctx context.Context, proxyConfigName string, configMap *corev1.ConfigMap) (time.Duration, error) {
+	namespace := configMap.Namespace
+	logger := klog.FromContext(ctx).WithValues("proxyConfig", klog.KRef(namespace, proxyConfigName))
+	key := namespace + "/" + proxyConfigName
+	hash := config.ProxyConfigHash(configMap.Data)
+
+	r.mu.Lock()
+	done := r.rolledOut[key] == hash
+	r.mu.Unlock()
+	if done {
+		return 0, nil
+	}
+
+	workloads, err := r.staleWorkloads(ctx, proxyConfigName, configMap)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, workload := range workloads {
+		restarted, err := r.restart(ctx, namespace, workload, hash)
+		if err != nil {
+			return 0, err
+		}
+		if !restarted {
+			logger.Info("Workload rollout rate limited", "kind", workload.kind, "name", workload.name)
+			return r.config.Interval, nil
+		}
+	}
+
+	r.mu.Lock()
+	r.rolledOut[key] = hash
+	r.mu.Unlock()
+
+	return 0, nil
+}
+
+// forget drops the rollout state of a deleted ProxyConfig.
+func (r *rollouts) forget(namespace string, proxyConfigName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.rolledOut, namespace+"/"+proxyConfigName)
+}
+
+// staleWorkloads returns the workloads owning injected pods of a ProxyConfig started with a
+// bootstrap of another hash than the one of its ConfigMap. Pods without hash, injected before the
+// ConfigMap was generated, are only started with the current bootstrap when started after its last
+// update, and when it is written to the YAML key they load.
+func (r *rollouts) staleWorkloads(ctx context.Context, proxyConfigName string, configMap *corev1.ConfigMap) ([]workloadRef, error) {
+	namespace := configMap.Namespace
+	hash := config.ProxyConfigHash(configMap.Data)
+	bootstrapKey := config.ProxyBootstrapKey(configMap.Data)
+	updated := lastUpdate(configMap)
+
+	// the ProxyConfig of a pod may be set by annotation, which cannot be selected server side
+	pods := &corev1.PodList{}
+	if err := r.reader.List(ctx, pods, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("unable to list pods: %w", err)
+	}
+
+	// the owners of the pods of a ReplicaSet are resolved once
+	owners := map[workloadRef]*workloadRef{}
+	seen := map[workloadRef]bool{}
+	var workloads []workloadRef
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Annotations[annotation.SidecarStatus] == "" || config.ProxyConfigName(pod) != proxyConfigName {
+			continue
+		}
+		podHash := pod.Annotations[annotation.ConfigHash]
+		if pod.DeletionTimestamp != nil || podHash == hash {
+			continue
+		}
+		if podHash == "" && bootstrapKey == constants.ProxyBootstrapKey && pod.Status.StartTime != nil && pod.Status.StartTime.After(updated) {
+			continue
+		}
+
+		ref := metav1.GetControllerOf(pod)
+		if ref == nil {
+			continue
+		}
+		controller := workloadRef{kind: ref.Kind, name: ref.Name}
+		workload, ok := owners[controller]
+		if !ok {
+			owner, found, err := r.owner(ctx, pod.Namespace, ref)
+			if err != nil {
+				return nil, err
+			}
+			if found {
+				workload = &owner
+			}
+			owners[controller] = workload
+		}
+		if workload != nil && !seen[*workload] {
+			seen[*workload] = true
+			workloads = append(workloads, *workload)
+		}
+	}
+	return workloads, nil
+}
+
+// lastUpdate returns the time of the last update of an object, recorded by its managed fields,
+// or its creation time when they are not known.
+func lastUpdate(obj metav1.Object) time.Time {
+	updated := obj.GetCreationTimestamp().Time
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Time != nil && entry.Time.After(updated) {
+			updated = entry.Time.Time
+		}
+	}
+	return updated
+}
+
+// owner returns the workload restarting the pods of a controller. Jobs and bare pods are not
+// restarted.
+func (r *rollouts) owner(ctx context.Context, namespace string, ref *metav1.OwnerReference) (workloadRef, bool, error) {
+	switch ref.Kind {
+	case "StatefulSet", "DaemonSet":
+		return workloadRef{kind: ref.Kind, name: ref.Name}, true, nil
+	case "ReplicaSet":
+		replicaSet := &appsv1.ReplicaSet{}
+		if err := r.reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, replicaSet); err != nil {
+			return workloadRef{}, false, fmt.Errorf("unable to get ReplicaSet %s: %w", klog.KRef(namespace, ref.Name), err)
+		}
+		if ref = metav1.GetControllerOf(replicaSet); ref != nil && ref.Kind == "Deployment" {
+			return workloadRef{kind: ref.Kind, name: ref.Name}, true, nil
+		}
+	}
+	return workloadRef{}, false, nil
+}
+
+// restart sets the bootstrap hash on the pod template of a workload, unless it is already set,
+// the workload opted out, or the rate limit of the namespace is reached.
+func (r *rollouts) restart(ctx context.Context, namespace string, workload workloadRef, hash string) (bool, error) {
+	logger := klog.FromContext(ctx).WithValues("kind", workload.kind, "workload", klog.KRef(namespace, workload.name))
+
+	obj, err := newWorkload(workload.kind)
+	if err != nil {
+		return false, err
+	}
+	if err := r.reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: workload.name}, obj); err != nil {
+		return false, fmt.Errorf("unable to get %s %s: %w", workload.kind, klog.KRef(namespace, workload.name), err)
+	}
+
+	template := injection.PodTemplate(obj)
+	if value, ok := obj.GetAnnotations()[annotation.Rollout]; ok {
+		if enabled, err := strconv.ParseBool(value); err == nil && !enabled {
+			logger.V(4).Info("Skipping workload rollout, disabled by annotation")
+			return true, nil
+		}
+	}
+	if template.Annotations[annotation.ConfigHash] == hash {
+		return true, nil
+	}
+
+	if !r.limiter(namespace).Allow() {
+		return false, nil
+	}
+
+	patch, err := json.Marshal(map[string]any{
+		"spec": map[string]any{
+			"template": map[string]any{
+				"metadata": map[string]any{
+					"annotations": map[string]string{annotation.ConfigHash: hash},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if err := r.client.Patch(ctx, obj, client.RawPatch(types.MergePatchType, patch), client.FieldOwner(FieldManager)); err != nil {
+		return false, fmt.Errorf("unable to restart %s %s: %w", workload.kind, klog.KRef(namespace, workload.name), err)
+	}
+
+	logger.Info("Restarted workload to apply the proxy bootstrap", "configHash", hash)
+	return true, nil
+}
+
+func (r *rollouts) limiter(namespace string) *rate.Limiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	limiter, ok := r.limiters[namespace]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Every(r.config.Interval), r.config.Burst)
+		r.limiters[namespace] = limiter
+	}
+	return limiter
+}
+
+// newWorkload returns an empty workload of a kind restarted by rollouts.
+func newWorkload(kind string) (client.Object, error) {
+	switch kind {
+	case "Deployment":
+		return &appsv1.Deployment{}, nil
+	case "StatefulSet":
+		return &appsv1.StatefulSet{}, nil
+	case "DaemonSet":
+		return &appsv1.DaemonSet{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported workload kind %s", kind)
+	}
+}
@@ -0,0 +1,225 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bpalermo/maestro/internal/config"
+	"github.com/bpalermo/maestro/internal/config/annotation"
+	"github.com/bpalermo/maestro/internal/config/constants"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestRollouts_Rollout(t *testing.T) {
+	updated := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+	configMap := func(key string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "proxy-config-orders",
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(updated.Add(-time.Hour)),
+				ManagedFields:     []metav1.ManagedFieldsEntry{{Manager: FieldManager, Time: ptr.To(metav1.NewTime(updated))}},
+			},
+			Data: map[string]string{key: "bootstrap"},
+		}
+	}
+	yamlConfigMap, jsonConfigMap := configMap(constants.ProxyBootstrapKey), configMap(constants.ProxyBootstrapJSONKey)
+	hash := config.ProxyConfigHash(yamlConfigMap.Data)
+
+	controlledBy := func(kind, name string) []metav1.OwnerReference {
+		controller := true
+		return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &controller}}
+	}
+	pod := func(name, owner, serviceAccount, hash string, started *time.Time) *corev1.Pod {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       "default",
+				Annotations:     map[string]string{annotation.SidecarStatus: "{}", annotation.ConfigHash: hash},
+				OwnerReferences: controlledBy("ReplicaSet", owner),
+			},
+			Spec: corev1.PodSpec{ServiceAccountName: serviceAccount},
+		}
+		if started != nil {
+			pod.Status.StartTime = ptr.To(metav1.NewTime(*started))
+		}
+		return pod
+	}
+	deployment := func(name string, annotations map[string]string) *appsv1.Deployment {
+		return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Annotations: annotations}}
+	}
+	replicaSet := func(name, owner string) *appsv1.ReplicaSet {
+		return &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", OwnerReferences: controlledBy("Deployment", owner)}}
+	}
+
+	objects := []client.Object{
+		deployment("stale", nil),
+		replicaSet("stale-1", "stale"),
+		pod("stale-1-a", "stale-1", "orders", "old", nil),
+		pod("stale-1-b", "stale-1", "orders", "old", nil),
+		deployment("current", nil),
+		replicaSet("current-1", "current"),
+		pod("current-1-a", "current-1", "orders", hash, nil),
+		deployment("opted-out", map[string]string{annotation.Rollout: "false"}),
+		replicaSet("opted-out-1", "opted-out"),
+		pod("opted-out-1-a", "opted-out-1", "orders", "old", nil),
+		deployment("other", nil),
+		replicaSet("other-1", "other"),
+		pod("other-1-a", "other-1", "payments", "old", nil),
+		deployment("early", nil),
+		replicaSet("early-1", "early"),
+		pod("early-1-a", "early-1", "orders", "", ptr.To(updated.Add(-time.Minute))),
+		deployment("late", nil),
+		replicaSet("late-1", "late"),
+		pod("late-1-a", "late-1", "orders", "", ptr.To(updated.Add(time.Minute))),
+	}
+
+	templateHash := func(t *testing.T, r *rollouts, name string) string {
+		t.Helper()
+		d := &appsv1.Deployment{}
+		require.NoError(t, r.reader.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, d))
+		return d.Spec.Template.Annotations[annotation.ConfigHash]
+	}
+	newClient := func() client.WithWatch {
+		return crfake.NewClientBuilder().WithObjects(objects...).Build()
+	}
+
+	t.Run("restarts stale workloads", func(t *testing.T) {
+		c := newClient()
+		r := newRollouts(c, c, RolloutConfig{Interval: time.Minute, Burst: 5})
+
+		requeueAfter, err := r.rollout(context.Background(), "orders", yamlConfigMap)
+		require.NoError(t, err)
+		assert.Zero(t, requeueAfter)
+
+		assert.Equal(t, hash, templateHash(t, r, "stale"))
+		assert.Empty(t, templateHash(t, r, "current"))
+		assert.Empty(t, templateHash(t, r, "opted-out"))
+		assert.Empty(t, templateHash(t, r, "other"))
+	})
+
+	t.Run("reads pods and workloads from the API server", func(t *testing.T) {
+		c := newClient()
+		// the cached client of the manager
+		cached := interceptor.NewClient(c, interceptor.Funcs{
+			Get: func(context.Context, client.WithWatch, client.ObjectKey, client.Object, ...client.GetOption) error {
+				return assert.AnError
+			},
+			List: func(context.Context, client.WithWatch, client.ObjectList, ...client.ListOption) error {
+				return assert.AnError
+			},
+		})
+		r := newRollouts(cached, c, RolloutConfig{Interval: time.Minute, Burst: 5})
+
+		_, err := r.rollout(context.Background(), "orders", yamlConfigMap)
+		require.NoError(t, err)
+		assert.Equal(t, hash, templateHash(t, r, "stale"))
+	})
+
+	t.Run("restarts pods without hash started before the ConfigMap update", func(t *testing.T) {
+		c := newClient()
+		r := newRollouts(c, c, RolloutConfig{Interval: time.Minute, Burst: 5})
+
+		_, err := r.rollout(context.Background(), "orders", yamlConfigMap)
+		require.NoError(t, err)
+
+		assert.Equal(t, hash, templateHash(t, r, "early"))
+		assert.Empty(t, templateHash(t, r, "late"))
+	})
+
+	t.Run("resolves each owner once", func(t *testing.T) {
+		gets := map[string]int{}
+		c := interceptor.NewClient(newClient(), interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				if _, ok := obj.(*appsv1.ReplicaSet); ok {
+					gets[key.Name]++
+				}
+				return c.Get(ctx, key, obj, opts...)
+			},
+		})
+		r := newRollouts(c, c, RolloutConfig{Interval: time.Minute, Burst: 5})
+
+		_, err := r.rollout(context.Background(), "orders", yamlConfigMap)
+		require.NoError(t, err)
+		assert.Equal(t, 1, gets["stale-1"])
+		assert.NotContains(t, gets, "other-1")
+	})
+
+	t.Run("restarts workloads injected before a JSON bootstrap", func(t *testing.T) {
+		c := newClient()
+		r := newRollouts(c, c, RolloutConfig{Interval: time.Minute, Burst: 5})
+
+		_, err := r.rollout(context.Background(), "orders", jsonConfigMap)
+		require.NoError(t, err)
+
+		jsonHash := config.ProxyConfigHash(jsonConfigMap.Data)
+		assert.Equal(t, jsonHash, templateHash(t, r, "early"))
+		assert.Equal(t, jsonHash, templateHash(t, r, "late"))
+		assert.Equal(t, jsonHash, templateHash(t, r, "stale"))
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		c := newClient()
+		r := newRollouts(c, c, RolloutConfig{Interval: time.Minute, Burst: 1})
+		require.True(t, r.limiter("default").Allow(), "spends the burst")
+
+		requeueAfter, err := r.rollout(context.Background(), "orders", yamlConfigMap)
+		require.NoError(t, err)
+		assert.Equal(t, time.Minute, requeueAfter)
+		assert.Empty(t, templateHash(t, r, "stale"))
+	})
+}
+
+func TestRolloutConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      RolloutConfig
+		expectedErr bool
+	}{
+		{
+			name:   "valid",
+			config: RolloutConfig{Interval: time.Minute, Burst: 1},
+		},
+		{
+			name:        "no burst",
+			config:      RolloutConfig{Interval: time.Minute},
+			expectedErr: true,
+		},
+		{
+			name:        "negative burst",
+			config:      RolloutConfig{Interval: time.Minute, Burst: -1},
+			expectedErr: true,
+		},
+		{
+			name:        "no interval",
+			config:      RolloutConfig{Burst: 5},
+			expectedErr: true,
+		},
+		{
+			name:        "negative interval",
+			config:      RolloutConfig{Interval: -time.Second, Burst: 5},
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/bpalermo/maestro/internal/config"
+	configv1 "github.com/bpalermo/maestro/pkg/apis/config/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// proxyConfigStatus returns the status of a ProxyConfig of the given generation after a sync. The
+// ConfigMap is the one holding its bootstrap, nil if it is unknown. A failed sync keeps the
+// reference and hash of the previously generated bootstrap, still used by the proxies.
+func proxyConfigStatus(current *configv1.ProxyConfigStatus, generation int64, configMap *corev1.ConfigMap, reason string, syncErr error) *configv1.ProxyConfigStatus {
+	status := current.DeepCopy()
+	if status == nil {
+		status = &configv1.ProxyConfigStatus{}
+	}
+	status.ObservedGeneration = generation
+
+	if configMap != nil {
+		status.ConfigMapRef = &configv1.ConfigMapReference{
+			Name:            configMap.Name,
+			ResourceVersion: configMap.ResourceVersion,
+		}
+		status.BootstrapHash = config.ProxyConfigHash(configMap.Data)
+	}
+
+	ready := metav1.Condition{
+		Type:               configv1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             configv1.ReasonSynced,
+		Message:            MessageResourceSynced,
+	}
+	degraded := metav1.Condition{
+		Type:               configv1.ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             configv1.ReasonSynced,
+	}
+	if syncErr != nil {
+		ready.Status, ready.Reason, ready.Message = metav1.ConditionFalse, reason, syncErr.Error()
+		degraded.Status, degraded.Reason, degraded.Message = metav1.ConditionTrue, reason, syncErr.Error()
+	}
+	meta.SetStatusCondition(&status.Conditions, ready)
+	meta.SetStatusCondition(&status.Conditions, degraded)
+
+	return status
+}
+
+// updateProxyConfigStatus updates the status block of a ProxyConfig resource after a sync, unless
+// it is unchanged. It returns whether the status was updated, which it is whenever the generation,
+// the ConfigMap or a condition of the ProxyConfig changes.
+func (c *MaestroController) updateProxyConfigStatus(ctx context.Context, proxyConfig *configv1.ProxyConfig, configMap *corev1.ConfigMap, reason string, syncErr error) (bool, error) {
+	status := proxyConfigStatus(proxyConfig.Status, proxyConfig.Generation, configMap, reason, syncErr)
+	if equality.Semantic.DeepEqual(proxyConfig.Status, status) {
+		return false, nil
+	}
+
+	// NEVER modify objects from the store. It's a read-only, local cache.
+	// You can use DeepCopy() to make a deep copy of the original object and modify this copy
+	// Or create a copy manually for better performance
+	proxyConfigCopy := proxyConfig.DeepCopy()
+	proxyConfigCopy.Status = status
+
+	// Patching the status subresource will not allow changes to the Spec of the resource,
+	// which is ideal for ensuring nothing other than resource status has been updated.
+	if err := c.Status().Patch(ctx, proxyConfigCopy, client.MergeFrom(proxyConfig), client.FieldOwner(FieldManager)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// proxyConfigFailed records a failed sync in the status of a ProxyConfig resource, and returns
+// the sync error so the resource is requeued.
+func (c *MaestroController) proxyConfigFailed(ctx context.Context, proxyConfig *configv1.ProxyConfig, configMap *corev1.ConfigMap, reason string, syncErr error) error {
+	if _, err := c.updateProxyConfigStatus(ctx, proxyConfig, configMap, reason, syncErr); err != nil {
+		klog.FromContext(ctx).Error(err, "Unable to update ProxyConfig status")
+	}
+	return syncErr
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bpalermo/maestro/internal/config"
+	configv1 "github.com/bpalermo/maestro/pkg/apis/config/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestProxyConfigStatus(t *testing.T) {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "maestro-proxy-config-orders", ResourceVersion: "42"},
+		Data:       map[string]string{"envoy.yaml": "{}"},
+	}
+	synced := proxyConfigStatus(nil, 2, configMap, configv1.ReasonSynced, nil)
+
+	tests := []struct {
+		name           string
+		current        *configv1.ProxyConfigStatus
+		configMap      *corev1.ConfigMap
+		reason         string
+		syncErr        error
+		expectedReady  metav1.ConditionStatus
+		expectedReason string
+	}{
+		{
+			name:           "synced",
+			configMap:      configMap,
+			reason:         configv1.ReasonSynced,
+			expectedReady:  metav1.ConditionTrue,
+			expectedReason: configv1.ReasonSynced,
+		},
+		{
+			name:           "config map conflict",
+			reason:         configv1.ReasonConfigMapConflict,
+			syncErr:        errors.New("already exists"),
+			expectedReady:  metav1.ConditionFalse,
+			expectedReason: configv1.ReasonConfigMapConflict,
+		},
+		{
+			name:           "generation failed after sync",
+			current:        synced,
+			configMap:      configMap,
+			reason:         configv1.ReasonGenerationFailed,
+			syncErr:        errors.New("invalid bootstrap"),
+			expectedReady:  metav1.ConditionFalse,
+			expectedReason: configv1.ReasonGenerationFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := proxyConfigStatus(tt.current, 3, tt.configMap, tt.reason, tt.syncErr)
+			assert.Equal(t, int64(3), status.ObservedGeneration)
+
+			ready := meta.FindStatusCondition(status.Conditions, configv1.ConditionReady)
+			require.NotNil(t, ready)
+			assert.Equal(t, tt.expectedReady, ready.Status)
+			assert.Equal(t, tt.expectedReason, ready.Reason)
+			assert.Equal(t, int64(3), ready.ObservedGeneration)
+
+			degraded := meta.FindStatusCondition(status.Conditions, configv1.ConditionDegraded)
+			require.NotNil(t, degraded)
+			assert.Equal(t, tt.syncErr != nil, degraded.Status == metav1.ConditionTrue)
+
+			if tt.configMap == nil {
+				assert.Nil(t, status.ConfigMapRef)
+				assert.Empty(t, status.BootstrapHash)
+				return
+			}
+			assert.Equal(t, &configv1.ConfigMapReference{Name: configMap.Name, ResourceVersion: "42"}, status.ConfigMapRef)
+			assert.Equal(t, config.ProxyConfigHash(configMap.Data), status.BootstrapHash)
+		})
+	}
+
+	t.Run("unchanged", func(t *testing.T) {
+		assert.Equal(t, synced, proxyConfigStatus(synced, 2, configMap, configv1.ReasonSynced, nil))
+	})
+}
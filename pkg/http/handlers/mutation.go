@@ -1,30 +1,78 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/bpalermo/maestro/internal/config"
 	"github.com/bpalermo/maestro/internal/config/annotation"
+	"github.com/bpalermo/maestro/internal/config/constants"
+	"github.com/bpalermo/maestro/internal/proxy"
+	"github.com/bpalermo/maestro/internal/proxy/envoy"
+	configv1 "github.com/bpalermo/maestro/pkg/apis/config/v1"
+	"github.com/bpalermo/maestro/pkg/injection"
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
 	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// podTemplatePath is the path of the pod template in the supported workloads
+	podTemplatePath = "/spec/template"
 )
 
 var (
-	ignoredNamespaces = []string{
-		metav1.NamespaceSystem,
-		metav1.NamespacePublic,
-	}
+	// nativeSidecarsMinVersion is the first version enabling native sidecars by default
+	nativeSidecarsMinVersion = version.MustParseGeneric("1.29.0")
+
+	// errProxyConfigMapPending is returned when the ConfigMap of an existing ProxyConfig is not generated yet
+	errProxyConfigMapPending = errors.New("proxy ConfigMap not generated yet")
 )
 
 type AdmissionMutationHandler struct {
-	logger  klog.Logger
-	decoder runtime.Decoder
+	logger     klog.Logger
+	decoder    runtime.Decoder
+	kubeClient kubernetes.Interface
+	// namespaces lists the cached namespaces of the pods, whose labels the injection policy
+	// selects. Namespaces are read from the API server when nil.
+	namespaces corelisters.NamespaceLister
+	// proxyConfigs reads the ProxyConfig of the pods whose ConfigMap is not generated yet. Pods are
+	// injected without it when nil.
+	proxyConfigs client.Reader
+	// nativeSidecars is whether the cluster supports native sidecars
+	nativeSidecars bool
+	// configMapPrefix is the prefix of the ConfigMaps generated by the controller
+	configMapPrefix string
+	// templates provides the template of the injected sidecar
+	templates SidecarTemplateProvider
+	// policy selects the pods injected
+	policy *injection.Policy
+	// configMaps are the proxy ConfigMaps read offline, without a cluster
+	configMaps []corev1.ConfigMap
+}
+
+// SidecarTemplateProvider provides the current template of the injected sidecar.
+type SidecarTemplateProvider interface {
+	Template() *config.SidecarTemplate
 }
 
 type patchOperation struct {
@@ -33,26 +81,85 @@ type patchOperation struct {
 	Value interface{} `json:"value,omitempty"`
 }
 
-func NewAdmissionMutationHandler(logger klog.Logger) (*AdmissionMutationHandler, error) {
+func NewAdmissionMutationHandler(logger klog.Logger, kubeClient kubernetes.Interface, namespaces corelisters.NamespaceLister, proxyConfigs client.Reader, configMapPrefix string, templates SidecarTemplateProvider, policy *injection.Policy) (*AdmissionMutationHandler, error) {
 	runtimeScheme := runtime.NewScheme()
-	if err := admissionv1.AddToScheme(runtimeScheme); err != nil {
-		return nil, err
+	for _, addToScheme := range []func(*runtime.Scheme) error{
+		admissionv1.AddToScheme,
+		corev1.AddToScheme,
+		appsv1.AddToScheme,
+		batchv1.AddToScheme,
+	} {
+		if err := addToScheme(runtimeScheme); err != nil {
+			return nil, err
+		}
 	}
 
 	return &AdmissionMutationHandler{
 		logger,
 		serializer.NewCodecFactory(runtimeScheme).UniversalDeserializer(),
+		kubeClient,
+		namespaces,
+		proxyConfigs,
+		supportsNativeSidecars(kubeClient.Discovery(), logger),
+		configMapPrefix,
+		templates,
+		policy,
+		nil,
 	}, nil
 }
 
+// NewOfflineMutationHandler returns a handler injecting pods without a cluster, for manifests
+// injected ahead of their deployment. The injection policy is evaluated against a namespace
+// without labels, so its namespace selector must select any namespace for pods to be injected.
+func NewOfflineMutationHandler(logger klog.Logger, configMapPrefix string, templates SidecarTemplateProvider, policy *injection.Policy, nativeSidecars bool) *AdmissionMutationHandler {
+	return &AdmissionMutationHandler{
+		logger:          logger,
+		nativeSidecars:  nativeSidecars,
+		configMapPrefix: configMapPrefix,
+		templates:       templates,
+		policy:          policy,
+	}
+}
+
+// WithConfigMaps sets the proxy ConfigMaps generated by the controller read by an offline
+// handler, matched by name, and by namespace when both the pod and the ConfigMap set one. Pods
+// whose ConfigMap is not given are injected without the settings it holds: the OPA sidecar, the
+// outbound listener of their ProxyConfig and the config hash.
+func (h *AdmissionMutationHandler) WithConfigMaps(configMaps []corev1.ConfigMap) *AdmissionMutationHandler {
+	h.configMaps = configMaps
+	return h
+}
+
+// supportsNativeSidecars checks the version of the API server. Regular containers are used
+// when the version cannot be determined, as they are supported by all clusters.
+func supportsNativeSidecars(serverVersion discovery.ServerVersionInterface, logger klog.Logger) bool {
+	info, err := serverVersion.ServerVersion()
+	if err != nil {
+		logger.Error(err, "unable to get the server version, native sidecars disabled")
+		return false
+	}
+
+	v, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		logger.Error(err, "unable to parse the server version, native sidecars disabled", "version", info.GitVersion)
+		return false
+	}
+
+	return v.AtLeast(nativeSidecarsMinVersion)
+}
+
 func (h *AdmissionMutationHandler) Handle(request *admissionv1.AdmissionReview, response *admissionv1.AdmissionReview) error {
 	podGVR := metav1.GroupVersionResource{
-		Group:    "core",
+		Group:    corev1.GroupName,
 		Version:  "v1",
 		Resource: "pods",
 	}
 
 	if request.Request.Resource != podGVR {
+		if h.policy.InjectWorkloads && injection.IsWorkloadResource(request.Request.Resource) {
+			response.SetGroupVersionKind(request.GroupVersionKind())
+			return h.mutateWorkload(request.Request, response)
+		}
 		return errors.New("admission request is not of kind: Pod")
 	}
 
@@ -63,29 +170,236 @@ func (h *AdmissionMutationHandler) Handle(request *admissionv1.AdmissionReview,
 		return handleError(err, "unable to unmarshall request to deployment", h.logger)
 	}
 
+	// the namespace of pods being created is only set on the request
+	if pod.Namespace == "" {
+		pod.Namespace = request.Request.Namespace
+	}
+
 	response.SetGroupVersionKind(request.GroupVersionKind())
 
-	return h.mutate(pod, response)
+	return h.mutate(pod, false, response)
 }
 
-func (h *AdmissionMutationHandler) mutate(pod corev1.Pod, response *admissionv1.AdmissionReview) error {
-	// determine whether to perform a mutation
-	if !h.mutationRequired(ignoredNamespaces, &pod.ObjectMeta) {
-		h.logger.Info("Skipping mutation for %s/%s due to policy check", pod.Namespace, pod.Name)
-		response.Response.Allowed = true
+// mutateWorkload mutates the pod template of a workload as its pods would be, rebasing the
+// patch of the pod on the template.
+func (h *AdmissionMutationHandler) mutateWorkload(request *admissionv1.AdmissionRequest, response *admissionv1.AdmissionReview) error {
+	obj, _, err := h.decoder.Decode(request.Object.Raw, nil, nil)
+	if err != nil {
+		return handleError(err, fmt.Sprintf("unable to unmarshall request to %s", request.Resource.Resource), h.logger)
+	}
+
+	template := injection.PodTemplate(obj)
+	if template == nil {
+		return fmt.Errorf("admission request of %s has no pod template", request.Resource.Resource)
+	}
+
+	if err := h.mutate(*injection.TemplatePod(request.Namespace, template), true, response); err != nil {
+		return err
+	}
+	if response.Response.Patch == nil {
 		return nil
 	}
 
-	podAnnotations := map[string]string{annotation.SidecarStatus: "injected"}
+	var patch []patchOperation
+	if err := json.Unmarshal(response.Response.Patch, &patch); err != nil {
+		return handleError(err, "unable to unmarshal the pod patch", h.logger)
+	}
+	for i := range patch {
+		patch[i].Path = podTemplatePath + patch[i].Path
+	}
+	if response.Response.Patch, err = json.Marshal(patch); err != nil {
+		return handleError(err, "unable to marshal patch into bytes", h.logger)
+	}
 
-	sidecarConfig := config.NewSidecarConfig(pod.ObjectMeta.Annotations)
+	return nil
+}
 
-	patchBytes, err := createPatch(&pod, sidecarConfig, podAnnotations)
+// InjectPod returns a copy of a pod mutated as at its admission.
+func (h *AdmissionMutationHandler) InjectPod(pod *corev1.Pod) (*corev1.Pod, error) {
+	response := &admissionv1.AdmissionReview{Response: &admissionv1.AdmissionResponse{}}
+	if err := h.mutate(*pod.DeepCopy(), false, response); err != nil {
+		return nil, err
+	}
+	if !response.Response.Allowed {
+		return nil, errors.New(response.Response.Result.Message)
+	}
+	if response.Response.Patch == nil {
+		return pod.DeepCopy(), nil
+	}
+
+	original, err := json.Marshal(pod)
 	if err != nil {
-		return handleError(err, "unable to marshal patch into bytes", h.logger)
+		return nil, err
+	}
+	patch, err := jsonpatch.DecodePatch(response.Response.Patch)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := patch.Apply(original)
+	if err != nil {
+		return nil, fmt.Errorf("unable to apply the injection patch: %w", err)
+	}
+
+	out := &corev1.Pod{}
+	if err := json.Unmarshal(patched, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// mutate injects a pod, or the pod of a workload template. Pods whose ProxyConfig exists without
+// its generated ConfigMap are refused until it is, as their proxy would load a bootstrap expecting
+// sidecars that are not injected. Templates are injected regardless, their pods being reconciled
+// at their admission.
+func (h *AdmissionMutationHandler) mutate(pod corev1.Pod, template bool, response *admissionv1.AdmissionReview) error {
+	logger := h.logger.WithValues("pod", klog.KObj(&pod))
+
+	status, err := config.ParseSidecarStatus(pod.Annotations[annotation.SidecarStatus])
+	if err != nil {
+		return handleError(err, fmt.Sprintf("unable to parse annotation %s: %v", annotation.SidecarStatus, err), h.logger)
+	}
+
+	// injected pods are compared with the pod this revision would inject, once uninjected
+	target := &pod
+	if status != nil {
+		if status.Revision != h.policy.Revision {
+			logger.V(4).Info("Skipping mutation, pod is injected by another revision", "revision", status.Revision)
+			response.Response.Allowed = true
+			return nil
+		}
+		if status.Legacy() {
+			logger.V(4).Info("Skipping mutation, pod is already injected")
+			response.Response.Allowed = true
+			return nil
+		}
+		if target, err = injection.Uninject(&pod); err != nil {
+			return handleError(err, fmt.Sprintf("unable to uninject pod: %v", err), h.logger)
+		}
+	}
+
+	// determine whether to perform a mutation
+	required, err := h.mutationRequired(target)
+	if err != nil {
+		return handleError(err, fmt.Sprintf("unable to evaluate the injection policy: %v", err), h.logger)
+	}
+
+	var sidecarConfig *config.SidecarConfig
+	var sidecarStatus *config.SidecarStatus
+	var probes *probeRewrite
+	var configHash string
+	if required {
+		sidecarTemplate := h.templates.Template()
+		values, err := sidecarTemplate.Values().WithOverrides(target.Annotations)
+		if err != nil {
+			return handleError(err, fmt.Sprintf("unable to render sidecar: %v", err), h.logger)
+		}
+
+		rewriteAppProbes := h.policy.RewriteProbes
+		if value, ok := target.Annotations[annotation.SidecarRewriteProbes]; ok {
+			if rewriteAppProbes, err = strconv.ParseBool(value); err != nil {
+				return handleError(err, fmt.Sprintf("annotation %s must be a boolean", annotation.SidecarRewriteProbes), h.logger)
+			}
+		}
+		// intercepted probes would reach the mTLS listener of the proxy
+		if values.InterceptTraffic && !rewriteAppProbes {
+			logger.V(4).Info("Rewriting probes of pod intercepting traffic")
+			rewriteAppProbes = true
+		}
+		if rewriteAppProbes {
+			probes = rewriteProbes(target)
+		}
+
+		proxyConfigName := config.ProxyConfigName(target)
+		configMapName := config.ProxyConfigMapName(h.configMapPrefix, proxyConfigName)
+		proxyConfigData, err := h.proxyConfigMapData(target.Namespace, proxyConfigName, configMapName)
+		if errors.Is(err, errProxyConfigMapPending) {
+			if !template {
+				logger.Info("Refusing pod until the ConfigMap of its ProxyConfig is generated", "configMap", klog.KRef(target.Namespace, configMapName))
+				response.Response.Allowed = false
+				response.Response.Result = &metav1.Status{
+					Status:  metav1.StatusFailure,
+					Message: fmt.Sprintf("ConfigMap %s of ProxyConfig %s is not generated yet, retry later", configMapName, proxyConfigName),
+					Reason:  metav1.StatusReasonServiceUnavailable,
+					Code:    http.StatusServiceUnavailable,
+				}
+				return nil
+			}
+			err = nil
+		}
+		if err != nil {
+			return handleError(err, fmt.Sprintf("unable to get the proxy configuration: %v", err), h.logger)
+		}
+		if proxyConfigData != nil {
+			configHash = config.ProxyConfigHash(proxyConfigData)
+		}
+		if sidecarConfig, err = sidecarTemplate.Render(target, configMapName, proxyConfigData); err != nil {
+			return handleError(err, fmt.Sprintf("unable to render sidecar: %v", err), h.logger)
+		}
+		if !h.nativeSidecars {
+			sidecarConfig = sidecarConfig.WithoutNativeSidecars()
+		}
+		// the listeners specific to the pod are part of the sidecar, so that its template hash changes with them
+		var probeRoutes []envoy.ProbeRoute
+		if probes != nil {
+			probeRoutes = probes.routes
+		}
+		sidecarBootstrap, err := proxy.GenerateSidecarBootstrap(probeRoutes, values.InterceptTraffic, proxyConfigData[constants.ProxyOutboundBootstrapKey])
+		if err != nil {
+			return handleError(err, fmt.Sprintf("unable to render sidecar: %v", err), h.logger)
+		}
+		if sidecarBootstrap != "" {
+			sidecarConfig = sidecarConfig.WithProxyArgs("--config-yaml", sidecarBootstrap)
+		}
+		if sidecarStatus, err = config.NewSidecarStatus(sidecarConfig, h.policy.Revision); err != nil {
+			return handleError(err, fmt.Sprintf("unable to render sidecar: %v", err), h.logger)
+		}
+	}
+
+	var patch []patchOperation
+	if status != nil {
+		if required && sidecarStatus.TemplateHash == status.TemplateHash {
+			logger.V(4).Info("Skipping mutation, pod is already injected", "templateHash", status.TemplateHash)
+			response.Response.Allowed = true
+			return nil
+		}
+
+		if required && h.policy.Drift == injection.DriftPolicyRefuse {
+			logger.Info("Refusing pod injected with a stale sidecar template", "templateHash", status.TemplateHash)
+			response.Response.Allowed = false
+			response.Response.Result = &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Message: fmt.Sprintf("pod sidecars are injected with stale template %s, remove them or resubmit the pod without the %s annotation", status.TemplateHash, annotation.SidecarStatus),
+				Reason:  metav1.StatusReasonInvalid,
+				Code:    http.StatusUnprocessableEntity,
+			}
+			return nil
+		}
+
+		logger.Info("Reconciling pod injected with a stale sidecar template", "templateHash", status.TemplateHash)
+		patch = resetPatch(&pod, target)
+	}
+
+	if required {
+		podAnnotations := map[string]string{annotation.SidecarStatus: sidecarStatus.String()}
+		if configHash != "" {
+			podAnnotations[annotation.ConfigHash] = configHash
+		}
+		injectPatch, err := injectionPatch(target, sidecarConfig, podAnnotations, probes)
+		if err != nil {
+			return handleError(err, "unable to create the injection patch", h.logger)
+		}
+		patch = append(patch, injectPatch...)
 	}
 
 	response.Response.Allowed = true
+	if len(patch) == 0 {
+		return nil
+	}
+
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		return handleError(err, "unable to marshal patch into bytes", h.logger)
+	}
 
 	patchType := admissionv1.PatchTypeJSONPatch
 	response.Response.PatchType = &patchType
@@ -95,85 +409,186 @@ func (h *AdmissionMutationHandler) mutate(pod corev1.Pod, response *admissionv1.
 }
 
 // mutationRequired checks whether the target resource needs to be mutated
-func (h *AdmissionMutationHandler) mutationRequired(ignoredList []string, metadata *metav1.ObjectMeta) bool {
-	// skip special kubernetes system namespaces
-	for _, namespace := range ignoredList {
-		if metadata.Namespace == namespace {
-			h.logger.Info("Skip mutation for %v for it's in special namespace:%v", metadata.Name, metadata.Namespace)
-			return false
+func (h *AdmissionMutationHandler) mutationRequired(pod *corev1.Pod) (bool, error) {
+	logger := h.logger.WithValues("pod", klog.KObj(pod))
+
+	// determine whether to perform mutation based on annotation for the target resource
+	switch strings.ToLower(pod.GetAnnotations()[annotation.SidecarInject]) {
+	case "n", "not", "false", "off":
+		logger.V(4).Info("Skipping mutation, injection is disabled by annotation")
+		return false, nil
+	}
+
+	// offline, the namespace of the pod is unknown
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: pod.Namespace}}
+	if h.kubeClient != nil {
+		var err error
+		if namespace, err = h.namespace(pod.Namespace); err != nil {
+			return false, fmt.Errorf("unable to get namespace %s: %w", pod.Namespace, err)
 		}
 	}
 
-	podAnnotations := metadata.GetAnnotations()
+	required, reason, err := h.policy.InjectionRequired(namespace, pod)
+	if err != nil {
+		return false, err
+	}
+	if !required {
+		logger.V(4).Info("Skipping mutation due to the injection policy", "reason", reason)
+	}
+	return required, nil
+}
 
-	status := podAnnotations[annotation.SidecarStatus]
+// namespace returns a namespace from the cache, or from the API server when it is not cached,
+// such as a namespace created moments before its first pods.
+func (h *AdmissionMutationHandler) namespace(name string) (*corev1.Namespace, error) {
+	if h.namespaces != nil {
+		namespace, err := h.namespaces.Get(name)
+		if !apierrors.IsNotFound(err) {
+			return namespace, err
+		}
+	}
+	return h.kubeClient.CoreV1().Namespaces().Get(context.TODO(), name, metav1.GetOptions{})
+}
 
-	// determine whether to perform mutation based on annotation for the target resource
-	var required bool
-	if strings.ToLower(status) == "injected" {
-		required = false
-	} else {
-		switch strings.ToLower(podAnnotations[annotation.SidecarInject]) {
-		default:
-			required = true
-		case "n", "not", "false", "off":
-			required = false
+// proxyConfigMapData returns the data of the ConfigMap generated by the controller for the
+// proxy, holding its bootstrap and the ConfigMap of its OPA policies. It returns nil when the
+// ConfigMap is not generated yet, and errProxyConfigMapPending if its ProxyConfig exists.
+func (h *AdmissionMutationHandler) proxyConfigMapData(namespace string, proxyConfigName string, configMapName string) (map[string]string, error) {
+	if h.kubeClient == nil {
+		for _, configMap := range h.configMaps {
+			if configMap.Name == configMapName && (configMap.Namespace == "" || namespace == "" || configMap.Namespace == namespace) {
+				return configMap.Data, nil
+			}
 		}
+		return nil, nil
 	}
 
-	h.logger.Info("Mutation policy for %v/%v: status: %q required:%v", metadata.Namespace, metadata.Name, status, required)
-	return required
+	configMap, err := h.kubeClient.CoreV1().ConfigMaps(namespace).Get(context.TODO(), configMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, h.proxyConfigPending(namespace, proxyConfigName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get ConfigMap %s: %w", klog.KRef(namespace, configMapName), err)
+	}
+
+	return configMap.Data, nil
 }
 
-// create the mutation patch for resources
-func createPatch(pod *corev1.Pod, sidecarConfig *config.SidecarConfig, annotations map[string]string) ([]byte, error) {
+// proxyConfigPending returns errProxyConfigMapPending when the ProxyConfig of a proxy without
+// ConfigMap exists, the controller generating it shortly.
+func (h *AdmissionMutationHandler) proxyConfigPending(namespace string, proxyConfigName string) error {
+	if h.proxyConfigs == nil {
+		return nil
+	}
+
+	err := h.proxyConfigs.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: proxyConfigName}, &configv1.ProxyConfig{})
+	if apierrors.IsNotFound(err) {
+		h.logger.V(4).Info("ProxyConfig not found, injecting without its ConfigMap", "proxyConfig", klog.KRef(namespace, proxyConfigName))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get ProxyConfig %s: %w", klog.KRef(namespace, proxyConfigName), err)
+	}
+	return errProxyConfigMapPending
+}
+
+// injectionPatch returns the operations adding the sidecars to a pod, and rewriting its probes
+// when probes is not nil.
+func injectionPatch(pod *corev1.Pod, sidecarConfig *config.SidecarConfig, annotations map[string]string, probes *probeRewrite) ([]patchOperation, error) {
 	var patch []patchOperation
 
-	patch = append(patch, addContainer(pod.Spec.Containers, sidecarConfig.Containers, "/spec/containers")...)
+	// probes are rewritten first, as the container indexes change once the sidecars are added
+	if probes != nil {
+		value, err := json.Marshal(probes.originals)
+		if err != nil {
+			return nil, err
+		}
+		annotations = maps.Clone(annotations)
+		annotations[annotation.SidecarOriginalProbes] = string(value)
+		patch = append(patch, probes.patch...)
+	}
+
+	patch = append(patch, prependContainers(pod.Spec.InitContainers, sidecarConfig.InitContainers, "/spec/initContainers")...)
+	patch = append(patch, prependContainers(pod.Spec.Containers, sidecarConfig.Containers, "/spec/containers")...)
 	patch = append(patch, addVolume(pod.Spec.Volumes, sidecarConfig.Volumes, "/spec/volumes")...)
 	patch = append(patch, updateAnnotation(pod.Annotations, annotations)...)
 
-	return json.Marshal(patch)
+	return patch, nil
+}
+
+// resetPatch returns the operations reverting an injected pod to its uninjected state, so that
+// the injection patch computed on the uninjected pod applies after them.
+func resetPatch(pod *corev1.Pod, uninjected *corev1.Pod) (patch []patchOperation) {
+	for _, field := range []struct {
+		path        string
+		current     any
+		target      any
+		targetEmpty bool
+	}{
+		{"/spec/initContainers", pod.Spec.InitContainers, uninjected.Spec.InitContainers, len(uninjected.Spec.InitContainers) == 0},
+		{"/spec/containers", pod.Spec.Containers, uninjected.Spec.Containers, len(uninjected.Spec.Containers) == 0},
+		{"/spec/volumes", pod.Spec.Volumes, uninjected.Spec.Volumes, len(uninjected.Spec.Volumes) == 0},
+		{"/metadata/annotations", pod.Annotations, uninjected.Annotations, len(uninjected.Annotations) == 0},
+	} {
+		if equality.Semantic.DeepEqual(field.current, field.target) {
+			continue
+		}
+		if field.targetEmpty {
+			patch = append(patch, patchOperation{Op: "remove", Path: field.path})
+			continue
+		}
+		patch = append(patch, patchOperation{Op: "replace", Path: field.path, Value: field.target})
+	}
+	return patch
 }
 
 func updateAnnotation(target map[string]string, added map[string]string) (patch []patchOperation) {
+	if len(added) == 0 {
+		return patch
+	}
+
+	if len(target) == 0 {
+		return append(patch, patchOperation{
+			Op:    "add",
+			Path:  "/metadata/annotations",
+			Value: added,
+		})
+	}
+
 	for key, value := range added {
-		if target == nil || target[key] == "" {
-			target = map[string]string{}
-			patch = append(patch, patchOperation{
-				Op:   "add",
-				Path: "/metadata/annotations",
-				Value: map[string]string{
-					key: value,
-				},
-			})
-		} else {
-			patch = append(patch, patchOperation{
-				Op:    "replace",
-				Path:  "/metadata/annotations/" + key,
-				Value: value,
-			})
+		op := "add"
+		if _, exists := target[key]; exists {
+			op = "replace"
 		}
+		patch = append(patch, patchOperation{
+			Op:    op,
+			Path:  "/metadata/annotations/" + escapeJSONPointer(key),
+			Value: value,
+		})
 	}
 	return patch
 }
 
-func addContainer(target, added []corev1.Container, basePath string) (patch []patchOperation) {
-	first := len(target) == 0
-	var value interface{}
-	for _, add := range added {
-		value = add
-		path := basePath
-		if first {
-			first = false
-			value = []corev1.Container{add}
-		} else {
-			path = path + "/-"
-		}
+// prependContainers inserts the added containers before the target ones, keeping their order,
+// so that they are started first.
+func prependContainers(target, added []corev1.Container, basePath string) (patch []patchOperation) {
+	if len(added) == 0 {
+		return patch
+	}
+
+	if len(target) == 0 {
+		return append(patch, patchOperation{
+			Op:    "add",
+			Path:  basePath,
+			Value: added,
+		})
+	}
+
+	for i, add := range added {
 		patch = append(patch, patchOperation{
 			Op:    "add",
-			Path:  path,
-			Value: value,
+			Path:  fmt.Sprintf("%s/%d", basePath, i),
+			Value: add,
 		})
 	}
 	return patch
@@ -199,3 +614,8 @@ func addVolume(target, added []corev1.Volume, basePath string) (patch []patchOpe
 	}
 	return patch
 }
+
+// escapeJSONPointer escapes a JSON pointer reference token as defined in RFC 6901.
+func escapeJSONPointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
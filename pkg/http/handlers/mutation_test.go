@@ -0,0 +1,719 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/bpalermo/maestro/internal/config"
+	"github.com/bpalermo/maestro/internal/config/annotation"
+	"github.com/bpalermo/maestro/internal/config/constants"
+	"github.com/bpalermo/maestro/internal/config/label"
+	configv1 "github.com/bpalermo/maestro/pkg/apis/config/v1"
+	"github.com/bpalermo/maestro/pkg/injection"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2/ktesting"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func applyPatch(t *testing.T, pod *corev1.Pod, patch []byte) *corev1.Pod {
+	t.Helper()
+
+	original, err := json.Marshal(pod)
+	require.NoError(t, err)
+
+	decoded, err := jsonpatch.DecodePatch(patch)
+	require.NoError(t, err)
+
+	patched, err := decoded.Apply(original)
+	require.NoError(t, err)
+
+	out := &corev1.Pod{}
+	require.NoError(t, json.Unmarshal(patched, out))
+	return out
+}
+
+// marshalledInjectionPatch returns the JSON patch adding the sidecars to a pod.
+func marshalledInjectionPatch(t *testing.T, pod *corev1.Pod, sidecarConfig *config.SidecarConfig, annotations map[string]string, rewriteAppProbes bool) []byte {
+	t.Helper()
+
+	var probes *probeRewrite
+	if rewriteAppProbes {
+		probes = rewriteProbes(pod)
+	}
+	operations, err := injectionPatch(pod, sidecarConfig, annotations, probes)
+	require.NoError(t, err)
+	patch, err := json.Marshal(operations)
+	require.NoError(t, err)
+	return patch
+}
+
+func containerNames(containers []corev1.Container) []string {
+	names := make([]string, 0, len(containers))
+	for _, container := range containers {
+		names = append(names, container.Name)
+	}
+	return names
+}
+
+func TestInjectionPatch(t *testing.T) {
+	sidecarConfig, err := config.DefaultSidecarTemplate().Render(&corev1.Pod{}, "proxy-config-test", nil)
+	require.NoError(t, err)
+	injected := map[string]string{annotation.SidecarStatus: "injected"}
+
+	tests := []struct {
+		name                   string
+		pod                    *corev1.Pod
+		sidecarConfig          *config.SidecarConfig
+		expectedInitContainers []string
+		expectedContainers     []string
+		expectedVolumes        []string
+		expectedAnnotations    map[string]string
+	}{
+		{
+			name: "pod without init containers",
+			pod: &corev1.Pod{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app"}},
+				},
+			},
+			sidecarConfig:          sidecarConfig,
+			expectedInitContainers: []string{"proxy"},
+			expectedContainers:     []string{"app"},
+			expectedVolumes:        []string{"envoy-config", "spiffe-workload-api"},
+			expectedAnnotations:    injected,
+		},
+		{
+			name: "pod with init containers and volumes",
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{"team": "platform"},
+				},
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "migrate"}, {Name: "seed"}},
+					Containers:     []corev1.Container{{Name: "app"}},
+					Volumes:        []corev1.Volume{{Name: "data"}},
+				},
+			},
+			sidecarConfig:          sidecarConfig,
+			expectedInitContainers: []string{"proxy", "migrate", "seed"},
+			expectedContainers:     []string{"app"},
+			expectedVolumes:        []string{"data", "envoy-config", "spiffe-workload-api"},
+			expectedAnnotations: map[string]string{
+				"team":                   "platform",
+				annotation.SidecarStatus: "injected",
+			},
+		},
+		{
+			name: "existing status annotation is replaced",
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{annotation.SidecarStatus: "pending"},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app"}},
+				},
+			},
+			sidecarConfig:          sidecarConfig,
+			expectedInitContainers: []string{"proxy"},
+			expectedContainers:     []string{"app"},
+			expectedVolumes:        []string{"envoy-config", "spiffe-workload-api"},
+			expectedAnnotations:    injected,
+		},
+		{
+			name: "regular container without native sidecars",
+			pod: &corev1.Pod{
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "migrate"}},
+					Containers:     []corev1.Container{{Name: "app"}, {Name: "worker"}},
+				},
+			},
+			sidecarConfig:          sidecarConfig.WithoutNativeSidecars(),
+			expectedInitContainers: []string{"migrate"},
+			expectedContainers:     []string{"proxy", "app", "worker"},
+			expectedVolumes:        []string{"envoy-config", "spiffe-workload-api"},
+			expectedAnnotations:    injected,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := applyPatch(t, tt.pod, marshalledInjectionPatch(t, tt.pod, tt.sidecarConfig, injected, true))
+
+			assert.Equal(t, tt.expectedInitContainers, containerNames(pod.Spec.InitContainers))
+			assert.Equal(t, tt.expectedContainers, containerNames(pod.Spec.Containers))
+			assert.Equal(t, tt.expectedAnnotations, pod.Annotations)
+
+			volumes := make([]string, 0, len(pod.Spec.Volumes))
+			for _, volume := range pod.Spec.Volumes {
+				volumes = append(volumes, volume.Name)
+			}
+			assert.Equal(t, tt.expectedVolumes, volumes)
+
+			for _, container := range pod.Spec.InitContainers {
+				if container.Name == "proxy" {
+					require.NotNil(t, container.RestartPolicy)
+					assert.Equal(t, corev1.ContainerRestartPolicyAlways, *container.RestartPolicy)
+				}
+			}
+			for _, container := range pod.Spec.Containers {
+				assert.Nil(t, container.RestartPolicy)
+			}
+		})
+	}
+}
+
+func TestInjectionPatch_RewriteProbes(t *testing.T) {
+	sidecarConfig, err := config.DefaultSidecarTemplate().Render(&corev1.Pod{}, "proxy-config-test", nil)
+	require.NoError(t, err)
+
+	liveness := &corev1.HTTPGetAction{
+		Path:        "/healthz",
+		Port:        intstr.FromString("http"),
+		HTTPHeaders: []corev1.HTTPHeader{{Name: "x-probe", Value: "liveness"}},
+	}
+	readiness := &corev1.HTTPGetAction{
+		Path:   "/ready",
+		Port:   intstr.FromInt32(8443),
+		Scheme: corev1.URISchemeHTTPS,
+	}
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:           "app",
+					Ports:          []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+					LivenessProbe:  &corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: liveness}},
+					ReadinessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: readiness}},
+				},
+			},
+		},
+	}
+
+	patched := applyPatch(t, pod, marshalledInjectionPatch(t, pod, sidecarConfig.WithoutNativeSidecars(), map[string]string{annotation.SidecarStatus: "injected"}, true))
+	require.Equal(t, []string{"proxy", "app"}, containerNames(patched.Spec.Containers))
+	app := patched.Spec.Containers[1]
+
+	assert.Equal(t, &corev1.HTTPGetAction{
+		Path:        "/maestro/probes/app/livenessProbe",
+		Port:        intstr.FromInt32(constants.ProxyProbePort),
+		Scheme:      corev1.URISchemeHTTP,
+		HTTPHeaders: []corev1.HTTPHeader{{Name: "x-probe", Value: "liveness"}},
+	}, app.LivenessProbe.HTTPGet)
+	// HTTPS probes are not rewritten
+	assert.Equal(t, readiness, app.ReadinessProbe.HTTPGet)
+
+	originals := config.OriginalProbes{}
+	require.NoError(t, json.Unmarshal([]byte(patched.Annotations[annotation.SidecarOriginalProbes]), &originals))
+	assert.Equal(t, config.OriginalProbes{"app": {"livenessProbe": liveness}}, originals)
+
+	patched = applyPatch(t, pod, marshalledInjectionPatch(t, pod, sidecarConfig, map[string]string{annotation.SidecarStatus: "injected"}, false))
+	assert.Equal(t, liveness, patched.Spec.Containers[0].LivenessProbe.HTTPGet)
+	assert.NotContains(t, patched.Annotations, annotation.SidecarOriginalProbes)
+}
+
+func TestMutationRequired(t *testing.T) {
+	kubeClient := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "enabled", Labels: map[string]string{label.Injection: label.InjectionEnabled}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "disabled"}},
+	)
+	logger := ktesting.NewLogger(t, ktesting.NewConfig())
+	templates := injection.NewTemplateWatcher(logger, kubeClient, "", "")
+	handler, err := NewAdmissionMutationHandler(logger, kubeClient, nil, nil, "proxy-config-", templates, injection.DefaultPolicy())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		namespace   string
+		annotations map[string]string
+		expected    bool
+		expectedErr bool
+	}{
+		{
+			name:      "enabled namespace",
+			namespace: "enabled",
+			expected:  true,
+		},
+		{
+			name:      "namespace not enabled",
+			namespace: "disabled",
+		},
+		{
+			name:        "disabled by annotation",
+			namespace:   "enabled",
+			annotations: map[string]string{annotation.SidecarInject: "false"},
+		},
+		{
+			name:        "unknown namespace",
+			namespace:   "unknown",
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: tt.namespace, Annotations: tt.annotations}}
+
+			required, err := handler.mutationRequired(pod)
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, required)
+		})
+	}
+}
+
+func TestMutationRequired_NamespaceLister(t *testing.T) {
+	kubeClient := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "created", Labels: map[string]string{label.Injection: label.InjectionEnabled}}},
+	)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	require.NoError(t, indexer.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "enabled", Labels: map[string]string{label.Injection: label.InjectionEnabled}}}))
+	logger := ktesting.NewLogger(t, ktesting.NewConfig())
+	templates := injection.NewTemplateWatcher(logger, kubeClient, "", "")
+	handler, err := NewAdmissionMutationHandler(logger, kubeClient, corelisters.NewNamespaceLister(indexer), nil, "proxy-config-", templates, injection.DefaultPolicy())
+	require.NoError(t, err)
+
+	required, err := handler.mutationRequired(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "enabled"}})
+	require.NoError(t, err)
+	assert.True(t, required)
+	// cached namespaces are not read from the API server
+	for _, action := range kubeClient.Actions() {
+		assert.NotEqual(t, "namespaces", action.GetResource().Resource)
+	}
+
+	// a namespace not cached yet is read from the API server
+	required, err = handler.mutationRequired(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "created"}})
+	require.NoError(t, err)
+	assert.True(t, required)
+}
+
+func TestMutate_Drift(t *testing.T) {
+	kubeClient := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "enabled", Labels: map[string]string{label.Injection: label.InjectionEnabled}}},
+	)
+	kubeClient.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.31.0"}
+	logger := ktesting.NewLogger(t, ktesting.NewConfig())
+	templates := injection.NewTemplateWatcher(logger, kubeClient, "", "")
+	policy := injection.DefaultPolicy()
+	policy.RewriteProbes = true
+	handler, err := NewAdmissionMutationHandler(logger, kubeClient, nil, nil, "proxy-config-", templates, policy)
+	require.NoError(t, err)
+
+	mutate := func(t *testing.T, pod *corev1.Pod) (*corev1.Pod, *admissionv1.AdmissionResponse) {
+		t.Helper()
+		response := &admissionv1.AdmissionReview{Response: &admissionv1.AdmissionResponse{}}
+		require.NoError(t, handler.mutate(*pod, false, response))
+		if response.Response.Patch == nil {
+			return pod, response.Response
+		}
+		return applyPatch(t, pod, response.Response.Patch), response.Response
+	}
+
+	original := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "enabled", Annotations: map[string]string{"app": "annotation"}},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:           "app",
+				ReadinessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/ready", Port: intstr.FromInt32(8080)}}},
+			}},
+			Volumes: []corev1.Volume{{Name: "data"}},
+		},
+	}
+
+	injected, response := mutate(t, original)
+	require.True(t, response.Allowed)
+	status, err := config.ParseSidecarStatus(injected.Annotations[annotation.SidecarStatus])
+	require.NoError(t, err)
+	require.NotNil(t, status)
+	assert.Equal(t, containerNames(injected.Spec.InitContainers), status.InitContainers)
+	assert.Equal(t, "/maestro/probes/app/readinessProbe", injected.Spec.Containers[0].ReadinessProbe.HTTPGet.Path)
+	proxyArgs := injected.Spec.InitContainers[0].Args
+	require.Equal(t, "--config-yaml", proxyArgs[len(proxyArgs)-2])
+	assert.Contains(t, proxyArgs[len(proxyArgs)-1], "path: /maestro/probes/app/readinessProbe")
+
+	t.Run("up to date", func(t *testing.T) {
+		_, response := mutate(t, injected)
+		assert.True(t, response.Allowed)
+		assert.Nil(t, response.Patch)
+	})
+
+	stale := injected.DeepCopy()
+	stale.Annotations[annotation.SidecarStatus] = (&config.SidecarStatus{
+		InitContainers: status.InitContainers,
+		Volumes:        status.Volumes,
+		TemplateHash:   "0000000000000000",
+	}).String()
+	stale.Spec.InitContainers[0].Image = "envoyproxy/envoy:v1.0.0"
+
+	t.Run("reconcile", func(t *testing.T) {
+		reconciled, response := mutate(t, stale)
+		assert.True(t, response.Allowed)
+		assert.Equal(t, injected.Spec, reconciled.Spec)
+		assert.Equal(t, injected.Annotations, reconciled.Annotations)
+	})
+
+	t.Run("uninject", func(t *testing.T) {
+		disabled := injected.DeepCopy()
+		disabled.Annotations[annotation.SidecarInject] = "false"
+
+		uninjected, response := mutate(t, disabled)
+		assert.True(t, response.Allowed)
+		assert.Equal(t, original.Spec, uninjected.Spec)
+		assert.Equal(t, map[string]string{"app": "annotation", annotation.SidecarInject: "false"}, uninjected.Annotations)
+	})
+
+	t.Run("refuse", func(t *testing.T) {
+		policy.Drift = injection.DriftPolicyRefuse
+		defer func() { policy.Drift = injection.DriftPolicyReconcile }()
+
+		_, response := mutate(t, stale)
+		assert.False(t, response.Allowed)
+		assert.Nil(t, response.Patch)
+		require.NotNil(t, response.Result)
+
+		disabled := stale.DeepCopy()
+		disabled.Annotations[annotation.SidecarInject] = "false"
+
+		uninjected, response := mutate(t, disabled)
+		assert.True(t, response.Allowed)
+		assert.Equal(t, original.Spec, uninjected.Spec)
+	})
+}
+
+func TestMutate_ProxyConfigMapPending(t *testing.T) {
+	kubeClient := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "enabled", Labels: map[string]string{label.Injection: label.InjectionEnabled}}},
+	)
+	kubeClient.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.31.0"}
+	scheme := runtime.NewScheme()
+	require.NoError(t, configv1.AddToScheme(scheme))
+	proxyConfigs := crfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&configv1.ProxyConfig{ObjectMeta: metav1.ObjectMeta{Name: "payments", Namespace: "enabled"}},
+	).Build()
+	logger := ktesting.NewLogger(t, ktesting.NewConfig())
+	templates := injection.NewTemplateWatcher(logger, kubeClient, "", "")
+	handler, err := NewAdmissionMutationHandler(logger, kubeClient, nil, proxyConfigs, "proxy-config-", templates, injection.DefaultPolicy())
+	require.NoError(t, err)
+
+	pod := func(serviceAccountName string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "enabled"},
+			Spec:       corev1.PodSpec{ServiceAccountName: serviceAccountName, Containers: []corev1.Container{{Name: "app"}}},
+		}
+	}
+
+	t.Run("refused until generated", func(t *testing.T) {
+		response := &admissionv1.AdmissionReview{Response: &admissionv1.AdmissionResponse{}}
+		require.NoError(t, handler.mutate(*pod("payments"), false, response))
+		assert.False(t, response.Response.Allowed)
+		assert.Nil(t, response.Response.Patch)
+		require.NotNil(t, response.Response.Result)
+		assert.Equal(t, metav1.StatusReasonServiceUnavailable, response.Response.Result.Reason)
+	})
+
+	t.Run("template injected", func(t *testing.T) {
+		response := &admissionv1.AdmissionReview{Response: &admissionv1.AdmissionResponse{}}
+		require.NoError(t, handler.mutate(*pod("payments"), true, response))
+		assert.True(t, response.Response.Allowed)
+		assert.NotNil(t, response.Response.Patch)
+	})
+
+	t.Run("without ProxyConfig", func(t *testing.T) {
+		response := &admissionv1.AdmissionReview{Response: &admissionv1.AdmissionResponse{}}
+		require.NoError(t, handler.mutate(*pod("orders"), false, response))
+		assert.True(t, response.Response.Allowed)
+		injected := applyPatch(t, pod("orders"), response.Response.Patch)
+		assert.NotContains(t, injected.Annotations, annotation.ConfigHash)
+	})
+
+	t.Run("generated", func(t *testing.T) {
+		_, err := kubeClient.CoreV1().ConfigMaps("enabled").Create(t.Context(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "proxy-config-payments", Namespace: "enabled"},
+			Data: map[string]string{
+				constants.ProxyBootstrapKey:   "bootstrap",
+				constants.ProxyAuthzPolicyKey: "payments-policy",
+			},
+		}, metav1.CreateOptions{})
+		require.NoError(t, err)
+
+		response := &admissionv1.AdmissionReview{Response: &admissionv1.AdmissionResponse{}}
+		require.NoError(t, handler.mutate(*pod("payments"), false, response))
+		require.True(t, response.Response.Allowed)
+		injected := applyPatch(t, pod("payments"), response.Response.Patch)
+		assert.Contains(t, containerNames(injected.Spec.InitContainers), "opa")
+		assert.Contains(t, injected.Annotations, annotation.ConfigHash)
+	})
+}
+
+// staticTemplates provides a fixed sidecar template.
+type staticTemplates struct {
+	template *config.SidecarTemplate
+}
+
+func (s staticTemplates) Template() *config.SidecarTemplate {
+	return s.template
+}
+
+func TestMutate_InterceptTraffic(t *testing.T) {
+	kubeClient := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "enabled", Labels: map[string]string{label.Injection: label.InjectionEnabled}}},
+	)
+	kubeClient.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.31.0"}
+	template, err := config.ParseSidecarTemplate(map[string]string{config.SidecarValuesKey: "initImage: example.com/maestro-init:v1"})
+	require.NoError(t, err)
+	logger := ktesting.NewLogger(t, ktesting.NewConfig())
+	handler, err := NewAdmissionMutationHandler(logger, kubeClient, nil, nil, "proxy-config-", staticTemplates{template}, injection.DefaultPolicy())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name             string
+		annotations      map[string]string
+		expected         string
+		expectedOutbound bool
+	}{
+		{
+			name:     "without interception",
+			expected: "/ready",
+		},
+		{
+			name:             "intercepted",
+			annotations:      map[string]string{annotation.SidecarInterceptTraffic: "true"},
+			expected:         "/maestro/probes/app/readinessProbe",
+			expectedOutbound: true,
+		},
+		{
+			name:             "intercepted with rewrite disabled",
+			annotations:      map[string]string{annotation.SidecarInterceptTraffic: "true", annotation.SidecarRewriteProbes: "false"},
+			expected:         "/maestro/probes/app/readinessProbe",
+			expectedOutbound: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "enabled", Annotations: tt.annotations},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{
+					Name:           "app",
+					ReadinessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/ready", Port: intstr.FromInt32(8080)}}},
+				}}},
+			}
+
+			response := &admissionv1.AdmissionReview{Response: &admissionv1.AdmissionResponse{}}
+			require.NoError(t, handler.mutate(*pod, false, response))
+			require.True(t, response.Response.Allowed)
+
+			injected := applyPatch(t, pod, response.Response.Patch)
+			assert.Equal(t, tt.expected, injected.Spec.Containers[0].ReadinessProbe.HTTPGet.Path)
+
+			// the outbound listener is only added to the proxies of intercepting pods
+			proxyArgs := strings.Join(injected.Spec.InitContainers[len(injected.Spec.InitContainers)-1].Args, " ")
+			assert.Equal(t, tt.expectedOutbound, strings.Contains(proxyArgs, "name: outbound"))
+		})
+	}
+
+	t.Run("outbound bootstrap of the ProxyConfig", func(t *testing.T) {
+		_, err := kubeClient.CoreV1().ConfigMaps("enabled").Create(t.Context(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "proxy-config-default", Namespace: "enabled"},
+			Data: map[string]string{
+				constants.ProxyBootstrapKey:         "bootstrap",
+				constants.ProxyOutboundBootstrapKey: "static_resources:\n  listeners:\n    - name: outbound_of_proxy_config\n",
+			},
+		}, metav1.CreateOptions{})
+		require.NoError(t, err)
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "enabled", Annotations: map[string]string{annotation.SidecarInterceptTraffic: "true"}},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+		}
+		response := &admissionv1.AdmissionReview{Response: &admissionv1.AdmissionResponse{}}
+		require.NoError(t, handler.mutate(*pod, false, response))
+		require.True(t, response.Response.Allowed)
+
+		injected := applyPatch(t, pod, response.Response.Patch)
+		proxyArgs := strings.Join(injected.Spec.InitContainers[len(injected.Spec.InitContainers)-1].Args, " ")
+		assert.Contains(t, proxyArgs, "name: outbound_of_proxy_config")
+	})
+}
+
+func TestInjectPod_Offline(t *testing.T) {
+	logger := ktesting.NewLogger(t, ktesting.NewConfig())
+	templates := injection.NewTemplateWatcher(logger, fake.NewClientset(), "", "")
+	policy := injection.DefaultPolicy()
+	policy.NamespaceSelector = nil
+	policy.Revision = "stable"
+	handler := NewOfflineMutationHandler(logger, "proxy-config-", templates, policy, false)
+
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}
+
+	injected, err := handler.InjectPod(pod)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"proxy", "app"}, containerNames(injected.Spec.Containers))
+	assert.Contains(t, injected.Annotations, annotation.SidecarStatus)
+	assert.Len(t, pod.Spec.Containers, 1)
+
+	reinjected, err := handler.InjectPod(injected)
+	require.NoError(t, err)
+	assert.Equal(t, injected, reinjected)
+
+	for name, meta := range map[string]metav1.ObjectMeta{
+		"disabled by annotation": {Annotations: map[string]string{annotation.SidecarInject: "false"}},
+		"disabled by label":      {Labels: map[string]string{label.Injection: label.InjectionDisabled}},
+		"other revision":         {Labels: map[string]string{label.Revision: "canary"}},
+		"control plane":          {Labels: map[string]string{"app.kubernetes.io/part-of": "maestro"}},
+		"ignored namespace":      {Namespace: metav1.NamespaceSystem},
+	} {
+		t.Run(name, func(t *testing.T) {
+			skipped := pod.DeepCopy()
+			skipped.ObjectMeta = meta
+			out, err := handler.InjectPod(skipped)
+			require.NoError(t, err)
+			assert.Equal(t, skipped, out)
+		})
+	}
+
+	revisioned := pod.DeepCopy()
+	revisioned.Labels = map[string]string{label.Revision: "stable"}
+	injected, err = handler.InjectPod(revisioned)
+	require.NoError(t, err)
+	assert.Contains(t, injected.Annotations, annotation.SidecarStatus)
+}
+
+func TestHandle_Pod(t *testing.T) {
+	kubeClient := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "enabled", Labels: map[string]string{label.Injection: label.InjectionEnabled}}},
+	)
+	kubeClient.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.31.0"}
+	logger := ktesting.NewLogger(t, ktesting.NewConfig())
+	templates := injection.NewTemplateWatcher(logger, kubeClient, "", "")
+	handler, err := NewAdmissionMutationHandler(logger, kubeClient, nil, nil, "proxy-config-", templates, injection.DefaultPolicy())
+	require.NoError(t, err)
+
+	pod := &corev1.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{Name: "app"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+	}
+	raw, err := json.Marshal(pod)
+	require.NoError(t, err)
+
+	// the API server sends pods in the core group, named ""
+	request := &admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{
+		Resource:  metav1.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"},
+		Namespace: "enabled",
+		Object:    runtime.RawExtension{Raw: raw},
+	}}
+
+	response := &admissionv1.AdmissionReview{Response: &admissionv1.AdmissionResponse{}}
+	require.NoError(t, handler.Handle(request, response))
+	require.True(t, response.Response.Allowed)
+
+	injected := applyPatch(t, pod, response.Response.Patch)
+	assert.Equal(t, []string{"proxy"}, containerNames(injected.Spec.InitContainers))
+	assert.Equal(t, []string{"app"}, containerNames(injected.Spec.Containers))
+	assert.Contains(t, injected.Annotations, annotation.SidecarStatus)
+}
+
+func TestHandle_Workload(t *testing.T) {
+	kubeClient := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "enabled", Labels: map[string]string{label.Injection: label.InjectionEnabled}}},
+	)
+	kubeClient.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.31.0"}
+	logger := ktesting.NewLogger(t, ktesting.NewConfig())
+	templates := injection.NewTemplateWatcher(logger, kubeClient, "", "")
+	policy := injection.DefaultPolicy()
+	handler, err := NewAdmissionMutationHandler(logger, kubeClient, nil, nil, "proxy-config-", templates, policy)
+	require.NoError(t, err)
+
+	deployment := &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "enabled"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+			},
+		},
+	}
+	raw, err := json.Marshal(deployment)
+	require.NoError(t, err)
+
+	request := &admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{
+		Resource:  metav1.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+		Namespace: "enabled",
+		Object:    runtime.RawExtension{Raw: raw},
+	}}
+
+	response := &admissionv1.AdmissionReview{Response: &admissionv1.AdmissionResponse{}}
+	assert.Error(t, handler.Handle(request, response), "workloads are not injected by default")
+
+	policy.InjectWorkloads = true
+	response = &admissionv1.AdmissionReview{Response: &admissionv1.AdmissionResponse{}}
+	require.NoError(t, handler.Handle(request, response))
+	require.True(t, response.Response.Allowed)
+
+	decoded, err := jsonpatch.DecodePatch(response.Response.Patch)
+	require.NoError(t, err)
+	patched, err := decoded.Apply(raw)
+	require.NoError(t, err)
+
+	injected := &appsv1.Deployment{}
+	require.NoError(t, json.Unmarshal(patched, injected))
+	assert.Equal(t, []string{"proxy"}, containerNames(injected.Spec.Template.Spec.InitContainers))
+	assert.Equal(t, []string{"app"}, containerNames(injected.Spec.Template.Spec.Containers))
+	assert.Contains(t, injected.Spec.Template.Annotations, annotation.SidecarStatus)
+	assert.Empty(t, injected.Annotations)
+}
+
+func TestSupportsNativeSidecars(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  string
+		expected bool
+	}{
+		{
+			name:     "supported version",
+			version:  "v1.29.0",
+			expected: true,
+		},
+		{
+			name:     "provider suffixed version",
+			version:  "v1.31.2-eks-7f9249a",
+			expected: true,
+		},
+		{
+			name:     "unsupported version",
+			version:  "v1.28.5",
+			expected: false,
+		},
+		{
+			name:     "invalid version",
+			version:  "unknown",
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discovery := fake.NewClientset().Discovery().(*fakediscovery.FakeDiscovery)
+			discovery.FakedServerVersion = &version.Info{GitVersion: tt.version}
+
+			assert.Equal(t, tt.expected, supportsNativeSidecars(discovery, ktesting.NewLogger(t, ktesting.NewConfig())))
+		})
+	}
+}
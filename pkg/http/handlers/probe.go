@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/bpalermo/maestro/internal/config"
+	"github.com/bpalermo/maestro/internal/config/constants"
+	"github.com/bpalermo/maestro/internal/proxy/envoy"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// probeRewrite is the rewrite of the HTTP probes of a pod to go through the probe listener of
+// the proxy, which kubelet reaches without mTLS.
+type probeRewrite struct {
+	patch     []patchOperation
+	originals config.OriginalProbes
+	// routes are the routes of the probe listener, only forwarding the rewritten probes
+	routes []envoy.ProbeRoute
+}
+
+// rewriteProbes rewrites the plain HTTP probes of the containers of a pod to a path of the probe
+// listener of the proxy, forwarded to the original path and port only. Probes targeting another
+// host or using HTTPS are left untouched. It returns nil when no probe is rewritten.
+func rewriteProbes(pod *corev1.Pod) *probeRewrite {
+	rewrite := &probeRewrite{originals: config.OriginalProbes{}}
+
+	for i := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[i]
+		for _, p := range []struct {
+			field string
+			probe *corev1.Probe
+		}{
+			{"livenessProbe", container.LivenessProbe},
+			{"readinessProbe", container.ReadinessProbe},
+			{"startupProbe", container.StartupProbe},
+		} {
+			field, probe := p.field, p.probe
+			if probe == nil || probe.HTTPGet == nil {
+				continue
+			}
+
+			route, rewritten, ok := rewriteHTTPGet(container, field, probe.HTTPGet)
+			if !ok {
+				continue
+			}
+			rewrite.routes = append(rewrite.routes, route)
+
+			rewrite.patch = append(rewrite.patch, patchOperation{
+				Op:    "replace",
+				Path:  fmt.Sprintf("/spec/containers/%d/%s/httpGet", i, field),
+				Value: rewritten,
+			})
+
+			if rewrite.originals[container.Name] == nil {
+				rewrite.originals[container.Name] = map[string]*corev1.HTTPGetAction{}
+			}
+			rewrite.originals[container.Name][field] = probe.HTTPGet
+		}
+	}
+
+	if len(rewrite.routes) == 0 {
+		return nil
+	}
+	return rewrite
+}
+
+func rewriteHTTPGet(container *corev1.Container, field string, action *corev1.HTTPGetAction) (envoy.ProbeRoute, *corev1.HTTPGetAction, bool) {
+	if action.Host != "" || (action.Scheme != "" && action.Scheme != corev1.URISchemeHTTP) {
+		return envoy.ProbeRoute{}, nil, false
+	}
+
+	port, ok := containerPort(container, action.Port)
+	if !ok {
+		return envoy.ProbeRoute{}, nil, false
+	}
+
+	route := envoy.ProbeRoute{
+		Path:         constants.ProbePathPrefix + container.Name + "/" + field,
+		OriginalPath: action.Path,
+		Port:         uint32(port),
+	}
+
+	return route, &corev1.HTTPGetAction{
+		Path:        route.Path,
+		Port:        intstr.FromInt32(constants.ProxyProbePort),
+		Scheme:      corev1.URISchemeHTTP,
+		HTTPHeaders: action.HTTPHeaders,
+	}, true
+}
+
+// containerPort resolves a probe port, which is either a number or the name of a container port.
+func containerPort(container *corev1.Container, port intstr.IntOrString) (int32, bool) {
+	if port.Type == intstr.Int {
+		return port.IntVal, port.IntVal > 0
+	}
+
+	for _, p := range container.Ports {
+		if p.Name == port.StrVal {
+			return p.ContainerPort, true
+		}
+	}
+	return 0, false
+}
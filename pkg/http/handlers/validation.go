@@ -1,25 +1,42 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 
 	"buf.build/go/protovalidate"
+	proxyconfigv1 "github.com/bpalermo/maestro/api/config/v1"
+	"github.com/bpalermo/maestro/internal/config/label"
+	"github.com/bpalermo/maestro/internal/proxy"
 	"github.com/bpalermo/maestro/pkg/apis/config"
 	configv1 "github.com/bpalermo/maestro/pkg/apis/config/v1"
 	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type AdmissionValidationHandler struct {
 	logger  klog.Logger
 	decoder runtime.Decoder
+	// kubeClient is used to look up the namespace and the upstream services of reviewed resources.
+	// The checks depending on it are skipped when nil.
+	kubeClient kubernetes.Interface
+	// proxyConfigs reads the ProxyConfig resources the reviewed resources must not collide with.
+	// The checks depending on it are skipped when nil.
+	proxyConfigs client.Reader
 }
 
-func NewAdmissionValidationHandler(logger klog.Logger) (*AdmissionValidationHandler, error) {
+func NewAdmissionValidationHandler(logger klog.Logger, kubeClient kubernetes.Interface, proxyConfigs client.Reader) (*AdmissionValidationHandler, error) {
 	runtimeScheme := runtime.NewScheme()
 	if err := admissionv1.AddToScheme(runtimeScheme); err != nil {
 		return nil, err
@@ -28,18 +45,18 @@ func NewAdmissionValidationHandler(logger klog.Logger) (*AdmissionValidationHand
 	return &AdmissionValidationHandler{
 		logger,
 		serializer.NewCodecFactory(runtimeScheme).UniversalDeserializer(),
+		kubeClient,
+		proxyConfigs,
 	}, nil
 }
 
-func (avh AdmissionValidationHandler) Handle(request *admissionv1.AdmissionReview, response *admissionv1.AdmissionReview) (err error) {
+func (avh AdmissionValidationHandler) Handle(request *admissionv1.AdmissionReview, response *admissionv1.AdmissionReview) error {
 	switch request.Request.Resource {
 	case configv1.ProxyConfigMetaGVR:
-		err = avh.handleProxyConfigReviewRequest(request.Request, response)
+		return avh.handleProxyConfigReviewRequest(request.Request, response)
 	default:
 		return fmt.Errorf("expected config.maestro.io/v1/proxyconfig resource but got %+v", request)
 	}
-
-	return nil
 }
 
 func (avh AdmissionValidationHandler) handleProxyConfigReviewRequest(request *admissionv1.AdmissionRequest, response *admissionv1.AdmissionReview) error {
@@ -52,15 +69,28 @@ func (avh AdmissionValidationHandler) handleProxyConfigReviewRequest(request *ad
 	if _, err := decodeRequest(avh.decoder, request.Object.Raw, expectedProxyConfigGVK, proxyConfigRequest); err != nil {
 		return err
 	}
+	proxyConfigRequest.Namespace = request.Namespace
+
+	var oldProxyConfig *configv1.ProxyConfig
+	if request.Operation == admissionv1.Update {
+		oldProxyConfig = new(configv1.ProxyConfig)
+		if _, err := decodeRequest(avh.decoder, request.OldObject.Raw, expectedProxyConfigGVK, oldProxyConfig); err != nil {
+			return err
+		}
+	}
 
-	err := protovalidate.Validate(proxyConfigRequest.Spec)
+	ctx := context.TODO()
+	errs := avh.validateProxyConfig(ctx, proxyConfigRequest, oldProxyConfig)
 
 	response.SetGroupVersionKind(expectedProxyConfigGVK)
-	if err != nil {
+	response.Response.Warnings = avh.proxyConfigWarnings(ctx, proxyConfigRequest, oldProxyConfig)
+	if len(errs) > 0 {
 		response.Response.Allowed = false
 		response.Response.Result = &metav1.Status{
-			Status:  "Failure",
-			Message: err.Error(),
+			Status:  metav1.StatusFailure,
+			Message: errs.ToAggregate().Error(),
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
 		}
 	} else {
 		response.Response.Allowed = true
@@ -68,3 +98,148 @@ func (avh AdmissionValidationHandler) handleProxyConfigReviewRequest(request *ad
 
 	return nil
 }
+
+// validateProxyConfig returns the violations of a ProxyConfig: those of its protovalidate rules,
+// and of the rules depending on the other resources of the cluster or on its previous version.
+func (avh AdmissionValidationHandler) validateProxyConfig(ctx context.Context, proxyConfig *configv1.ProxyConfig, oldProxyConfig *configv1.ProxyConfig) field.ErrorList {
+	specPath := field.NewPath("spec")
+	servicePath := specPath.Child("service")
+	svc := proxyConfig.Spec.GetService()
+
+	errs := validateSpec(specPath, proxyConfig.Spec)
+	errs = append(errs, validateServicePorts(servicePath.Child("service_ports"), svc.GetServicePorts())...)
+	errs = append(errs, avh.validateServiceName(ctx, servicePath.Child("name"), proxyConfig)...)
+	if oldProxyConfig != nil {
+		errs = append(errs, validateImmutableFields(specPath, proxyConfig.Spec, oldProxyConfig.Spec)...)
+	}
+	if err := avh.validateFaultPolicy(ctx, proxyConfig.Namespace, svc); err != nil {
+		errs = append(errs, field.Forbidden(servicePath, err.Error()))
+	}
+	return errs
+}
+
+// proxyConfigWarnings returns the problems of a ProxyConfig that do not prevent its bootstrap
+// from being generated. Only the upstream services added since its previous version are looked
+// up, so that updates do not query every upstream again.
+func (avh AdmissionValidationHandler) proxyConfigWarnings(ctx context.Context, proxyConfig *configv1.ProxyConfig, oldProxyConfig *configv1.ProxyConfig) []string {
+	if avh.kubeClient == nil {
+		return nil
+	}
+
+	checked := map[types.NamespacedName]bool{}
+	if oldProxyConfig != nil {
+		for _, upstream := range oldProxyConfig.Spec.GetUpstreams().GetUpstreamServices() {
+			checked[upstreamServiceName(proxyConfig.Namespace, upstream)] = true
+		}
+	}
+
+	var warnings []string
+	upstreamsPath := field.NewPath("spec", "upstreams", "upstream_services")
+	for i, upstream := range proxyConfig.Spec.GetUpstreams().GetUpstreamServices() {
+		name := upstreamServiceName(proxyConfig.Namespace, upstream)
+		if name.Name == "" || checked[name] {
+			continue
+		}
+		checked[name] = true
+
+		_, err := avh.kubeClient.CoreV1().Services(name.Namespace).Get(ctx, name.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			warnings = append(warnings, fmt.Sprintf("%s: service %s does not exist", upstreamsPath.Index(i).Child("name"), klog.KRef(name.Namespace, name.Name)))
+		} else if err != nil {
+			avh.logger.Error(err, "Unable to verify the upstream service", "service", klog.KRef(name.Namespace, name.Name))
+		}
+	}
+	return warnings
+}
+
+// upstreamServiceName returns the name of the Service of an upstream of a ProxyConfig of the given namespace.
+func upstreamServiceName(namespace string, upstream *proxyconfigv1.Upstreams_UpstreamService) types.NamespacedName {
+	if upstream.GetNamespace() != "" {
+		namespace = upstream.GetNamespace()
+	}
+	return types.NamespacedName{Namespace: namespace, Name: upstream.GetName()}
+}
+
+// validateSpec returns the violations of the protovalidate rules of a ProxyConfig spec.
+func validateSpec(path *field.Path, spec *proxyconfigv1.ProxyConfigSpec) field.ErrorList {
+	err := protovalidate.Validate(spec)
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *protovalidate.ValidationError
+	if !errors.As(err, &validationErr) {
+		return field.ErrorList{field.InternalError(path, err)}
+	}
+
+	var errs field.ErrorList
+	for _, violation := range validationErr.Violations {
+		fieldPath := path
+		if name := protovalidate.FieldPathString(violation.Proto.GetField()); name != "" {
+			fieldPath = path.Child(name)
+		}
+		errs = append(errs, field.Invalid(fieldPath, field.OmitValueType{}, violation.Proto.GetMessage()))
+	}
+	return errs
+}
+
+// validateServicePorts rejects service ports declared more than once.
+func validateServicePorts(path *field.Path, servicePorts []*proxyconfigv1.Service_ServicePort) field.ErrorList {
+	var errs field.ErrorList
+	seen := map[uint32]bool{}
+	for i, servicePort := range servicePorts {
+		if seen[servicePort.GetPort()] {
+			errs = append(errs, field.Duplicate(path.Index(i).Child("port"), servicePort.GetPort()))
+		}
+		seen[servicePort.GetPort()] = true
+	}
+	return errs
+}
+
+// validateServiceName rejects a service name used by another ProxyConfig of the namespace.
+func (avh AdmissionValidationHandler) validateServiceName(ctx context.Context, path *field.Path, proxyConfig *configv1.ProxyConfig) field.ErrorList {
+	name := proxyConfig.Spec.GetService().GetName()
+	if name == "" || avh.proxyConfigs == nil {
+		return nil
+	}
+
+	proxyConfigs := &configv1.ProxyConfigList{}
+	if err := avh.proxyConfigs.List(ctx, proxyConfigs, client.InNamespace(proxyConfig.Namespace)); err != nil {
+		return field.ErrorList{field.InternalError(path, fmt.Errorf("unable to list the ProxyConfigs of namespace %s: %w", proxyConfig.Namespace, err))}
+	}
+
+	for _, other := range proxyConfigs.Items {
+		if other.Name != proxyConfig.Name && other.Spec.GetService().GetName() == name {
+			return field.ErrorList{field.Duplicate(path, fmt.Sprintf("%s, used by ProxyConfig %s", name, other.Name))}
+		}
+	}
+	return nil
+}
+
+// validateImmutableFields rejects changes of the fields identifying the proxies of a ProxyConfig.
+func validateImmutableFields(path *field.Path, spec *proxyconfigv1.ProxyConfigSpec, oldSpec *proxyconfigv1.ProxyConfigSpec) field.ErrorList {
+	name, oldName := spec.GetService().GetName(), oldSpec.GetService().GetName()
+	if oldName != "" && name != oldName {
+		return field.ErrorList{field.Invalid(path.Child("service", "name"), name, "field is immutable")}
+	}
+	return nil
+}
+
+// validateFaultPolicy rejects faults in namespaces labelled as production, unless
+// the namespace explicitly allows fault injection.
+func (avh AdmissionValidationHandler) validateFaultPolicy(ctx context.Context, namespace string, svc *proxyconfigv1.Service) error {
+	if !proxy.FaultEnabled(svc) || avh.kubeClient == nil {
+		return nil
+	}
+
+	ns, err := avh.kubeClient.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to verify the fault injection policy of namespace %s: %w", namespace, err)
+	}
+
+	if ns.Labels[label.Environment] == label.EnvironmentProduction && ns.Labels[label.AllowFaultInjection] != "true" {
+		return fmt.Errorf("fault injection is not allowed in production namespace %s, label it with %s=true to allow it", namespace, label.AllowFaultInjection)
+	}
+
+	return nil
+}
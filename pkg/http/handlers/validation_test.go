@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	proxyconfigv1 "github.com/bpalermo/maestro/api/config/v1"
+	"github.com/bpalermo/maestro/internal/config/label"
+	configv1 "github.com/bpalermo/maestro/pkg/apis/config/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/klog/v2/ktesting"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAdmissionValidationHandler_Handle(t *testing.T) {
+	servicePort := func(port uint32) *proxyconfigv1.Service_ServicePort {
+		return &proxyconfigv1.Service_ServicePort{
+			Port: port,
+			HealthCheckSpecifier: &proxyconfigv1.Service_ServicePort_HttpHealthCheck_{
+				HttpHealthCheck: &proxyconfigv1.Service_ServicePort_HttpHealthCheck{Path: "/"},
+			},
+		}
+	}
+	proxyConfig := func(name string, serviceName string, ports ...uint32) *configv1.ProxyConfig {
+		svc := &proxyconfigv1.Service{Name: serviceName}
+		for _, port := range ports {
+			svc.ServicePorts = append(svc.ServicePorts, servicePort(port))
+		}
+		return &configv1.ProxyConfig{
+			TypeMeta:   metav1.TypeMeta{APIVersion: configv1.SchemeGroupVersion.String(), Kind: "ProxyConfig"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test"},
+			Spec:       &proxyconfigv1.ProxyConfigSpec{Service: svc},
+		}
+	}
+	withUpstream := func(p *configv1.ProxyConfig, name string) *configv1.ProxyConfig {
+		if p.Spec.Upstreams == nil {
+			p.Spec.Upstreams = &proxyconfigv1.Upstreams{}
+		}
+		p.Spec.Upstreams.UpstreamServices = append(p.Spec.Upstreams.UpstreamServices, &proxyconfigv1.Upstreams_UpstreamService{Name: name})
+		return p
+	}
+
+	withAuthz := func(p *configv1.ProxyConfig, authz *proxyconfigv1.AuthZ) *configv1.ProxyConfig {
+		p.Spec.Service.Authz = authz
+		return p
+	}
+
+	withCatchAll := func(p *configv1.ProxyConfig, catchAll *proxyconfigv1.CatchAll) *configv1.ProxyConfig {
+		p.Spec.Service.CatchAll = catchAll
+		return p
+	}
+
+	tests := []struct {
+		name             string
+		proxyConfig      *configv1.ProxyConfig
+		oldProxyConfig   *configv1.ProxyConfig
+		expectedAllowed  bool
+		expectedMessage  []string
+		expectedWarnings []string
+	}{
+		{
+			name:            "valid",
+			proxyConfig:     proxyConfig("orders", "orders", 8080),
+			expectedAllowed: true,
+		},
+		{
+			name:            "protovalidate violation",
+			proxyConfig:     proxyConfig("orders", "orders", 80),
+			expectedMessage: []string{"spec.service.service_ports[0].port: Invalid value"},
+		},
+		{
+			name:            "catch all forward without port",
+			proxyConfig:     withCatchAll(proxyConfig("orders", "orders", 8080), &proxyconfigv1.CatchAll{Action: proxyconfigv1.CatchAll_ACTION_FORWARD}),
+			expectedMessage: []string{"forward_port is required when forwarding"},
+		},
+		{
+			name:            "catch all forward",
+			proxyConfig:     withCatchAll(proxyConfig("orders", "orders", 8080), &proxyconfigv1.CatchAll{Action: proxyconfigv1.CatchAll_ACTION_FORWARD, ForwardPort: 8080}),
+			expectedAllowed: true,
+		},
+		{
+			name:            "catch all reply without port",
+			proxyConfig:     withCatchAll(proxyConfig("orders", "orders", 8080), &proxyconfigv1.CatchAll{Action: proxyconfigv1.CatchAll_ACTION_MISDIRECTED_REQUEST}),
+			expectedAllowed: true,
+		},
+		{
+			name:            "authz without policy",
+			proxyConfig:     withAuthz(proxyConfig("orders", "orders", 8080), &proxyconfigv1.AuthZ{}),
+			expectedMessage: []string{"spec.service.authz.policy_config_map: Invalid value"},
+		},
+		{
+			name:            "authz",
+			proxyConfig:     withAuthz(proxyConfig("orders", "orders", 8080), &proxyconfigv1.AuthZ{PolicyConfigMap: "orders-policy"}),
+			expectedAllowed: true,
+		},
+		{
+			name:            "duplicate ports",
+			proxyConfig:     proxyConfig("orders", "orders", 8080, 9090, 8080),
+			expectedMessage: []string{"spec.service.service_ports[2].port: Duplicate value: 8080"},
+		},
+		{
+			name:            "service name collision",
+			proxyConfig:     proxyConfig("orders-v2", "payments", 8080),
+			expectedMessage: []string{"spec.service.name: Duplicate value: \"payments, used by ProxyConfig payments\""},
+		},
+		{
+			name:            "aggregated violations",
+			proxyConfig:     proxyConfig("orders-v2", "payments", 8080, 8080),
+			expectedMessage: []string{"spec.service.service_ports[1].port", "spec.service.name"},
+		},
+		{
+			name:            "immutable service name",
+			proxyConfig:     proxyConfig("orders", "orders-v2", 8080),
+			oldProxyConfig:  proxyConfig("orders", "orders", 8080),
+			expectedMessage: []string{"spec.service.name: Invalid value: \"orders-v2\": field is immutable"},
+		},
+		{
+			name:             "missing upstream service",
+			proxyConfig:      withUpstream(proxyConfig("orders", "orders", 8080), "inventory"),
+			expectedAllowed:  true,
+			expectedWarnings: []string{"spec.upstreams.upstream_services[0].name: service test/inventory does not exist"},
+		},
+		{
+			name:             "duplicate missing upstream service",
+			proxyConfig:      withUpstream(withUpstream(proxyConfig("orders", "orders", 8080), "inventory"), "inventory"),
+			expectedAllowed:  true,
+			expectedWarnings: []string{"spec.upstreams.upstream_services[0].name: service test/inventory does not exist"},
+		},
+		{
+			name:            "unchanged missing upstream service",
+			proxyConfig:     withUpstream(proxyConfig("orders", "orders", 8080), "inventory"),
+			oldProxyConfig:  withUpstream(proxyConfig("orders", "orders", 8080), "inventory"),
+			expectedAllowed: true,
+		},
+		{
+			name:            "existing upstream service",
+			proxyConfig:     withUpstream(proxyConfig("orders", "orders", 8080), "payments"),
+			expectedAllowed: true,
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, configv1.AddToScheme(scheme))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeClient := fake.NewClientset(
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+				&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "payments", Namespace: "test"}},
+			)
+			proxyConfigs := crfake.NewClientBuilder().WithScheme(scheme).WithObjects(proxyConfig("payments", "payments", 8080)).Build()
+			handler, err := NewAdmissionValidationHandler(ktesting.NewLogger(t, ktesting.NewConfig()), kubeClient, proxyConfigs)
+			require.NoError(t, err)
+
+			request := &admissionv1.AdmissionRequest{
+				Resource:  configv1.ProxyConfigMetaGVR,
+				Namespace: "test",
+				Operation: admissionv1.Create,
+			}
+			request.Object.Raw, err = json.Marshal(tt.proxyConfig)
+			require.NoError(t, err)
+			if tt.oldProxyConfig != nil {
+				request.Operation = admissionv1.Update
+				request.OldObject.Raw, err = json.Marshal(tt.oldProxyConfig)
+				require.NoError(t, err)
+			}
+
+			response := &admissionv1.AdmissionReview{Response: &admissionv1.AdmissionResponse{}}
+			require.NoError(t, handler.Handle(&admissionv1.AdmissionReview{Request: request}, response))
+
+			assert.Equal(t, tt.expectedAllowed, response.Response.Allowed)
+			assert.Equal(t, tt.expectedWarnings, response.Response.Warnings)
+			for _, message := range tt.expectedMessage {
+				require.NotNil(t, response.Response.Result)
+				assert.Contains(t, response.Response.Result.Message, message)
+			}
+		})
+	}
+}
+
+func TestAdmissionValidationHandler_withoutClients(t *testing.T) {
+	handler, err := NewAdmissionValidationHandler(ktesting.NewLogger(t, ktesting.NewConfig()), nil, nil)
+	require.NoError(t, err)
+
+	proxyConfig := &configv1.ProxyConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders", Namespace: "test"},
+		Spec: &proxyconfigv1.ProxyConfigSpec{
+			Service: &proxyconfigv1.Service{
+				Name: "orders",
+				ServicePorts: []*proxyconfigv1.Service_ServicePort{{
+					Port: 8080,
+					HealthCheckSpecifier: &proxyconfigv1.Service_ServicePort_HttpHealthCheck_{
+						HttpHealthCheck: &proxyconfigv1.Service_ServicePort_HttpHealthCheck{Path: "/"},
+					},
+				}},
+				Fault: &proxyconfigv1.Fault{Abort: &proxyconfigv1.Fault_Abort{Status: &proxyconfigv1.Fault_Abort_HttpStatus{HttpStatus: 503}}},
+			},
+			Upstreams: &proxyconfigv1.Upstreams{UpstreamServices: []*proxyconfigv1.Upstreams_UpstreamService{{Name: "inventory"}}},
+		},
+	}
+
+	assert.Empty(t, handler.validateProxyConfig(context.Background(), proxyConfig, nil))
+	assert.Empty(t, handler.proxyConfigWarnings(context.Background(), proxyConfig, nil))
+}
+
+func TestAdmissionValidationHandler_validateFaultPolicy(t *testing.T) {
+	faulted := &proxyconfigv1.Service{
+		Fault: &proxyconfigv1.Fault{
+			Abort: &proxyconfigv1.Fault_Abort{
+				Status: &proxyconfigv1.Fault_Abort_HttpStatus{HttpStatus: 503},
+			},
+		},
+	}
+	portFaulted := &proxyconfigv1.Service{
+		ServicePorts: []*proxyconfigv1.Service_ServicePort{
+			{
+				Port:  8080,
+				Fault: faulted.Fault,
+			},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		svc         *proxyconfigv1.Service
+		expectError bool
+	}{
+		{
+			name:   "no fault in production namespace",
+			labels: map[string]string{label.Environment: label.EnvironmentProduction},
+			svc:    &proxyconfigv1.Service{},
+		},
+		{
+			name: "fault in unlabelled namespace",
+			svc:  faulted,
+		},
+		{
+			name:   "fault in staging namespace",
+			labels: map[string]string{label.Environment: "staging"},
+			svc:    faulted,
+		},
+		{
+			name:        "fault in production namespace",
+			labels:      map[string]string{label.Environment: label.EnvironmentProduction},
+			svc:         faulted,
+			expectError: true,
+		},
+		{
+			name:        "port fault in production namespace",
+			labels:      map[string]string{label.Environment: label.EnvironmentProduction},
+			svc:         portFaulted,
+			expectError: true,
+		},
+		{
+			name: "fault in production namespace allowing faults",
+			labels: map[string]string{
+				label.Environment:         label.EnvironmentProduction,
+				label.AllowFaultInjection: "true",
+			},
+			svc: faulted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeClient := fake.NewClientset(&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "test",
+					Labels: tt.labels,
+				},
+			})
+			handler, err := NewAdmissionValidationHandler(ktesting.NewLogger(t, ktesting.NewConfig()), kubeClient, nil)
+			assert.NoError(t, err)
+
+			err = handler.validateFaultPolicy(context.Background(), "test", tt.svc)
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
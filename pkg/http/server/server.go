@@ -5,16 +5,29 @@ import (
 	"net/http"
 	"net/http/pprof"
 
+	"github.com/bpalermo/maestro/internal/config/constants"
 	"github.com/bpalermo/maestro/pkg/http/handlers"
+	"github.com/bpalermo/maestro/pkg/injection"
 	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
 	"github.com/spiffe/go-spiffe/v2/workloadapi"
 	"go.uber.org/atomic"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type HTTPServerArgs struct {
 	Addr            string
 	SpireSocketPath string
+	// ConfigMapPrefix is the prefix of the ConfigMaps holding the proxy bootstrap, mounted in injected pods.
+	ConfigMapPrefix string
+	// TemplateNamespace is the namespace of the ConfigMap holding the sidecar template.
+	TemplateNamespace string
+	// TemplateConfigMap is the name of the ConfigMap holding the sidecar template. The built-in template is used if empty.
+	TemplateConfigMap string
+	// InjectionPolicy selects the pods injected with the sidecar.
+	InjectionPolicy *injection.Policy
 }
 
 type HTTPServer struct {
@@ -24,12 +37,16 @@ type HTTPServer struct {
 
 func NewHTTPServerArgs() *HTTPServerArgs {
 	return &HTTPServerArgs{
-		Addr:            ":443",
-		SpireSocketPath: "unix:///spiffe-workload-api/spire-agent.sock",
+		Addr:              ":443",
+		SpireSocketPath:   "unix:///spiffe-workload-api/spire-agent.sock",
+		ConfigMapPrefix:   constants.ProxyConfigMapPrefix,
+		TemplateNamespace: "maestro",
+		TemplateConfigMap: "maestro-sidecar-template",
+		InjectionPolicy:   injection.DefaultPolicy(),
 	}
 }
 
-func NewServer(args *HTTPServerArgs, source *workloadapi.X509Source, logger klog.Logger) (*HTTPServer, error) {
+func NewServer(args *HTTPServerArgs, source *workloadapi.X509Source, kubeClient kubernetes.Interface, namespaces corelisters.NamespaceLister, proxyConfigs client.Reader, templates handlers.SidecarTemplateProvider, logger klog.Logger) (*HTTPServer, error) {
 	mux := http.NewServeMux()
 
 	tlsConfig := tlsconfig.TLSServerConfig(source)
@@ -49,14 +66,14 @@ func NewServer(args *HTTPServerArgs, source *workloadapi.X509Source, logger klog
 	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
 
-	validationHandler, err := handlers.NewAdmissionValidationHandler(logger)
+	validationHandler, err := handlers.NewAdmissionValidationHandler(logger, kubeClient, proxyConfigs)
 	if err != nil {
 		return nil, err
 	}
 
 	mux.Handle("/validate", handlers.NewAdmissionHandler(validationHandler, logger))
 
-	mutationHandler, err := handlers.NewAdmissionMutationHandler(logger)
+	mutationHandler, err := handlers.NewAdmissionMutationHandler(logger, kubeClient, namespaces, proxyConfigs, args.ConfigMapPrefix, templates, args.InjectionPolicy)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,334 @@
+package injection
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/bpalermo/maestro/internal/config/label"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// DefaultNamespaceSelector selects the namespaces labelled to enable injection.
+	DefaultNamespaceSelector = label.Injection + "=" + label.InjectionEnabled
+	// DefaultObjectSelector selects the pods not labelled to disable injection.
+	DefaultObjectSelector = label.Injection + " notin (" + label.InjectionDisabled + ")"
+	// DefaultNeverInjectSelector selects the maestro control plane pods.
+	DefaultNeverInjectSelector = "app.kubernetes.io/part-of=maestro"
+)
+
+// DriftPolicy is the action taken on pods re-submitted with sidecars that do not match the
+// current template, typically by a controller holding a stale pod template.
+type DriftPolicy string
+
+const (
+	// DriftPolicyReconcile uninjects the stale sidecars and injects the current ones.
+	DriftPolicyReconcile DriftPolicy = "reconcile"
+	// DriftPolicyRefuse denies the admission of the pod, unless it no longer requires injection.
+	DriftPolicyRefuse DriftPolicy = "refuse"
+)
+
+// ParseDriftPolicy returns the drift policy of the given name.
+func ParseDriftPolicy(name string) (DriftPolicy, error) {
+	switch policy := DriftPolicy(name); policy {
+	case DriftPolicyReconcile, DriftPolicyRefuse:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown drift policy %q, must be one of %s or %s", name, DriftPolicyReconcile, DriftPolicyRefuse)
+	}
+}
+
+var (
+	// DefaultIgnoredNamespaces are the Kubernetes system namespaces.
+	DefaultIgnoredNamespaces = []string{
+		metav1.NamespaceSystem,
+		metav1.NamespacePublic,
+		corev1.NamespaceNodeLease,
+	}
+)
+
+// Policy decides which pods are injected. It is evaluated by the mutation handler and used to
+// generate the MutatingWebhookConfiguration, so that both agree on the pods in scope.
+type Policy struct {
+	// IgnoredNamespaces are namespaces pods are never injected in.
+	IgnoredNamespaces []string
+	// NamespaceSelector selects the namespaces pods are injected in.
+	NamespaceSelector *metav1.LabelSelector
+	// ObjectSelector selects the pods injected.
+	ObjectSelector *metav1.LabelSelector
+	// NeverInjectSelectors select pods never injected whatever their namespace, such as control plane pods.
+	NeverInjectSelectors []*metav1.LabelSelector
+	// Revision is the revision of maestro injecting the pods labelled, or in a namespace labelled,
+	// with maestro.io/rev set to it. The pod label takes precedence over the namespace label.
+	Revision string
+	// DefaultRevision is whether the pods without revision are injected by this revision when
+	// their namespace is selected.
+	DefaultRevision bool
+	// Drift is the action taken on pods injected with a stale sidecar template.
+	Drift DriftPolicy
+	// InjectWorkloads injects the pod templates of workloads at their admission, so that the
+	// injection shows on the workloads and their pods are rolled when it changes.
+	InjectWorkloads bool
+	// RewriteProbes rewrites the HTTP probes of the application to go through the probe listener
+	// of the proxy, for kubelet to reach applications behind an inbound listener requiring mTLS.
+	// It is overridden per pod by the sidecar.maestro.io/rewriteProbes annotation and forced for pods intercepting traffic.
+	RewriteProbes bool
+}
+
+// NewPolicy returns a policy from label selectors in their string representation. Empty
+// selectors match everything.
+func NewPolicy(ignoredNamespaces []string, namespaceSelector string, objectSelector string, neverInjectSelectors []string) (*Policy, error) {
+	policy := &Policy{
+		IgnoredNamespaces: slices.Clone(ignoredNamespaces),
+		DefaultRevision:   true,
+		Drift:             DriftPolicyReconcile,
+	}
+
+	var err error
+	if policy.NamespaceSelector, err = parseSelector(namespaceSelector); err != nil {
+		return nil, fmt.Errorf("invalid namespace selector: %w", err)
+	}
+	if policy.ObjectSelector, err = parseSelector(objectSelector); err != nil {
+		return nil, fmt.Errorf("invalid object selector: %w", err)
+	}
+	for _, neverInjectSelector := range neverInjectSelectors {
+		selector, err := parseSelector(neverInjectSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid never inject selector: %w", err)
+		}
+		if selector != nil {
+			policy.NeverInjectSelectors = append(policy.NeverInjectSelectors, selector)
+		}
+	}
+
+	return policy, nil
+}
+
+// DefaultPolicy returns the policy injecting the pods of the namespaces labelled with
+// maestro.io/injection=enabled, unless the pods are labelled with maestro.io/injection=disabled.
+func DefaultPolicy() *Policy {
+	policy, err := NewPolicy(DefaultIgnoredNamespaces, DefaultNamespaceSelector, DefaultObjectSelector, []string{DefaultNeverInjectSelector})
+	if err != nil {
+		panic(err)
+	}
+	return policy
+}
+
+// InjectionRequired returns whether a pod of the given namespace is injected, and the reason when it is not.
+func (p *Policy) InjectionRequired(namespace *corev1.Namespace, pod *corev1.Pod) (bool, string, error) {
+	if slices.Contains(p.IgnoredNamespaces, namespace.Name) {
+		return false, "namespace is ignored", nil
+	}
+
+	revision, revisioned := pod.Labels[label.Revision]
+	if !revisioned {
+		revision, revisioned = namespace.Labels[label.Revision]
+	}
+
+	if revisioned {
+		if revision != p.Revision {
+			return false, fmt.Sprintf("revision %q is not served", revision), nil
+		}
+	} else {
+		if !p.DefaultRevision {
+			return false, "pod has no revision", nil
+		}
+
+		matches, err := selectorMatches(p.NamespaceSelector, namespace.Labels)
+		if err != nil {
+			return false, "", fmt.Errorf("invalid namespace selector: %w", err)
+		}
+		if !matches {
+			return false, "namespace is not selected", nil
+		}
+	}
+
+	matches, err := selectorMatches(p.ObjectSelector, pod.Labels)
+	if err != nil {
+		return false, "", fmt.Errorf("invalid object selector: %w", err)
+	}
+	if !matches {
+		return false, "pod is not selected", nil
+	}
+
+	for _, selector := range p.NeverInjectSelectors {
+		matches, err = selectorMatches(selector, pod.Labels)
+		if err != nil {
+			return false, "", fmt.Errorf("invalid never inject selector: %w", err)
+		}
+		if matches {
+			return false, "pod is never injected", nil
+		}
+	}
+
+	return true, "", nil
+}
+
+// MutatingWebhooks returns the webhooks injecting the pods selected by the policy, prefixing
+// the given name. The never inject selectors cannot be expressed by the webhook object
+// selectors, and are only enforced by the handler.
+func (p *Policy) MutatingWebhooks(name string, clientConfig admissionregistrationv1.WebhookClientConfig) []admissionregistrationv1.MutatingWebhook {
+	var webhooks []admissionregistrationv1.MutatingWebhook
+
+	if p.Revision != "" {
+		revision := map[string]string{label.Revision: p.Revision}
+
+		// namespaces of the revision, unless pods select a revision themselves
+		webhooks = append(webhooks, p.mutatingWebhook(
+			"rev.namespace."+name,
+			clientConfig,
+			p.ignoredNamespacesSelector(&metav1.LabelSelector{MatchLabels: revision}),
+			withoutRevision(p.ObjectSelector),
+		))
+
+		// pods of the revision, in any namespace
+		objectSelector := &metav1.LabelSelector{}
+		if p.ObjectSelector != nil {
+			objectSelector = p.ObjectSelector.DeepCopy()
+		}
+		objectSelector.MatchLabels = mergeLabels(objectSelector.MatchLabels, revision)
+		webhooks = append(webhooks, p.mutatingWebhook(
+			"rev.object."+name,
+			clientConfig,
+			p.ignoredNamespacesSelector(nil),
+			objectSelector,
+		))
+	}
+
+	if p.DefaultRevision {
+		webhooks = append(webhooks, p.mutatingWebhook(
+			"namespace."+name,
+			clientConfig,
+			p.ignoredNamespacesSelector(withoutRevision(p.NamespaceSelector)),
+			withoutRevision(p.ObjectSelector),
+		))
+	}
+
+	if p.InjectWorkloads {
+		webhooks = append(webhooks, p.workloadWebhook("workload."+name, clientConfig))
+	}
+
+	return webhooks
+}
+
+// workloadWebhook returns the webhook injecting the pod templates of workloads. The selectors
+// of the policy apply to the labels of the pod templates rather than the workloads, so all
+// workloads are sent to the handler evaluating the policy. Failures are ignored, as pods are
+// still injected at their own admission.
+func (p *Policy) workloadWebhook(name string, clientConfig admissionregistrationv1.WebhookClientConfig) admissionregistrationv1.MutatingWebhook {
+	webhook := p.mutatingWebhook(name, clientConfig, p.ignoredNamespacesSelector(nil), nil)
+
+	failurePolicy := admissionregistrationv1.Ignore
+	webhook.FailurePolicy = &failurePolicy
+
+	webhook.Rules = nil
+	for _, resource := range WorkloadResources {
+		operations := []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update}
+		// the pod template of jobs is immutable
+		if resource.Group == batchv1.GroupName {
+			operations = operations[:1]
+		}
+		webhook.Rules = append(webhook.Rules, admissionregistrationv1.RuleWithOperations{
+			Operations: operations,
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{resource.Group},
+				APIVersions: []string{resource.Version},
+				Resources:   []string{resource.Resource},
+			},
+		})
+	}
+
+	return webhook
+}
+
+func (p *Policy) mutatingWebhook(name string, clientConfig admissionregistrationv1.WebhookClientConfig, namespaceSelector *metav1.LabelSelector, objectSelector *metav1.LabelSelector) admissionregistrationv1.MutatingWebhook {
+	failurePolicy := admissionregistrationv1.Fail
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	reinvocationPolicy := admissionregistrationv1.NeverReinvocationPolicy
+
+	return admissionregistrationv1.MutatingWebhook{
+		Name:         name,
+		ClientConfig: clientConfig,
+		Rules: []admissionregistrationv1.RuleWithOperations{
+			{
+				Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+				Rule: admissionregistrationv1.Rule{
+					APIGroups:   []string{""},
+					APIVersions: []string{"v1"},
+					Resources:   []string{"pods"},
+				},
+			},
+		},
+		FailurePolicy:           &failurePolicy,
+		SideEffects:             &sideEffects,
+		ReinvocationPolicy:      &reinvocationPolicy,
+		NamespaceSelector:       namespaceSelector,
+		ObjectSelector:          objectSelector,
+		AdmissionReviewVersions: []string{"v1"},
+	}
+}
+
+// ignoredNamespacesSelector returns a copy of a namespace selector excluding the ignored namespaces.
+func (p *Policy) ignoredNamespacesSelector(selector *metav1.LabelSelector) *metav1.LabelSelector {
+	out := &metav1.LabelSelector{}
+	if selector != nil {
+		out = selector.DeepCopy()
+	}
+
+	if len(p.IgnoredNamespaces) > 0 {
+		out.MatchExpressions = append(out.MatchExpressions, metav1.LabelSelectorRequirement{
+			Key:      corev1.LabelMetadataName,
+			Operator: metav1.LabelSelectorOpNotIn,
+			Values:   slices.Clone(p.IgnoredNamespaces),
+		})
+	}
+
+	return out
+}
+
+// withoutRevision returns a copy of a selector only matching objects without revision label.
+func withoutRevision(selector *metav1.LabelSelector) *metav1.LabelSelector {
+	out := &metav1.LabelSelector{}
+	if selector != nil {
+		out = selector.DeepCopy()
+	}
+
+	out.MatchExpressions = append(out.MatchExpressions, metav1.LabelSelectorRequirement{
+		Key:      label.Revision,
+		Operator: metav1.LabelSelectorOpDoesNotExist,
+	})
+
+	return out
+}
+
+func mergeLabels(a, b map[string]string) map[string]string {
+	out := make(map[string]string, len(a)+len(b))
+	maps.Copy(out, a)
+	maps.Copy(out, b)
+	return out
+}
+
+func parseSelector(selector string) (*metav1.LabelSelector, error) {
+	if selector == "" {
+		return nil, nil
+	}
+	return metav1.ParseToLabelSelector(selector)
+}
+
+// selectorMatches returns whether a selector matches labels, a nil selector matching everything.
+func selectorMatches(selector *metav1.LabelSelector, set map[string]string) (bool, error) {
+	if selector == nil {
+		return true, nil
+	}
+
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false, err
+	}
+	return s.Matches(labels.Set(set)), nil
+}
@@ -0,0 +1,167 @@
+package injection
+
+import (
+	"testing"
+
+	"github.com/bpalermo/maestro/internal/config/label"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPolicy_InjectionRequired(t *testing.T) {
+	enabled := map[string]string{label.Injection: label.InjectionEnabled}
+
+	canary := DefaultPolicy()
+	canary.Revision = "canary"
+	canary.DefaultRevision = false
+
+	tests := []struct {
+		name           string
+		policy         *Policy
+		namespace      *corev1.Namespace
+		podLabels      map[string]string
+		expected       bool
+		expectedReason string
+	}{
+		{
+			name:      "enabled namespace",
+			namespace: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps", Labels: enabled}},
+			expected:  true,
+		},
+		{
+			name:           "namespace without label",
+			namespace:      &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps"}},
+			expectedReason: "namespace is not selected",
+		},
+		{
+			name:           "ignored namespace",
+			namespace:      &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: metav1.NamespaceSystem, Labels: enabled}},
+			expectedReason: "namespace is ignored",
+		},
+		{
+			name:           "pod opted out",
+			namespace:      &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps", Labels: enabled}},
+			podLabels:      map[string]string{label.Injection: label.InjectionDisabled},
+			expectedReason: "pod is not selected",
+		},
+		{
+			name:           "control plane pod",
+			namespace:      &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps", Labels: enabled}},
+			podLabels:      map[string]string{"app.kubernetes.io/part-of": "maestro"},
+			expectedReason: "pod is never injected",
+		},
+		{
+			name:           "namespace of another revision",
+			namespace:      &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps", Labels: map[string]string{label.Revision: "canary"}}},
+			expectedReason: `revision "canary" is not served`,
+		},
+		{
+			name:      "namespace of the revision",
+			policy:    canary,
+			namespace: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps", Labels: map[string]string{label.Revision: "canary"}}},
+			expected:  true,
+		},
+		{
+			name:      "pod of the revision",
+			policy:    canary,
+			namespace: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps", Labels: enabled}},
+			podLabels: map[string]string{label.Revision: "canary"},
+			expected:  true,
+		},
+		{
+			name:           "pod revision takes precedence",
+			policy:         canary,
+			namespace:      &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps", Labels: map[string]string{label.Revision: "canary"}}},
+			podLabels:      map[string]string{label.Revision: "stable"},
+			expectedReason: `revision "stable" is not served`,
+		},
+		{
+			name:           "pod without revision",
+			policy:         canary,
+			namespace:      &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps", Labels: enabled}},
+			expectedReason: "pod has no revision",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := tt.policy
+			if policy == nil {
+				policy = DefaultPolicy()
+			}
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: tt.podLabels}}
+
+			required, reason, err := policy.InjectionRequired(tt.namespace, pod)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, required)
+			assert.Equal(t, tt.expectedReason, reason)
+		})
+	}
+}
+
+func TestNewPolicy(t *testing.T) {
+	policy, err := NewPolicy(nil, "", "", nil)
+	require.NoError(t, err)
+
+	required, _, err := policy.InjectionRequired(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps"}}, &corev1.Pod{})
+	require.NoError(t, err)
+	assert.True(t, required)
+
+	_, err = NewPolicy(nil, "env in (", "", nil)
+	assert.ErrorContains(t, err, "invalid namespace selector")
+}
+
+func TestPolicy_MutatingWebhooks(t *testing.T) {
+	ignored := metav1.LabelSelectorRequirement{
+		Key:      corev1.LabelMetadataName,
+		Operator: metav1.LabelSelectorOpNotIn,
+		Values:   DefaultIgnoredNamespaces,
+	}
+	noRevision := metav1.LabelSelectorRequirement{
+		Key:      label.Revision,
+		Operator: metav1.LabelSelectorOpDoesNotExist,
+	}
+	optOut := DefaultPolicy().ObjectSelector.MatchExpressions[0]
+
+	webhooks := DefaultPolicy().MutatingWebhooks("sidecar.maestro.io", admissionregistrationv1.WebhookClientConfig{})
+	require.Len(t, webhooks, 1)
+	assert.Equal(t, "namespace.sidecar.maestro.io", webhooks[0].Name)
+	assert.Equal(t, &metav1.LabelSelector{
+		MatchLabels:      map[string]string{label.Injection: label.InjectionEnabled},
+		MatchExpressions: []metav1.LabelSelectorRequirement{noRevision, ignored},
+	}, webhooks[0].NamespaceSelector)
+	assert.Equal(t, []metav1.LabelSelectorRequirement{optOut, noRevision}, webhooks[0].ObjectSelector.MatchExpressions)
+	assert.Equal(t, []string{"pods"}, webhooks[0].Rules[0].Resources)
+
+	canary := DefaultPolicy()
+	canary.Revision = "canary"
+	canary.DefaultRevision = false
+
+	webhooks = canary.MutatingWebhooks("sidecar.maestro.io", admissionregistrationv1.WebhookClientConfig{})
+	require.Len(t, webhooks, 2)
+	assert.Equal(t, "rev.namespace.sidecar.maestro.io", webhooks[0].Name)
+	assert.Equal(t, &metav1.LabelSelector{
+		MatchLabels:      map[string]string{label.Revision: "canary"},
+		MatchExpressions: []metav1.LabelSelectorRequirement{ignored},
+	}, webhooks[0].NamespaceSelector)
+	assert.Equal(t, "rev.object.sidecar.maestro.io", webhooks[1].Name)
+	assert.Equal(t, &metav1.LabelSelector{
+		MatchLabels:      map[string]string{label.Revision: "canary"},
+		MatchExpressions: []metav1.LabelSelectorRequirement{optOut},
+	}, webhooks[1].ObjectSelector)
+
+	workloads := DefaultPolicy()
+	workloads.InjectWorkloads = true
+
+	webhooks = workloads.MutatingWebhooks("sidecar.maestro.io", admissionregistrationv1.WebhookClientConfig{})
+	require.Len(t, webhooks, 2)
+	assert.Equal(t, "workload.sidecar.maestro.io", webhooks[1].Name)
+	assert.Nil(t, webhooks[1].ObjectSelector)
+	assert.Equal(t, admissionregistrationv1.Ignore, *webhooks[1].FailurePolicy)
+	require.Len(t, webhooks[1].Rules, len(WorkloadResources))
+	assert.Equal(t, []string{"jobs"}, webhooks[1].Rules[3].Resources)
+	assert.Equal(t, []admissionregistrationv1.OperationType{admissionregistrationv1.Create}, webhooks[1].Rules[3].Operations)
+}
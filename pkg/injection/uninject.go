@@ -0,0 +1,74 @@
+package injection
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/bpalermo/maestro/internal/config"
+	"github.com/bpalermo/maestro/internal/config/annotation"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Uninject returns a copy of an injected pod without the containers and volumes listed in its
+// sidecar status, with its rewritten probes restored and the injection annotations removed.
+// Pods injected before the status recorded what was injected cannot be uninjected.
+func Uninject(pod *corev1.Pod) (*corev1.Pod, error) {
+	status, err := config.ParseSidecarStatus(pod.Annotations[annotation.SidecarStatus])
+	if err != nil {
+		return nil, err
+	}
+	if status == nil {
+		return pod.DeepCopy(), nil
+	}
+	if status.Legacy() {
+		return nil, fmt.Errorf("pod %s/%s was injected without recording its sidecars", pod.Namespace, pod.Name)
+	}
+
+	out := pod.DeepCopy()
+	out.Spec.InitContainers = withoutContainers(out.Spec.InitContainers, status.InitContainers)
+	out.Spec.Containers = withoutContainers(out.Spec.Containers, status.Containers)
+	out.Spec.Volumes = slices.DeleteFunc(out.Spec.Volumes, func(volume corev1.Volume) bool {
+		return slices.Contains(status.Volumes, volume.Name)
+	})
+
+	if value, ok := out.Annotations[annotation.SidecarOriginalProbes]; ok {
+		originals := config.OriginalProbes{}
+		if err := json.Unmarshal([]byte(value), &originals); err != nil {
+			return nil, fmt.Errorf("invalid annotation %s: %w", annotation.SidecarOriginalProbes, err)
+		}
+		restoreProbes(out.Spec.Containers, originals)
+	}
+
+	delete(out.Annotations, annotation.SidecarStatus)
+	delete(out.Annotations, annotation.SidecarOriginalProbes)
+	delete(out.Annotations, annotation.ConfigHash)
+
+	return out, nil
+}
+
+func withoutContainers(containers []corev1.Container, names []string) []corev1.Container {
+	return slices.DeleteFunc(containers, func(container corev1.Container) bool {
+		return slices.Contains(names, container.Name)
+	})
+}
+
+func restoreProbes(containers []corev1.Container, originals config.OriginalProbes) {
+	for i := range containers {
+		container := &containers[i]
+		for field, action := range originals[container.Name] {
+			var probe *corev1.Probe
+			switch field {
+			case "livenessProbe":
+				probe = container.LivenessProbe
+			case "readinessProbe":
+				probe = container.ReadinessProbe
+			case "startupProbe":
+				probe = container.StartupProbe
+			}
+			if probe != nil {
+				probe.HTTPGet = action
+			}
+		}
+	}
+}
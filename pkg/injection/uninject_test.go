@@ -0,0 +1,82 @@
+package injection
+
+import (
+	"testing"
+
+	"github.com/bpalermo/maestro/internal/config"
+	"github.com/bpalermo/maestro/internal/config/annotation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestUninject(t *testing.T) {
+	status := &config.SidecarStatus{
+		InitContainers: []string{"maestro-init", "maestro-proxy"},
+		Volumes:        []string{"envoy-config"},
+		TemplateHash:   "0123456789abcdef",
+	}
+
+	tests := []struct {
+		name     string
+		pod      *corev1.Pod
+		expected *corev1.Pod
+		wantErr  bool
+	}{
+		{
+			name: "injected",
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+					annotation.SidecarStatus:         status.String(),
+					annotation.SidecarOriginalProbes: `{"app":{"livenessProbe":{"path":"/healthz","port":8080}}}`,
+					annotation.ConfigHash:            "fedcba9876543210",
+				}},
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "maestro-init"}, {Name: "maestro-proxy"}, {Name: "migrate"}},
+					Containers: []corev1.Container{{
+						Name:          "app",
+						LivenessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromInt32(15020)}}},
+					}},
+					Volumes: []corev1.Volume{{Name: "envoy-config"}, {Name: "data"}},
+				},
+			},
+			expected: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}},
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "migrate"}},
+					Containers: []corev1.Container{{
+						Name:          "app",
+						LivenessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromInt32(8080)}}},
+					}},
+					Volumes: []corev1.Volume{{Name: "data"}},
+				},
+			},
+		},
+		{
+			name:     "not injected",
+			pod:      &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}},
+			expected: &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}},
+		},
+		{
+			name: "legacy status",
+			pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+				annotation.SidecarStatus: "injected",
+			}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uninjected, err := Uninject(tt.pod)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, uninjected)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package injection
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/bpalermo/maestro/internal/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// TemplateWatcher keeps the sidecar template in sync with a ConfigMap. The built-in template
+// is used while the ConfigMap does not exist, and the last valid template is kept when the
+// ConfigMap holds an invalid one.
+type TemplateWatcher struct {
+	logger klog.Logger
+
+	// factory is nil when no ConfigMap is watched
+	factory  informers.SharedInformerFactory
+	informer cache.SharedIndexInformer
+
+	current atomic.Pointer[config.SidecarTemplate]
+}
+
+// NewTemplateWatcher returns a watcher of the sidecar template held by the named ConfigMap.
+// The built-in template is always used if the name is empty.
+func NewTemplateWatcher(logger klog.Logger, kubeClient kubernetes.Interface, namespace string, name string) *TemplateWatcher {
+	w := &TemplateWatcher{
+		logger: logger.WithValues("configMap", klog.KRef(namespace, name)),
+	}
+	w.current.Store(config.DefaultSidecarTemplate())
+
+	if name == "" {
+		return w
+	}
+
+	w.factory = informers.NewSharedInformerFactoryWithOptions(
+		kubeClient,
+		time.Minute*10,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector(metav1.ObjectNameField, name).String()
+		}),
+	)
+	w.informer = w.factory.Core().V1().ConfigMaps().Informer()
+
+	_, _ = w.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: w.update,
+		UpdateFunc: func(o, n interface{}) {
+			if o.(*corev1.ConfigMap).ResourceVersion == n.(*corev1.ConfigMap).ResourceVersion {
+				return
+			}
+			w.update(n)
+		},
+		DeleteFunc: func(interface{}) {
+			w.logger.Info("Sidecar template ConfigMap deleted, using the built-in template")
+			w.current.Store(config.DefaultSidecarTemplate())
+		},
+	})
+
+	return w
+}
+
+// Start starts watching the ConfigMap and waits for the initial template to be loaded.
+func (w *TemplateWatcher) Start(ctx context.Context) error {
+	if w.factory == nil {
+		return nil
+	}
+
+	w.factory.Start(ctx.Done())
+
+	if ok := cache.WaitForCacheSync(ctx.Done(), w.informer.HasSynced); !ok {
+		return fmt.Errorf("failed to wait for the sidecar template cache to sync")
+	}
+
+	return nil
+}
+
+// Template returns the current sidecar template.
+func (w *TemplateWatcher) Template() *config.SidecarTemplate {
+	return w.current.Load()
+}
+
+func (w *TemplateWatcher) update(obj interface{}) {
+	configMap, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return
+	}
+
+	tmpl, err := config.ParseSidecarTemplate(configMap.Data)
+	if err != nil {
+		w.logger.Error(err, "Invalid sidecar template, keeping the previous one", "resourceVersion", configMap.ResourceVersion)
+		return
+	}
+
+	w.current.Store(tmpl)
+	w.logger.Info("Sidecar template loaded", "resourceVersion", configMap.ResourceVersion)
+}
@@ -0,0 +1,53 @@
+package injection
+
+import (
+	"slices"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var (
+	// WorkloadResources are the resources whose pod templates are injected when workloads are injected.
+	WorkloadResources = []metav1.GroupVersionResource{
+		{Group: appsv1.GroupName, Version: "v1", Resource: "deployments"},
+		{Group: appsv1.GroupName, Version: "v1", Resource: "statefulsets"},
+		{Group: appsv1.GroupName, Version: "v1", Resource: "daemonsets"},
+		{Group: batchv1.GroupName, Version: "v1", Resource: "jobs"},
+	}
+)
+
+// IsWorkloadResource returns whether pod templates of the resource are injected.
+func IsWorkloadResource(resource metav1.GroupVersionResource) bool {
+	return slices.Contains(WorkloadResources, resource)
+}
+
+// PodTemplate returns the pod template of a workload, or nil when the object is not a
+// supported workload.
+func PodTemplate(obj runtime.Object) *corev1.PodTemplateSpec {
+	switch workload := obj.(type) {
+	case *appsv1.Deployment:
+		return &workload.Spec.Template
+	case *appsv1.StatefulSet:
+		return &workload.Spec.Template
+	case *appsv1.DaemonSet:
+		return &workload.Spec.Template
+	case *batchv1.Job:
+		return &workload.Spec.Template
+	default:
+		return nil
+	}
+}
+
+// TemplatePod returns the pod created from a pod template of the given namespace.
+func TemplatePod(namespace string, template *corev1.PodTemplateSpec) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: *template.ObjectMeta.DeepCopy(),
+		Spec:       *template.Spec.DeepCopy(),
+	}
+	pod.Namespace = namespace
+	return pod
+}
@@ -0,0 +1,87 @@
+package manager
+
+import (
+	"context"
+
+	configv1 "github.com/bpalermo/maestro/pkg/apis/config/v1"
+	"github.com/bpalermo/maestro/pkg/controller"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+type ControllerManager struct {
+	*MaestroManager
+
+	controller *controller.MaestroController
+}
+
+var _ manager.Manager = &ControllerManager{}
+
+// NewControllerManager returns a manager running the ProxyConfig controller. The controller
+// replicas elect the one reconciling the ProxyConfig resources when leader election is enabled.
+func NewControllerManager(ctx context.Context, name string, args *controller.MaestroControllerArgs, options ...controller.MaestroControllerOption) (m *ControllerManager, err error) {
+	restConfig, err := clientcmd.BuildConfigFromFlags(args.MasterURL, args.KubeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := runtime.NewScheme()
+	if err = clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err = configv1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheOptions, err := controller.CacheOptions(ctx, kubeClient, args)
+	if err != nil {
+		return nil, err
+	}
+
+	managerOptions := []MaestroManagerOptions{
+		WithName(name),
+		WithRestConfig(restConfig),
+		WithScheme(scheme),
+		WithCache(cacheOptions),
+		WithMetricsBindAddress(args.MetricsAddr),
+		WithHealthProbeBindAddress(args.HealthProbeAddr),
+	}
+	if args.LeaderElection.Enabled {
+		managerOptions = append(managerOptions, WithLeaderElection(args.LeaderElection.ID, args.LeaderElection.Namespace))
+	}
+
+	mMgr, err := NewMaestroManager(managerOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := controller.NewMaestroController(mMgr, args, options...)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.SetupWithManager(mMgr); err != nil {
+		return nil, err
+	}
+
+	return &ControllerManager{
+		MaestroManager: mMgr,
+		controller:     c,
+	}, nil
+}
+
+// KubeClientSet returns the kubernetes client set of the controller.
+func (m *ControllerManager) KubeClientSet() kubernetes.Interface {
+	return m.controller.KubeClientSet()
+}
+
+func (m *ControllerManager) Start(ctx context.Context) error {
+	return m.Manager.Start(ctx)
+}
@@ -1,6 +1,9 @@
 package manager
 
 import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	k8sManager "sigs.k8s.io/controller-runtime/pkg/manager"
@@ -15,7 +18,9 @@ const (
 type MaestroManager struct {
 	k8sManager.Manager
 
-	name string
+	name    string
+	config  *rest.Config
+	options k8sManager.Options
 }
 
 var _ k8sManager.Manager = &MaestroManager{}
@@ -23,28 +28,37 @@ var _ k8sManager.Manager = &MaestroManager{}
 type MaestroManagerOptions func(*MaestroManager)
 
 func NewMaestroManager(options ...MaestroManagerOptions) (m *MaestroManager, err error) {
-	mgr, err := k8sManager.New(config.GetConfigOrDie(), k8sManager.Options{
-		Metrics: metricsserver.Options{
-			BindAddress: defaultMetricsBindAddress,
-		},
-	})
-	if err != nil {
-		return nil, err
-	}
-
 	m = &MaestroManager{
-		name:    defaultManagerName,
-		Manager: mgr,
+		name: defaultManagerName,
+		options: k8sManager.Options{
+			Metrics: metricsserver.Options{
+				BindAddress: defaultMetricsBindAddress,
+			},
+		},
 	}
 	for _, option := range options {
 		option(m)
 	}
 
+	if m.config == nil {
+		m.config = config.GetConfigOrDie()
+	}
+
+	m.Manager, err = k8sManager.New(m.config, m.options)
+	if err != nil {
+		return nil, err
+	}
+
 	// Add a liveness check
 	if err = m.Manager.AddHealthzCheck(m.name, healthz.Ping); err != nil {
 		return nil, err
 	}
 
+	// Add a readiness check
+	if err = m.Manager.AddReadyzCheck(m.name, healthz.Ping); err != nil {
+		return nil, err
+	}
+
 	return m, nil
 }
 
@@ -54,3 +68,50 @@ func WithName(name string) MaestroManagerOptions {
 		m.name = name
 	}
 }
+
+// WithRestConfig sets the config used to reach the API server. It is loaded from the
+// kubeconfig flag, the environment or the in-cluster config if unset.
+func WithRestConfig(config *rest.Config) MaestroManagerOptions {
+	return func(m *MaestroManager) {
+		m.config = config
+	}
+}
+
+// WithScheme sets the scheme of the objects read and written by the manager
+func WithScheme(scheme *runtime.Scheme) MaestroManagerOptions {
+	return func(m *MaestroManager) {
+		m.options.Scheme = scheme
+	}
+}
+
+// WithCache sets the options of the cache the objects are read from
+func WithCache(options cache.Options) MaestroManagerOptions {
+	return func(m *MaestroManager) {
+		m.options.Cache = options
+	}
+}
+
+// WithMetricsBindAddress sets the address the metrics are served on. Metrics are disabled if set to 0.
+func WithMetricsBindAddress(address string) MaestroManagerOptions {
+	return func(m *MaestroManager) {
+		m.options.Metrics.BindAddress = address
+	}
+}
+
+// WithHealthProbeBindAddress sets the address the liveness and readiness probes are served on.
+func WithHealthProbeBindAddress(address string) MaestroManagerOptions {
+	return func(m *MaestroManager) {
+		m.options.HealthProbeBindAddress = address
+	}
+}
+
+// WithLeaderElection only runs the leader election runnables of the manager once the given
+// Lease is acquired, so a single replica runs them. The Lease is released when the manager stops.
+func WithLeaderElection(id string, namespace string) MaestroManagerOptions {
+	return func(m *MaestroManager) {
+		m.options.LeaderElection = true
+		m.options.LeaderElectionID = id
+		m.options.LeaderElectionNamespace = namespace
+		m.options.LeaderElectionReleaseOnCancel = true
+	}
+}
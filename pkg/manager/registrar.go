@@ -3,9 +3,12 @@ package manager
 import (
 	"context"
 
+	configv1 "github.com/bpalermo/maestro/pkg/apis/config/v1"
 	"github.com/bpalermo/maestro/pkg/reconciler"
 	"github.com/go-logr/logr"
 	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
@@ -19,7 +22,16 @@ var _ manager.Manager = &RegistrarManager{}
 type RegistrarManagerOptions func(*RegistrarManager)
 
 func NewRegistrarManager(name string, clusterName string, log logr.Logger, _ ...RegistrarManagerOptions) (m *RegistrarManager, err error) {
-	mMgr, err := NewMaestroManager(WithName(name))
+	// the access log server reads the ProxyConfig resources
+	scheme := runtime.NewScheme()
+	if err = clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err = configv1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	mMgr, err := NewMaestroManager(WithName(name), WithScheme(scheme))
 	if err != nil {
 		return nil, err
 	}
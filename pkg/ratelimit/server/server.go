@@ -0,0 +1,290 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	ratelimitcommonv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	rlsconfv3 "github.com/envoyproxy/go-control-plane/ratelimit/config/ratelimit/v3"
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	loggerName = "ratelimit-server"
+
+	defaultServerNetwork = "tcp"
+	defaultServerAddress = ":8081"
+)
+
+var (
+	unitDurations = map[rlsconfv3.RateLimitUnit]time.Duration{
+		rlsconfv3.RateLimitUnit_SECOND: time.Second,
+		rlsconfv3.RateLimitUnit_MINUTE: time.Minute,
+		rlsconfv3.RateLimitUnit_HOUR:   time.Hour,
+		rlsconfv3.RateLimitUnit_DAY:    24 * time.Hour,
+	}
+)
+
+// RateLimitServer is an Envoy rate limit service (RLS) evaluating requests
+// against the rate limit configurations generated from ProxyConfig resources.
+type RateLimitServer struct {
+	rlsv3.UnimplementedRateLimitServiceServer
+
+	log logr.Logger
+
+	network string
+	address string
+
+	store Store
+	now   func() time.Time
+
+	mu sync.RWMutex
+	// configs holds the rate limit configurations by name
+	configs map[string]*rlsconfv3.RateLimitConfig
+	// domains holds the rate limit configurations by domain
+	domains map[string]*rlsconfv3.RateLimitConfig
+
+	grpcServer *grpc.Server
+
+	shutdownTimeout time.Duration
+}
+
+type RateLimitServerOption func(*RateLimitServer)
+
+func NewRateLimitServer(log logr.Logger, opts ...RateLimitServerOption) *RateLimitServer {
+	srv := &RateLimitServer{
+		log:     log.WithName(loggerName),
+		network: defaultServerNetwork,
+		address: defaultServerAddress,
+		now:     time.Now,
+		configs: map[string]*rlsconfv3.RateLimitConfig{},
+		domains: map[string]*rlsconfv3.RateLimitConfig{},
+	}
+
+	for _, option := range opts {
+		option(srv)
+	}
+
+	if srv.store == nil {
+		srv.store = NewMemoryStore()
+	}
+
+	srv.grpcServer = grpc.NewServer()
+	rlsv3.RegisterRateLimitServiceServer(srv.grpcServer, srv)
+
+	return srv
+}
+
+// WithAddress sets the address the server listens on.
+func WithAddress(address string) RateLimitServerOption {
+	return func(s *RateLimitServer) {
+		s.address = address
+	}
+}
+
+// WithStore sets the store used to keep hit counters.
+func WithStore(store Store) RateLimitServerOption {
+	return func(s *RateLimitServer) {
+		s.store = store
+	}
+}
+
+func WithShutdownTimeout(timeout time.Duration) RateLimitServerOption {
+	return func(s *RateLimitServer) {
+		s.shutdownTimeout = timeout
+	}
+}
+
+// SetConfig adds or replaces a rate limit configuration.
+func (s *RateLimitServer) SetConfig(config *rlsconfv3.RateLimitConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if previous, exists := s.configs[config.GetName()]; exists {
+		s.deleteDomain(previous)
+	}
+
+	s.configs[config.GetName()] = config
+	s.domains[config.GetDomain()] = config
+}
+
+// DeleteConfig removes the rate limit configuration with the given name.
+func (s *RateLimitServer) DeleteConfig(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if previous, exists := s.configs[name]; exists {
+		s.deleteDomain(previous)
+		delete(s.configs, name)
+	}
+}
+
+// deleteDomain removes the domain of a configuration, unless another configuration took it over.
+func (s *RateLimitServer) deleteDomain(config *rlsconfv3.RateLimitConfig) {
+	if s.domains[config.GetDomain()] == config {
+		delete(s.domains, config.GetDomain())
+	}
+}
+
+func (s *RateLimitServer) ShouldRateLimit(_ context.Context, request *rlsv3.RateLimitRequest) (*rlsv3.RateLimitResponse, error) {
+	hits := request.GetHitsAddend()
+	if hits == 0 {
+		hits = 1
+	}
+
+	s.mu.RLock()
+	config := s.domains[request.GetDomain()]
+	s.mu.RUnlock()
+
+	now := s.now()
+	response := &rlsv3.RateLimitResponse{
+		OverallCode: rlsv3.RateLimitResponse_OK,
+	}
+	for _, descriptor := range request.GetDescriptors() {
+		status := s.descriptorStatus(config, request.GetDomain(), descriptor, hits, now)
+		if status.Code == rlsv3.RateLimitResponse_OVER_LIMIT {
+			response.OverallCode = rlsv3.RateLimitResponse_OVER_LIMIT
+		}
+		response.Statuses = append(response.Statuses, status)
+	}
+
+	return response, nil
+}
+
+func (s *RateLimitServer) descriptorStatus(config *rlsconfv3.RateLimitConfig, domain string, descriptor *ratelimitcommonv3.RateLimitDescriptor, hits uint32, now time.Time) *rlsv3.RateLimitResponse_DescriptorStatus {
+	match := findDescriptor(config.GetDescriptors(), descriptor.GetEntries())
+	policy := match.GetRateLimit()
+	if policy == nil || policy.GetUnlimited() {
+		return &rlsv3.RateLimitResponse_DescriptorStatus{
+			Code: rlsv3.RateLimitResponse_OK,
+		}
+	}
+	window, known := unitDurations[policy.GetUnit()]
+	if !known {
+		return &rlsv3.RateLimitResponse_DescriptorStatus{
+			Code: rlsv3.RateLimitResponse_OK,
+		}
+	}
+
+	count, reset := s.store.Increment(counterKey(domain, descriptor.GetEntries()), hits, window, now)
+
+	status := &rlsv3.RateLimitResponse_DescriptorStatus{
+		Code: rlsv3.RateLimitResponse_OK,
+		CurrentLimit: &rlsv3.RateLimitResponse_RateLimit{
+			Name:            policy.GetName(),
+			RequestsPerUnit: policy.GetRequestsPerUnit(),
+			Unit:            rlsv3.RateLimitResponse_RateLimit_Unit(policy.GetUnit()),
+		},
+		DurationUntilReset: durationpb.New(reset),
+	}
+
+	if count <= policy.GetRequestsPerUnit() {
+		status.LimitRemaining = policy.GetRequestsPerUnit() - count
+		return status
+	}
+
+	if match.GetShadowMode() {
+		s.log.V(1).Info("descriptor over limit in shadow mode", "domain", domain, "key", counterKey(domain, descriptor.GetEntries()))
+		return status
+	}
+
+	status.Code = rlsv3.RateLimitResponse_OVER_LIMIT
+	return status
+}
+
+// findDescriptor walks the configured descriptor tree following the request entries.
+// A configured descriptor matches an entry when the keys are equal and its value is
+// either equal or empty, exact values taking precedence.
+func findDescriptor(descriptors []*rlsconfv3.RateLimitDescriptor, entries []*ratelimitcommonv3.RateLimitDescriptor_Entry) *rlsconfv3.RateLimitDescriptor {
+	var match *rlsconfv3.RateLimitDescriptor
+	for _, entry := range entries {
+		match = nil
+		for _, descriptor := range descriptors {
+			if descriptor.GetKey() != entry.GetKey() {
+				continue
+			}
+			if descriptor.GetValue() == entry.GetValue() {
+				match = descriptor
+				break
+			}
+			if descriptor.GetValue() == "" && match == nil {
+				match = descriptor
+			}
+		}
+		if match == nil {
+			return nil
+		}
+		descriptors = match.GetDescriptors()
+	}
+	return match
+}
+
+func counterKey(domain string, entries []*ratelimitcommonv3.RateLimitDescriptor_Entry) string {
+	var b strings.Builder
+	b.WriteString(domain)
+	for _, entry := range entries {
+		b.WriteString("|")
+		b.WriteString(entry.GetKey())
+		b.WriteString("=")
+		b.WriteString(entry.GetValue())
+	}
+	return b.String()
+}
+
+func (s *RateLimitServer) Start(ctx context.Context) error {
+	// Create listener
+	listener, err := net.Listen(s.network, s.address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s://%s: %w", s.network, s.address, err)
+	}
+
+	s.log.Info("rate limit server listening", "network", s.network, "address", s.address)
+
+	// Monitor context cancellation
+	go func() {
+		<-ctx.Done()
+		s.log.Info("context cancelled, initiating graceful shutdown")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+		defer cancel()
+
+		if err := s.Shutdown(shutdownCtx); err != nil {
+			s.log.Error(err, "failed to shutdown rate limit server")
+		}
+	}()
+
+	return s.grpcServer.Serve(listener)
+}
+
+// NeedLeaderElection runs the rate limit server on every replica of a manager, as proxies reach
+// any of them. Each replica counts the hits it serves with its own store, so with the in-memory
+// store the effective limit is the configured limit times the number of replicas.
+func (s *RateLimitServer) NeedLeaderElection() bool {
+	return false
+}
+
+// Shutdown gracefully stops the rate limit server with timeout
+func (s *RateLimitServer) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.grpcServer.GracefulStop()
+	}()
+
+	select {
+	case <-done:
+		s.log.Info("rate limit server graceful shutdown complete")
+		return nil
+	case <-ctx.Done():
+		s.log.Info("shutdown timeout exceeded, forcing stop")
+		s.grpcServer.Stop()
+		return fmt.Errorf("shutdown timeout exceeded: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ratelimitcommonv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	rlsconfv3 "github.com/envoyproxy/go-control-plane/ratelimit/config/ratelimit/v3"
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *rlsconfv3.RateLimitConfig {
+	return &rlsconfv3.RateLimitConfig{
+		Name:   "default/test",
+		Domain: "test.service",
+		Descriptors: []*rlsconfv3.RateLimitDescriptor{
+			{
+				Key: "remote_address",
+				RateLimit: &rlsconfv3.RateLimitPolicy{
+					Unit:            rlsconfv3.RateLimitUnit_MINUTE,
+					RequestsPerUnit: 2,
+				},
+			},
+			{
+				Key:   "path",
+				Value: "/shadow",
+				RateLimit: &rlsconfv3.RateLimitPolicy{
+					Unit:            rlsconfv3.RateLimitUnit_SECOND,
+					RequestsPerUnit: 1,
+				},
+				ShadowMode: true,
+			},
+			{
+				Key: "tenant",
+				Descriptors: []*rlsconfv3.RateLimitDescriptor{
+					{
+						Key: "plan",
+						RateLimit: &rlsconfv3.RateLimitPolicy{
+							Unit:            rlsconfv3.RateLimitUnit_HOUR,
+							RequestsPerUnit: 1,
+						},
+					},
+					{
+						Key:   "plan",
+						Value: "premium",
+						RateLimit: &rlsconfv3.RateLimitPolicy{
+							Unlimited: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func request(domain string, entries ...string) *rlsv3.RateLimitRequest {
+	descriptor := &ratelimitcommonv3.RateLimitDescriptor{}
+	for i := 0; i < len(entries); i += 2 {
+		descriptor.Entries = append(descriptor.Entries, &ratelimitcommonv3.RateLimitDescriptor_Entry{
+			Key:   entries[i],
+			Value: entries[i+1],
+		})
+	}
+	return &rlsv3.RateLimitRequest{
+		Domain:      domain,
+		Descriptors: []*ratelimitcommonv3.RateLimitDescriptor{descriptor},
+	}
+}
+
+func TestRateLimitServer_ShouldRateLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  *rlsv3.RateLimitRequest
+		expected []rlsv3.RateLimitResponse_Code
+	}{
+		{
+			name:     "unknown domain is allowed",
+			request:  request("unknown", "remote_address", "10.0.0.1"),
+			expected: []rlsv3.RateLimitResponse_Code{rlsv3.RateLimitResponse_OK, rlsv3.RateLimitResponse_OK, rlsv3.RateLimitResponse_OK},
+		},
+		{
+			name:     "unmatched descriptor is allowed",
+			request:  request("test.service", "user", "alice"),
+			expected: []rlsv3.RateLimitResponse_Code{rlsv3.RateLimitResponse_OK, rlsv3.RateLimitResponse_OK, rlsv3.RateLimitResponse_OK},
+		},
+		{
+			name:     "wildcard value is limited",
+			request:  request("test.service", "remote_address", "10.0.0.1"),
+			expected: []rlsv3.RateLimitResponse_Code{rlsv3.RateLimitResponse_OK, rlsv3.RateLimitResponse_OK, rlsv3.RateLimitResponse_OVER_LIMIT},
+		},
+		{
+			name:     "shadow mode never limits",
+			request:  request("test.service", "path", "/shadow"),
+			expected: []rlsv3.RateLimitResponse_Code{rlsv3.RateLimitResponse_OK, rlsv3.RateLimitResponse_OK, rlsv3.RateLimitResponse_OK},
+		},
+		{
+			name:     "nested descriptor is limited",
+			request:  request("test.service", "tenant", "acme", "plan", "free"),
+			expected: []rlsv3.RateLimitResponse_Code{rlsv3.RateLimitResponse_OK, rlsv3.RateLimitResponse_OVER_LIMIT, rlsv3.RateLimitResponse_OVER_LIMIT},
+		},
+		{
+			name:     "exact value takes precedence over wildcard",
+			request:  request("test.service", "tenant", "acme", "plan", "premium"),
+			expected: []rlsv3.RateLimitResponse_Code{rlsv3.RateLimitResponse_OK, rlsv3.RateLimitResponse_OK, rlsv3.RateLimitResponse_OK},
+		},
+		{
+			name:     "partial match is allowed",
+			request:  request("test.service", "tenant", "acme"),
+			expected: []rlsv3.RateLimitResponse_Code{rlsv3.RateLimitResponse_OK, rlsv3.RateLimitResponse_OK, rlsv3.RateLimitResponse_OK},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+			srv := NewRateLimitServer(testr.New(t))
+			srv.now = func() time.Time { return now }
+			srv.SetConfig(testConfig())
+
+			for _, expected := range tt.expected {
+				resp, err := srv.ShouldRateLimit(context.Background(), tt.request)
+				require.NoError(t, err)
+				assert.Equal(t, expected, resp.OverallCode)
+				require.Len(t, resp.Statuses, 1)
+			}
+		})
+	}
+}
+
+// countingStore counts the increments of the counters.
+type countingStore struct {
+	Store
+	increments int
+}
+
+func (s *countingStore) Increment(key string, hits uint32, window time.Duration, now time.Time) (uint32, time.Duration) {
+	s.increments++
+	return s.Store.Increment(key, hits, window, now)
+}
+
+func TestRateLimitServer_UncountedDescriptors(t *testing.T) {
+	store := &countingStore{Store: NewMemoryStore()}
+	srv := NewRateLimitServer(testr.New(t), WithStore(store))
+	config := testConfig()
+	config.Descriptors = append(config.Descriptors, &rlsconfv3.RateLimitDescriptor{
+		Key:       "region",
+		RateLimit: &rlsconfv3.RateLimitPolicy{RequestsPerUnit: 1},
+	})
+	srv.SetConfig(config)
+
+	for name, req := range map[string]*rlsv3.RateLimitRequest{
+		"without limit": request("test.service", "tenant", "acme"),
+		"unlimited":     request("test.service", "tenant", "acme", "plan", "premium"),
+		"unknown unit":  request("test.service", "region", "eu"),
+	} {
+		resp, err := srv.ShouldRateLimit(context.Background(), req)
+		require.NoError(t, err, name)
+		assert.Equal(t, rlsv3.RateLimitResponse_OK, resp.OverallCode, name)
+		assert.Nil(t, resp.Statuses[0].GetCurrentLimit(), name)
+	}
+	assert.Zero(t, store.increments)
+}
+
+func TestRateLimitServer_WindowReset(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 30, 0, time.UTC)
+	srv := NewRateLimitServer(testr.New(t))
+	srv.now = func() time.Time { return now }
+	srv.SetConfig(testConfig())
+
+	req := request("test.service", "remote_address", "10.0.0.1")
+	for i := 0; i < 3; i++ {
+		_, err := srv.ShouldRateLimit(context.Background(), req)
+		require.NoError(t, err)
+	}
+
+	resp, err := srv.ShouldRateLimit(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, rlsv3.RateLimitResponse_OVER_LIMIT, resp.OverallCode)
+	assert.Equal(t, 30*time.Second, resp.Statuses[0].DurationUntilReset.AsDuration())
+
+	now = now.Add(30 * time.Second)
+	resp, err = srv.ShouldRateLimit(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, rlsv3.RateLimitResponse_OK, resp.OverallCode)
+	assert.Equal(t, uint32(1), resp.Statuses[0].LimitRemaining)
+}
+
+func TestRateLimitServer_DeleteConfig(t *testing.T) {
+	srv := NewRateLimitServer(testr.New(t))
+	srv.SetConfig(testConfig())
+
+	updated := testConfig()
+	updated.Domain = "renamed.service"
+	srv.SetConfig(updated)
+	assert.NotContains(t, srv.domains, "test.service")
+	assert.Contains(t, srv.domains, "renamed.service")
+
+	srv.DeleteConfig("default/test")
+	assert.Empty(t, srv.configs)
+	assert.Empty(t, srv.domains)
+}
+
+func TestRateLimitServer_DeleteConfig_SharedDomain(t *testing.T) {
+	srv := NewRateLimitServer(testr.New(t))
+	srv.SetConfig(testConfig())
+
+	other := testConfig()
+	other.Name = "default/other"
+	srv.SetConfig(other)
+
+	// the domain taken over by another configuration is kept
+	srv.DeleteConfig("default/test")
+	assert.Same(t, other, srv.domains["test.service"])
+}
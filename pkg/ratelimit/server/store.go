@@ -0,0 +1,70 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultPurgeInterval = time.Minute
+)
+
+// Store keeps the hit counters for rate limit windows.
+type Store interface {
+	// Increment adds hits to the counter identified by key for the window that
+	// contains now, and returns the updated count and the time left until the window resets.
+	Increment(key string, hits uint32, window time.Duration, now time.Time) (uint32, time.Duration)
+}
+
+type counter struct {
+	count     uint32
+	expiresAt time.Time
+}
+
+// MemoryStore is a fixed window Store kept in process memory. Its counters are not shared, so
+// each replica of the rate limit server allows the configured limit on its own.
+type MemoryStore struct {
+	mu sync.Mutex
+
+	counters  map[string]*counter
+	lastPurge time.Time
+}
+
+var _ Store = &MemoryStore{}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		counters: map[string]*counter{},
+	}
+}
+
+func (s *MemoryStore) Increment(key string, hits uint32, window time.Duration, now time.Time) (uint32, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastPurge) >= defaultPurgeInterval {
+		s.purge(now)
+	}
+
+	c, exists := s.counters[key]
+	if !exists || !now.Before(c.expiresAt) {
+		c = &counter{
+			expiresAt: now.Truncate(window).Add(window),
+		}
+		s.counters[key] = c
+	}
+
+	c.count += hits
+
+	return c.count, c.expiresAt.Sub(now)
+}
+
+// purge removes expired counters. It must be called with the lock held.
+func (s *MemoryStore) purge(now time.Time) {
+	for key, c := range s.counters {
+		if !now.Before(c.expiresAt) {
+			delete(s.counters, key)
+		}
+	}
+	s.lastPurge = now
+}